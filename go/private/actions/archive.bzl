@@ -58,16 +58,28 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
     # store export information for compiling dependent packages separately
     out_export = go.declare_file(go, name = source.library.name, ext = pre_ext + ".x")
     out_cgo_export_h = None  # set if cgo used in c-shared or c-archive mode
+    out_cgo_go_srcs = None  # set if cgo used, for nogo and the packages driver
 
     nogo = get_nogo(go)
     if nogo:
         out_facts = go.declare_file(go, name = source.library.name, ext = pre_ext + ".facts")
         out_nogo_log = go.declare_file(go, name = source.library.name, ext = pre_ext + ".nogo.log")
         out_nogo_validation = go.declare_file(go, name = source.library.name, ext = pre_ext + ".nogo")
+        out_nogo_fix = go.declare_file(go, name = source.library.name, ext = pre_ext + ".nogo.patch")
+        out_nogo_json = go.declare_file(go, name = source.library.name, ext = pre_ext + ".nogo.json")
+        out_nogo_sarif = go.declare_file(go, name = source.library.name, ext = pre_ext + ".nogo.sarif")
+        if go.mode.nogo_profile:
+            out_nogo_profile = go.declare_file(go, name = source.library.name, ext = pre_ext + ".nogo.profile.json")
+        else:
+            out_nogo_profile = None
     else:
         out_facts = None
         out_nogo_log = None
         out_nogo_validation = None
+        out_nogo_fix = None
+        out_nogo_json = None
+        out_nogo_sarif = None
+        out_nogo_profile = None
 
     direct = source.deps
 
@@ -98,6 +110,11 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
         )
         if go.mode.linkmode in (LINKMODE_C_SHARED, LINKMODE_C_ARCHIVE):
             out_cgo_export_h = go.declare_file(go, path = "_cgo_install.h")
+        if nogo or not (source.cover and go.coverdata):
+            # With coverage, the builder has to run cgo a second time on the
+            # uninstrumented sources to generate these, which is only worth it
+            # for nogo. The packages driver then reports the cgo sources instead.
+            out_cgo_go_srcs = go.declare_directory(go, path = out_lib.basename + ".cgo")
         cgo_deps = cgo.deps
         runfiles = runfiles.merge(cgo.runfiles)
         emit_compilepkg(
@@ -113,8 +130,13 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
             out_facts = out_facts,
             out_nogo_log = out_nogo_log,
             out_nogo_validation = out_nogo_validation,
+            out_nogo_fix = out_nogo_fix,
+            out_nogo_json = out_nogo_json,
+            out_nogo_sarif = out_nogo_sarif,
+            out_nogo_profile = out_nogo_profile,
             nogo = nogo,
             out_cgo_export_h = out_cgo_export_h,
+            out_cgo_go_srcs = out_cgo_go_srcs,
             gc_goopts = source.gc_goopts,
             cgo = True,
             cgo_inputs = cgo.inputs,
@@ -142,6 +164,10 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
             out_facts = out_facts,
             out_nogo_log = out_nogo_log,
             out_nogo_validation = out_nogo_validation,
+            out_nogo_fix = out_nogo_fix,
+            out_nogo_json = out_nogo_json,
+            out_nogo_sarif = out_nogo_sarif,
+            out_nogo_profile = out_nogo_profile,
             nogo = nogo,
             gc_goopts = source.gc_goopts,
             cgo = False,
@@ -187,7 +213,12 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
         facts_file = out_facts,
         runfiles = source.runfiles,
         _validation_output = out_nogo_validation,
+        _nogo_fix_output = out_nogo_fix,
+        _nogo_json_output = out_nogo_json,
+        _nogo_sarif_output = out_nogo_sarif,
+        _nogo_profile_output = out_nogo_profile,
         _cgo_deps = cgo_deps,
+        _cgo_go_srcs = out_cgo_go_srcs,
     )
     x_defs = dict(source.x_defs)
     for a in direct:
@@ -70,8 +70,13 @@ def emit_compilepkg(
         out_facts = None,
         out_nogo_log = None,
         out_nogo_validation = None,
+        out_nogo_fix = None,
+        out_nogo_json = None,
+        out_nogo_sarif = None,
+        out_nogo_profile = None,
         nogo = None,
         out_cgo_export_h = None,
+        out_cgo_go_srcs = None,
         gc_goopts = [],
         testfilter = None,  # TODO: remove when test action compiles packages
         recompile_internal_deps = [],
@@ -87,8 +92,16 @@ def emit_compilepkg(
         fail("nogo must be specified if and only if out_nogo_log is specified")
     if bool(nogo) != bool(out_nogo_validation):
         fail("nogo must be specified if and only if out_nogo_validation is specified")
+    if bool(nogo) != bool(out_nogo_fix):
+        fail("nogo must be specified if and only if out_nogo_fix is specified")
+    if bool(nogo) != bool(out_nogo_json):
+        fail("nogo must be specified if and only if out_nogo_json is specified")
+    if bool(nogo) != bool(out_nogo_sarif):
+        fail("nogo must be specified if and only if out_nogo_sarif is specified")
+    if out_nogo_profile and not nogo:
+        fail("nogo must be specified if out_nogo_profile is specified")
 
-    if cover and go.coverdata:
+    if cover and go.coverdata and not go.mode.native_coverage:
         archives = archives + [go.coverdata]
 
     sdk = go.sdk
@@ -123,6 +136,8 @@ def emit_compilepkg(
             cover_mode = "set"
         args.add("-cover_mode", cover_mode)
         args.add("-cover_format", go.mode.cover_format)
+        if go.mode.native_coverage:
+            args.add("-cover_native")
         args.add_all(cover, before_each = "-cover")
 
     args.add_all(archives, before_each = "-arc", map_each = _archive)
@@ -170,12 +185,10 @@ def emit_compilepkg(
     else:
         env = go.env_for_path_mapping
         execution_requirements = SUPPORTS_PATH_MAPPING_REQUIREMENT
-    cgo_go_srcs_for_nogo = None
     if cgo:
-        if nogo:
-            cgo_go_srcs_for_nogo = go.declare_directory(go, path = out_lib.basename + ".cgo")
-            outputs.append(cgo_go_srcs_for_nogo)
-            args.add("-cgo_go_srcs", cgo_go_srcs_for_nogo.path)
+        if out_cgo_go_srcs:
+            outputs.append(out_cgo_go_srcs)
+            args.add("-cgo_go_srcs", out_cgo_go_srcs.path)
         inputs_transitive.append(cgo_inputs)
         inputs_transitive.append(go.cc_toolchain_files)
         env["CC"] = go.cgo_tools.c_compiler_path
@@ -211,16 +224,22 @@ def emit_compilepkg(
         _run_nogo(
             go,
             sources = sources,
-            cgo_go_srcs = cgo_go_srcs_for_nogo,
+            cgo_go_srcs = out_cgo_go_srcs,
             importpath = importpath,
             importmap = importmap,
             archives = archives,
             recompile_internal_deps = recompile_internal_deps,
-            cover_mode = cover_mode,
+            # nogo checks the sources before instrumentation, which only need
+            # coverdata with the legacy coverage instrumentation.
+            cover_mode = None if go.mode.native_coverage else cover_mode,
             testfilter = testfilter,
             out_facts = out_facts,
             out_log = out_nogo_log,
             out_validation = out_nogo_validation,
+            out_fix = out_nogo_fix,
+            out_json = out_nogo_json,
+            out_sarif = out_nogo_sarif,
+            out_profile = out_nogo_profile,
             nogo = nogo,
         )
 
@@ -238,6 +257,10 @@ def _run_nogo(
         out_facts,
         out_log,
         out_validation,
+        out_fix,
+        out_json,
+        out_sarif,
+        out_profile,
         nogo):
     """Runs nogo on Go source files, including those generated by cgo."""
     sdk = go.sdk
@@ -246,7 +269,9 @@ def _run_nogo(
                      [archive.data.facts_file for archive in archives if archive.data.facts_file] +
                      [archive.data.export_file for archive in archives])
     inputs_transitive = [sdk.tools, sdk.headers, go.stdlib.libs]
-    outputs = [out_facts, out_log]
+    outputs = [out_facts, out_log, out_fix, out_json, out_sarif]
+    if out_profile:
+        outputs.append(out_profile)
 
     args = go.builder_args(go, "nogo", use_path_mapping = True)
     args.add_all(sources, before_each = "-src")
@@ -271,7 +296,17 @@ def _run_nogo(
     args.add_all(archives, before_each = "-facts", map_each = _facts)
     args.add("-out_facts", out_facts)
     args.add("-out_log", out_log)
+    args.add("-out_fix", out_fix)
+    args.add("-out_json", out_json)
+    args.add("-out_sarif", out_sarif)
+    if out_profile:
+        args.add("-out_profile", out_profile)
     args.add("-nogo", nogo)
+    if go.nogo_stdlib_facts:
+        inputs_direct.append(go.nogo_stdlib_facts)
+        args.add_all("-stdlib_facts", [go.nogo_stdlib_facts], expand_directories = False)
+    args.add("-label", str(go.label))
+    args.add_all(go.target_tags, before_each = "-tag")
 
     # This action runs nogo and produces the facts files for downstream nogo actions.
     # It is important that this action doesn't fail if nogo produces findings, which allows users
@@ -108,11 +108,11 @@ def emit_link(
 
     # TODO(zbarsky): Bazel versions older than 7.2.0 do not properly deduplicate this dep
     # Can replace with the following once we support Bazel 7.2.0+ only:
-    #    if go.coverage_enabled and go.coverdata:
+    #    if go.coverage_enabled and go.coverdata and not go.mode.native_coverage:
     #        test_archives = list(test_archives) + [go.coverdata.data]
     #    arcs = depset(test_archives, transitive = [d.transitive for d in archive.direct])
 
-    if go.coverage_enabled and go.coverdata:
+    if go.coverage_enabled and go.coverdata and not go.mode.native_coverage:
         potentially_duplicated_arcs = depset(test_archives + [go.coverdata.data], transitive = [d.transitive for d in archive.direct]).to_list()
         importmaps = {}
         arcs = []
@@ -177,7 +177,7 @@ def emit_link(
     tool_args.add_joined("-extldflags", extldflags, join_with = " ")
 
     inputs_direct = stamp_inputs + [go.sdk.package_list]
-    if go.coverage_enabled and go.coverdata:
+    if go.coverage_enabled and go.coverdata and not go.mode.native_coverage:
         inputs_direct.append(go.coverdata.data.file)
     inputs_transitive = [
         archive.libs,
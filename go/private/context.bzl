@@ -53,6 +53,8 @@ load(
     ":common.bzl",
     "COVERAGE_OPTIONS_DENYLIST",
     "GO_TOOLCHAIN",
+    "GO_TOOLCHAIN_LABEL",
+    "SUPPORTS_PATH_MAPPING_REQUIREMENT",
     "as_iterable",
 )
 load(
@@ -404,10 +406,13 @@ default_go_config_info = GoConfigInfo(
     tags = [],
     stamp = False,
     cover_format = None,
+    native_coverage = False,
     gc_goopts = [],
     amd64 = None,
     arm = None,
     pgoprofile = None,
+    nogo_profile = False,
+    nogo_stdlib = False,
 )
 
 def go_context(
@@ -577,6 +582,7 @@ def go_context(
         pathtype = pathtype,
         cgo_tools = cgo_tools,
         nogo = go_context_info.nogo if go_context_info else None,
+        nogo_stdlib_facts = go_context_info.nogo_stdlib_facts if go_context_info else None,
         coverdata = go_context_info.coverdata if go_context_info else None,
         coverage_enabled = ctx.configuration.coverage_enabled,
         coverage_instrumented = ctx.coverage_instrumented(),
@@ -587,6 +593,8 @@ def go_context(
         # configuration segment.
         env_for_path_mapping = {k: v for k, v in env.items() if k != "GOROOT"},
         label = ctx.label,
+        # The Bazel tags of the target, which scope nogo analyzers. Go build tags are in mode.tags.
+        target_tags = getattr(ctx.attr, "tags", []),
 
         # Action generators
         archive = toolchain.actions.archive,
@@ -615,10 +623,14 @@ def _go_context_data_impl(ctx):
     if "msan" in ctx.features:
         print("WARNING: --features=msan is no longer supported. Use --@io_bazel_rules_go//go/config:msan instead.")
     nogo = ctx.files.nogo[0] if ctx.files.nogo else None
+    nogo_stdlib_facts = None
+    if nogo and ctx.attr.go_config[GoConfigInfo].nogo_stdlib:
+        nogo_stdlib_facts = _emit_nogo_stdlib_facts(ctx, nogo)
     providers = [
         GoContextInfo(
             coverdata = ctx.attr.coverdata[0][GoArchive],
             nogo = nogo,
+            nogo_stdlib_facts = nogo_stdlib_facts,
         ),
         ctx.attr.stdlib[GoStdLib],
         ctx.attr.go_config[GoConfigInfo],
@@ -627,6 +639,37 @@ def _go_context_data_impl(ctx):
         providers.append(ctx.attr.cgo_context_data[CgoContextInfo])
     return providers
 
+def _emit_nogo_stdlib_facts(ctx, nogo):
+    """Runs nogo on the standard library and returns a directory with the facts of each package.
+
+    This happens once per configuration, since go_context_data is shared by all Go targets.
+    """
+    go = go_context(
+        ctx,
+        attr = struct(
+            _go_config = ctx.attr.go_config,
+            _stdlib = ctx.attr.stdlib,
+            cgo_context_data = ctx.attr.cgo_context_data,
+        ),
+        include_deprecated_properties = False,
+    )
+    out = go.declare_directory(go, path = "nogo_stdlib_facts")
+    args = go.builder_args(go, "nogostdlib", use_path_mapping = True)
+    args.add("-nogo", nogo)
+    args.add_all("-out", [out], expand_directories = False)
+    go.actions.run(
+        inputs = depset([nogo], transitive = [go.sdk.srcs, go.stdlib.libs]),
+        outputs = [out],
+        mnemonic = "GoStdlibNogo",
+        executable = go.toolchain._builder,
+        arguments = [args],
+        env = go.env_for_path_mapping,
+        toolchain = GO_TOOLCHAIN_LABEL,
+        execution_requirements = SUPPORTS_PATH_MAPPING_REQUIREMENT,
+        progress_message = "Running nogo on the standard library",
+    )
+    return out
+
 go_context_data = rule(
     _go_context_data_impl,
     attrs = {
@@ -952,10 +995,13 @@ def _go_config_impl(ctx):
         tags = tags,
         stamp = ctx.attr.stamp,
         cover_format = ctx.attr.cover_format[BuildSettingInfo].value,
+        native_coverage = ctx.attr.native_coverage[BuildSettingInfo].value,
         gc_goopts = ctx.attr.gc_goopts[BuildSettingInfo].value,
         amd64 = ctx.attr.amd64,
         arm = ctx.attr.arm,
         pgoprofile = pgoprofile,
+        nogo_profile = ctx.attr.nogo_profile[BuildSettingInfo].value,
+        nogo_stdlib = ctx.attr.nogo_stdlib[BuildSettingInfo].value,
     )
     validate_mode(go_config_info)
 
@@ -1002,6 +1048,10 @@ go_config = rule(
             mandatory = True,
             providers = [BuildSettingInfo],
         ),
+        "native_coverage": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
         "gc_goopts": attr.label(
             mandatory = True,
             providers = [BuildSettingInfo],
@@ -1012,6 +1062,14 @@ go_config = rule(
             mandatory = True,
             allow_files = True,
         ),
+        "nogo_profile": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "nogo_stdlib": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
     },
     provides = [GoConfigInfo],
     doc = """Collects information about build settings in the current
@@ -148,12 +148,20 @@ def _go_binary_impl(ctx):
         executable = executable,
     )
     validation_output = archive.data._validation_output
+    nogo_fix_output = archive.data._nogo_fix_output
+    nogo_json_output = archive.data._nogo_json_output
+    nogo_sarif_output = archive.data._nogo_sarif_output
+    nogo_profile_output = archive.data._nogo_profile_output
 
     providers = [
         archive,
         OutputGroupInfo(
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
+            nogo_fix = [nogo_fix_output] if nogo_fix_output else [],
+            nogo_json = [nogo_json_output] if nogo_json_output else [],
+            nogo_sarif = [nogo_sarif_output] if nogo_sarif_output else [],
+            nogo_profile = [nogo_profile_output] if nogo_profile_output else [],
             _validation = [validation_output] if validation_output else [],
         ),
     ]
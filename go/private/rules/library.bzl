@@ -48,6 +48,10 @@ def _go_library_impl(ctx):
     source = go.library_to_source(go, ctx.attr, library, ctx.coverage_instrumented())
     archive = go.archive(go, source)
     validation_output = archive.data._validation_output
+    nogo_fix_output = archive.data._nogo_fix_output
+    nogo_json_output = archive.data._nogo_json_output
+    nogo_sarif_output = archive.data._nogo_sarif_output
+    nogo_profile_output = archive.data._nogo_profile_output
 
     return [
         library,
@@ -65,6 +69,10 @@ def _go_library_impl(ctx):
         OutputGroupInfo(
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
+            nogo_fix = [nogo_fix_output] if nogo_fix_output else [],
+            nogo_json = [nogo_json_output] if nogo_json_output else [],
+            nogo_sarif = [nogo_sarif_output] if nogo_sarif_output else [],
+            nogo_profile = [nogo_profile_output] if nogo_profile_output else [],
             _validation = [validation_output] if validation_output else [],
         ),
     ]
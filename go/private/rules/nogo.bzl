@@ -31,6 +31,10 @@ load(
     "go_tool_transition",
 )
 
+# Labels of targets in external repositories are formatted with canonical
+# repository names, which start with "@@", if Bzlmod is enabled.
+_BZLMOD_ENABLED = str(Label("//:unused")).startswith("@@")
+
 def _nogo_impl(ctx):
     if not ctx.attr.deps:
         # If there aren't any analyzers to run, don't generate a binary.
@@ -45,6 +49,10 @@ def _nogo_impl(ctx):
     nogo_args.add("-output", nogo_main)
     if ctx.attr.debug:
         nogo_args.add("-debug")
+    if ctx.attr.standalone:
+        nogo_args.add("-standalone")
+    if _BZLMOD_ENABLED:
+        nogo_args.add("-bzlmod")
     nogo_inputs = []
     analyzer_archives = [dep[GoArchive] for dep in ctx.attr.deps]
     analyzer_importpaths = [archive.data.importpath for archive in analyzer_archives]
@@ -52,6 +60,9 @@ def _nogo_impl(ctx):
     if ctx.file.config:
         nogo_args.add("-config", ctx.file.config)
         nogo_inputs.append(ctx.file.config)
+    if ctx.file.baseline:
+        nogo_args.add("-baseline", ctx.file.baseline)
+        nogo_inputs.append(ctx.file.baseline)
     ctx.actions.run(
         inputs = nogo_inputs,
         outputs = [nogo_main],
@@ -74,7 +85,7 @@ def _nogo_impl(ctx):
 
     nogo_source = go.library_to_source(go, struct(
         srcs = [struct(files = [nogo_main])],
-        embed = [ctx.attr._nogo_srcs],
+        embed = [ctx.attr._nogo_standalone_srcs if ctx.attr.standalone else ctx.attr._nogo_srcs],
         deps = analyzer_archives,
     ), nogo_library, False)
     _, executable, runfiles = go.binary(
@@ -97,12 +108,21 @@ _nogo = rule(
         "config": attr.label(
             allow_single_file = True,
         ),
+        "baseline": attr.label(
+            allow_single_file = True,
+        ),
         "debug": attr.bool(
             default = False,
         ),
+        "standalone": attr.bool(
+            default = False,
+        ),
         "_nogo_srcs": attr.label(
             default = "//go/tools/builders:nogo_srcs",
         ),
+        "_nogo_standalone_srcs": attr.label(
+            default = "//go/tools/builders:nogo_standalone_srcs",
+        ),
         "_cgo_context_data": attr.label(default = "//:cgo_context_data_proxy"),
         "_go_config": attr.label(default = "//:go_config"),
         "_stdlib": attr.label(default = "//:stdlib"),
@@ -141,6 +161,16 @@ def nogo(name, visibility = None, **kwargs):
         **kwargs
     )
 
+    # The standalone driver runs the same analyzers with the same configuration
+    # on packages loaded with go/packages, e.g. from an editor or a pre-commit
+    # hook. It isn't used by the build, so it doesn't need the alias above.
+    _nogo(
+        name = "%s_standalone" % name,
+        standalone = True,
+        visibility = visibility,
+        **kwargs
+    )
+
 def nogo_wrapper(**kwargs):
     if kwargs.get("vet"):
         kwargs["deps"] = kwargs.get("deps", []) + [
@@ -68,6 +68,10 @@ def _go_test_impl(ctx):
     )
 
     validation_outputs = []
+    nogo_fix_outputs = []
+    nogo_json_outputs = []
+    nogo_sarif_outputs = []
+    nogo_profile_outputs = []
 
     # Compile the library to test with internal white box tests
     internal_library = go.new_library(go, testfilter = "exclude")
@@ -75,6 +79,14 @@ def _go_test_impl(ctx):
     internal_archive = go.archive(go, internal_source)
     if internal_archive.data._validation_output:
         validation_outputs.append(internal_archive.data._validation_output)
+    if internal_archive.data._nogo_fix_output:
+        nogo_fix_outputs.append(internal_archive.data._nogo_fix_output)
+    if internal_archive.data._nogo_json_output:
+        nogo_json_outputs.append(internal_archive.data._nogo_json_output)
+    if internal_archive.data._nogo_sarif_output:
+        nogo_sarif_outputs.append(internal_archive.data._nogo_sarif_output)
+    if internal_archive.data._nogo_profile_output:
+        nogo_profile_outputs.append(internal_archive.data._nogo_profile_output)
     go_srcs = [src for src in internal_source.srcs if src.extension == "go"]
 
     # Compile the library with the external black box tests
@@ -95,6 +107,14 @@ def _go_test_impl(ctx):
     external_archive = go.archive(go, external_source, is_external_pkg = True)
     if external_archive.data._validation_output:
         validation_outputs.append(external_archive.data._validation_output)
+    if external_archive.data._nogo_fix_output:
+        nogo_fix_outputs.append(external_archive.data._nogo_fix_output)
+    if external_archive.data._nogo_json_output:
+        nogo_json_outputs.append(external_archive.data._nogo_json_output)
+    if external_archive.data._nogo_sarif_output:
+        nogo_sarif_outputs.append(external_archive.data._nogo_sarif_output)
+    if external_archive.data._nogo_profile_output:
+        nogo_profile_outputs.append(external_archive.data._nogo_profile_output)
 
     # now generate the main function
     repo_relative_rundir = ctx.attr.rundir or ctx.label.package or "."
@@ -116,6 +136,9 @@ def _go_test_impl(ctx):
         else:
             arguments.add("-cover_mode", "set")
         arguments.add("-cover_format", go.mode.cover_format)
+        if go.mode.native_coverage:
+            arguments.add("-cover_native")
+            arguments.add("-cover_go_tool", _rlocation_path(ctx, go.sdk.go))
     arguments.add(
         # the l is the alias for the package under test, the l_test must be the
         # same with the test suffix
@@ -128,9 +151,13 @@ def _go_test_impl(ctx):
     )
     arguments.add("-pkgname", internal_source.library.importpath)
     arguments.add_all(go_srcs, before_each = "-src", format_each = "l=%s")
+    if ctx.files.shard_timings and ctx.attr.shard_strategy != "duration":
+        fail("shard_timings may only be set if shard_strategy is \"duration\"")
+    arguments.add("-shard_strategy", ctx.attr.shard_strategy)
+    arguments.add_all(ctx.files.shard_timings, before_each = "-shard_timings")
 
     ctx.actions.run(
-        inputs = go_srcs,
+        inputs = go_srcs + ctx.files.shard_timings,
         outputs = [main_go],
         mnemonic = "GoTestGenTest",
         executable = go.toolchain._builder,
@@ -163,7 +190,7 @@ def _go_test_impl(ctx):
         resolve = None,
     )
     test_deps = external_archive.direct + [external_archive] + ctx.attr._testmain_additional_deps
-    if go.coverage_enabled:
+    if go.coverage_enabled and not go.mode.native_coverage:
         test_deps.append(go.coverdata)
     test_source = go.library_to_source(go, struct(
         srcs = [struct(files = [main_go])],
@@ -179,6 +206,13 @@ def _go_test_impl(ctx):
         info_file = ctx.info_file,
     )
 
+    if go.coverage_enabled and go.mode.native_coverage:
+        # The test converts native coverage data with "go tool covdata".
+        runfiles = runfiles.merge(ctx.runfiles(
+            files = [go.sdk.go],
+            transitive_files = go.sdk.tools,
+        ))
+
     env = {}
     for k, v in ctx.attr.env.items():
         env[k] = ctx.expand_location(v, ctx.attr.data)
@@ -199,6 +233,10 @@ def _go_test_impl(ctx):
         ),
         OutputGroupInfo(
             compilation_outputs = [internal_archive.data.file],
+            nogo_fix = nogo_fix_outputs,
+            nogo_json = nogo_json_outputs,
+            nogo_sarif = nogo_sarif_outputs,
+            nogo_profile = nogo_profile_outputs,
             _validation = validation_outputs,
         ),
         coverage_common.instrumented_files_info(
@@ -210,6 +248,12 @@ def _go_test_impl(ctx):
         run_environment_info,
     ]
 
+def _rlocation_path(ctx, file):
+    """Returns the path of file relative to the runfiles directory."""
+    if file.short_path.startswith("../"):
+        return file.short_path[len("../"):]
+    return ctx.workspace_name + "/" + file.short_path
+
 _go_test_kwargs = {
     "implementation": _go_test_impl,
     "attrs": {
@@ -312,6 +356,32 @@ _go_test_kwargs = {
             See [Defines and stamping] for examples of how to use these.
             """,
         ),
+        "shard_strategy": attr.string(
+            default = "index",
+            values = ["index", "hash", "duration"],
+            doc = """Determines how tests, examples, and fuzz targets are assigned to shards
+            when the test is sharded with `shard_count`. Each shard logs the tests it runs.
+            <br><br>
+            <ul>
+            <li>`index` (default): Assigns tests round-robin in the order they are declared.
+            Examples and fuzz targets are not sharded and run in every shard.</li>
+            <li>`hash`: Assigns tests by a hash of their name, so that adding or removing
+            a test does not move other tests to different shards.</li>
+            <li>`duration`: Assigns the longest tests first, each to the shard with the
+            least total duration so far, using the durations in `shard_timings`. Tests
+            without a duration are assumed to take as long as the average test.</li>
+            </ul>
+            """,
+        ),
+        "shard_timings": attr.label_list(
+            allow_files = True,
+            doc = """Files with the durations of tests for the `duration` shard strategy.
+            Each file is either a JUnit XML report, like the `test.xml` files written
+            to `bazel-testlogs` for each shard, or a text file with one
+            `TestName duration` line per test, e.g. `TestSlow 1m30s`. If a test is
+            listed several times, its longest duration is used.
+            """,
+        ),
         "linkmode": attr.string(
             default = "auto",
             values = ["auto"] + LINKMODES,
@@ -484,7 +554,52 @@ _go_test_kwargs = {
     disabled by setting `GO_TEST_WRAP=0` in the test environment. Additionally,
     the testbinary can be invoked with `-test.v` by setting
     `GO_TEST_WRAP_TESTV=1` in the test environment; this will result in the
-    `XML_OUTPUT_FILE` containing more granular data.<br><br>
+    `XML_OUTPUT_FILE` containing more granular data. Setting
+    `GO_TEST_XML_REPORT=detailed` in the test environment groups subtests under
+    their parent test, stores the output of each test in `system-out`, uses the
+    location of the first error as the failure message, and reports panics and
+    timeouts against the tests that were running. If a wrapped test is still
+    running shortly before Bazel's timeout, e.g. because it hangs in `TestMain`
+    where `-test.timeout` has no effect, the wrapper sends it `SIGQUIT` and
+    writes the resulting goroutine dump to `test_timeout_goroutines.txt` in the
+    undeclared test outputs. The tests that were running are reported as timed
+    out in `XML_OUTPUT_FILE`. The wrapper also writes the test2json event stream
+    of the test, with timestamps, to `test.json` in the undeclared test outputs,
+    in the format of `go test -json`; set `GO_TEST_JSON=0` to disable this.
+    Setting `GO_TEST_JSON=1` enables the wrapper even if no XML report is
+    requested and runs the test binary with `-test.v`, like `go test -json`. With
+    `bazel run`, the event stream is then written to stdout instead of the output
+    of the test.<br><br>
+    To retry flaky tests, set `GO_TEST_RETRY_FAILED` to the number of retries,
+    e.g. `bazel test --test_env=GO_TEST_RETRY_FAILED=2 //pkg:pkg_test`. The
+    wrapper then runs the test binary with `-test.v` and reruns the top-level
+    tests that failed, up to that many times, in a new process. The test passes if
+    all of them eventually pass. The failures of previous attempts are reported as
+    `flakyFailure` elements in the XML report if the test passed on retry, and as
+    `rerunFailure` elements otherwise. Tests are not retried if the test binary
+    crashed or timed out, nor while fuzzing or running benchmarks. All attempts
+    share `TEST_TIMEOUT`: a retry only gets the time that is left, and failed
+    tests are not retried if too little of it is left.<br><br>
+    To fuzz a target, set `GO_FUZZ_TARGET` to its name and optionally
+    `GO_FUZZ_TIME` to the time to fuzz for, like the `-fuzz` and `-fuzztime`
+    flags of `go test`, e.g. `bazel test --test_env=GO_FUZZ_TARGET=FuzzFoo
+    --test_env=GO_FUZZ_TIME=60s //pkg:pkg_test`. The seed corpus is read from
+    `testdata/fuzz` in the runfiles, so it should be added to `data`. The
+    generated corpus is cached in `GO_FUZZ_CACHE_DIR`, or in the user's cache
+    directory if that is writable, so that it persists across runs. Failing inputs
+    and new corpus entries are saved to the undeclared test outputs in the
+    `testdata/fuzz/FuzzFoo` layout. With `bazel run`, failing inputs are saved to
+    the package directory in the workspace instead, like with `go test`. Fuzzing
+    is guided by coverage only if the package under test is compiled with
+    `gc_goopts = ["-d=libfuzzer"]`.<br><br>
+    To run benchmarks instead of tests, set `GO_BENCH` to a pattern of the
+    benchmarks to run and optionally `GO_BENCH_TIME` and `GO_BENCH_COUNT`, like
+    the `-bench`, `-benchtime` and `-count` flags of `go test`, e.g. `bazel test
+    --test_env=GO_BENCH=. --test_env=GO_BENCH_COUNT=10 //pkg:pkg_test`. Memory
+    allocations are always reported. The results are written to
+    `benchmarks.txt` in the undeclared test outputs in the format read by
+    `benchstat`, and the metrics of each benchmark are added as properties to
+    its test case in `XML_OUTPUT_FILE`.<br><br>
     ***Note:*** To interoperate cleanly with old targets generated by [Gazelle], `name`
     should be `go_default_test` for internal tests and
     `go_default_xtest` for external tests. Gazelle now generates
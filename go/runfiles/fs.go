@@ -38,8 +38,7 @@ func (r *Runfiles) Open(name string) (fs.File, error) {
 		return &rootDirFile{".", r, nil}, nil
 	}
 	repo, inRepoPath, hasInRepoPath := strings.Cut(name, "/")
-	key := repoMappingKey{r.sourceRepo, repo}
-	targetRepoDirectory, exists := r.repoMapping[key]
+	targetRepoDirectory, exists := r.repoMapping.lookup(r.sourceRepo, repo)
 	if !exists {
 		// Either name uses a canonical repo name or refers to a root symlink.
 		// In both cases, we can just open the file directly.
@@ -93,10 +92,8 @@ func (r *rootDirFile) initEntries() error {
 	// visible to the main repo (plus root symlinks). We thus need to read
 	// the real entries and then transform and filter them.
 	canonicalToApparentName := make(map[string]string)
-	for k, v := range r.rf.repoMapping {
-		if k.sourceRepo == r.rf.sourceRepo {
-			canonicalToApparentName[v] = k.targetRepoApparentName
-		}
+	for apparent, canonical := range r.rf.repoMapping.visibleRepos(r.rf.sourceRepo) {
+		canonicalToApparentName[canonical] = apparent
 	}
 	rootFile, err := r.rf.impl.open(".")
 	if err != nil {
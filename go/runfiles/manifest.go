@@ -16,6 +16,7 @@ package runfiles
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
@@ -24,6 +25,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -34,7 +37,7 @@ import (
 type ManifestFile string
 
 func (f ManifestFile) new(sourceRepo SourceRepo) (*Runfiles, error) {
-	m, err := f.parse()
+	m, err := f.load()
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +57,7 @@ func (f ManifestFile) new(sourceRepo SourceRepo) (*Runfiles, error) {
 			legacyDirectoryVar+"="+d)
 	}
 	r := &Runfiles{
-		impl:       &m,
+		impl:       m,
 		env:        env,
 		sourceRepo: string(sourceRepo),
 	}
@@ -62,71 +65,351 @@ func (f ManifestFile) new(sourceRepo SourceRepo) (*Runfiles, error) {
 	return r, err
 }
 
-type trie map[string]trie
-
+// manifest looks up runfiles in a runfiles manifest file. The file can have
+// hundreds of thousands of lines, so it is not parsed up front: Bazel writes it
+// sorted by runfiles path, which allows looking up a single runfile by binary
+// search in the file. A manifest that was not written by Bazel may not be
+// sorted, so when a lookup fails, the file is checked once for whether it is
+// sorted. The whole file is only read into a compact index when a directory
+// has to be listed or a lookup fails in an unsorted manifest.
 type manifest struct {
-	index map[string]string
-	trie  trie
+	file string
+
+	sortedOnce sync.Once
+	sorted     bool
+	sortedErr  error
+
+	indexOnce sync.Once
+	// indexed is set atomically once index and indexErr are valid.
+	indexed  uint32
+	index    *manifestIndex
+	indexErr error
+}
+
+func (f ManifestFile) load() (*manifest, error) {
+	if _, err := os.Stat(string(f)); err != nil {
+		return nil, fmt.Errorf("runfiles: can’t open manifest file: %w", err)
+	}
+	return &manifest{file: string(f)}, nil
+}
+
+// parseManifestLine splits a line of a manifest into the runfiles path and
+// the path of the file it refers to.
+func parseManifestLine(line string) (link, target string) {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.HasPrefix(line, " ") {
+		// In lines that start with a space, spaces, newlines, and backslashes are escaped as \s, \n, and \b in
+		// link and newlines and backslashes are escaped in target.
+		link, target, _ = strings.Cut(line[1:], " ")
+		link = strings.ReplaceAll(link, `\s`, " ")
+		link = strings.ReplaceAll(link, `\n`, "\n")
+		link = strings.ReplaceAll(link, `\b`, `\`)
+		target = strings.ReplaceAll(target, `\n`, "\n")
+		target = strings.ReplaceAll(target, `\b`, `\`)
+		return link, target
+	}
+	link, target, _ = strings.Cut(line, " ")
+	return link, target
 }
 
-func (f ManifestFile) parse() (manifest, error) {
-	r, err := os.Open(string(f))
+func (m *manifest) path(s string) (string, error) {
+	target, ok, err := m.resolve(s)
 	if err != nil {
-		return manifest{}, fmt.Errorf("runfiles: can’t open manifest file: %w", err)
-	}
-	defer r.Close()
-
-	s := bufio.NewScanner(r)
-	m := manifest{make(map[string]string),  nil}
-	for s.Scan() {
-		line := s.Text()
-		var link, target string
-		if strings.HasPrefix(line, " ") {
-			// In lines that start with a space, spaces, newlines, and backslashes are escaped as \s, \n, and \b in
-			// link and newlines and backslashes are escaped in target.
-			fields := strings.SplitN(s.Text()[1:], " ", 2)
-			link = fields[0]
-			target = fields[1]
-			link = strings.ReplaceAll(link, `\s`, " ")
-			link = strings.ReplaceAll(link, `\n`, "\n")
-			link = strings.ReplaceAll(link, `\b`, `\`)
-			target = strings.ReplaceAll(target, `\n`, "\n")
-			target = strings.ReplaceAll(target, `\b`, `\`)
+		return "", err
+	}
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	if target == "" {
+		return "", ErrEmpty
+	}
+	return target, nil
+}
+
+// resolve looks up s by binary search in the manifest file, or in the index
+// once it has been loaded. The index is only loaded if s is not found and the
+// file is not sorted.
+func (m *manifest) resolve(s string) (string, bool, error) {
+	if atomic.LoadUint32(&m.indexed) == 0 {
+		r, err := openManifestFile(m.file)
+		if err != nil {
+			return "", false, err
+		}
+		target, ok, err := resolveManifestPath(s, r.search)
+		r.f.Close()
+		if ok || err != nil {
+			return target, ok, err
+		}
+		if sorted, err := m.isSorted(); err != nil || sorted {
+			return "", false, err
+		}
+	}
+	index, err := m.loadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	return resolveManifestPath(s, index.lookup)
+}
+
+// isSorted reports whether the lines of the manifest file are sorted by
+// runfiles path, which is checked once by reading through the file.
+func (m *manifest) isSorted() (bool, error) {
+	m.sortedOnce.Do(func() {
+		f, err := os.Open(m.file)
+		if err != nil {
+			m.sortedErr = fmt.Errorf("runfiles: can’t open manifest file: %w", err)
+			return
+		}
+		defer f.Close()
+		m.sorted = true
+		r := bufio.NewReader(f)
+		var prevLink string
+		for {
+			line, err := r.ReadString('\n')
+			if line = strings.TrimSuffix(line, "\n"); strings.TrimSuffix(line, "\r") != "" {
+				link, _ := parseManifestLine(line)
+				if link < prevLink {
+					m.sorted = false
+					return
+				}
+				prevLink = link
+			}
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				m.sortedErr = fmt.Errorf("runfiles: error reading manifest file %s: %w", m.file, err)
+				return
+			}
+		}
+	})
+	return m.sorted, m.sortedErr
+}
+
+// resolveManifestPath looks up s with lookup. If s is not listed, but lies
+// under a directory that itself is a runfile, only the directory is listed in
+// the manifest, so all prefixes of s are looked up as well.
+func resolveManifestPath(s string, lookup func(link string) (string, bool, error)) (string, bool, error) {
+	target, ok, err := lookup(s)
+	if ok || err != nil {
+		return filepath.FromSlash(target), ok, err
+	}
+	for prefix := path.Dir(s); prefix != "."; prefix = path.Dir(prefix) {
+		prefixMatch, ok, err := lookup(prefix)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return filepath.FromSlash(prefixMatch + strings.TrimPrefix(s, prefix)), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// openManifestFile opens the manifest file for lookups with search. The
+// caller has to close r.f.
+func openManifestFile(file string) (*manifestFileReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("runfiles: can’t open manifest file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &manifestFileReader{f, info.Size(), make([]byte, 4096)}, nil
+}
+
+// search looks up link by binary search in the manifest file, assuming that
+// its lines are sorted by runfiles path.
+func (r *manifestFileReader) search(link string) (string, bool, error) {
+	// lo and hi are offsets of line starts (or the end of the file) such that
+	// all lines before lo sort before link and all lines from hi on do not.
+	lo, hi := int64(0), r.size
+	for lo < hi {
+		mid, err := r.nextLineStart(lo + (hi-lo)/2)
+		if err != nil {
+			return "", false, err
+		}
+		if mid >= hi {
+			mid = lo
+		}
+		line, next, err := r.lineAt(mid)
+		if err != nil {
+			return "", false, err
+		}
+		if l, _ := parseManifestLine(line); l < link {
+			lo = next
 		} else {
-			fields := strings.SplitN(line, " ", 2)
-			link = fields[0]
-			target = fields[1]
+			hi = mid
+		}
+	}
+	if lo >= r.size {
+		return "", false, nil
+	}
+	line, _, err := r.lineAt(lo)
+	if err != nil {
+		return "", false, err
+	}
+	l, target := parseManifestLine(line)
+	return target, l == link, nil
+}
+
+type manifestFileReader struct {
+	f    *os.File
+	size int64
+	buf  []byte
+}
+
+// lineAt returns the line starting at off, without the newline, and the
+// offset of the next line.
+func (r *manifestFileReader) lineAt(off int64) (string, int64, error) {
+	var line []byte
+	for {
+		n, err := r.f.ReadAt(r.buf, off+int64(len(line)))
+		if i := bytes.IndexByte(r.buf[:n], '\n'); i >= 0 {
+			line = append(line, r.buf[:i]...)
+			return string(line), off + int64(len(line)) + 1, nil
+		}
+		line = append(line, r.buf[:n]...)
+		if err == io.EOF {
+			return string(line), r.size, nil
+		} else if err != nil {
+			return "", 0, err
 		}
-		m.index[link] = filepath.FromSlash(target)
 	}
+}
 
-	if err := s.Err(); err != nil {
-		return manifest{}, fmt.Errorf("runfiles: error parsing manifest file %s: %w", f, err)
+// nextLineStart returns the offset of the first line that starts at or after
+// off.
+func (r *manifestFileReader) nextLineStart(off int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
 	}
+	_, next, err := r.lineAt(off - 1)
+	return next, err
+}
 
-	return m, nil
+func (m *manifest) loadIndex() (*manifestIndex, error) {
+	m.indexOnce.Do(func() {
+		m.index, m.indexErr = readManifestIndex(m.file)
+		atomic.StoreUint32(&m.indexed, 1)
+	})
+	return m.index, m.indexErr
 }
 
-func (m *manifest) path(s string) (string, error) {
-	r, ok := m.index[s]
-	if ok && r == "" {
-		return "", ErrEmpty
+// manifestIndex holds the contents of a manifest file and the offsets of its
+// lines sorted by runfiles path. Since all runfiles paths with a common prefix
+// are adjacent in this order, it also serves to list directories.
+type manifestIndex struct {
+	data  string
+	lines []int
+}
+
+func readManifestIndex(file string) (*manifestIndex, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("runfiles: can’t open manifest file: %w", err)
+	}
+	defer f.Close()
+	var data strings.Builder
+	if info, err := f.Stat(); err == nil {
+		data.Grow(int(info.Size()))
 	}
-	if ok {
-		return r, nil
+	if _, err := io.Copy(&data, f); err != nil {
+		return nil, fmt.Errorf("runfiles: error reading manifest file %s: %w", file, err)
 	}
 
-	// If path references a runfile that lies under a directory that itself is a
-	// runfile, then only the directory is listed in the manifest. Look up all
-	// prefixes of path in the manifest.
-	for prefix := s; prefix != ""; prefix, _ = path.Split(prefix) {
-		prefix = strings.TrimSuffix(prefix, "/")
-		if prefixMatch, ok := m.index[prefix]; ok {
-			return prefixMatch + filepath.FromSlash(strings.TrimPrefix(s, prefix)), nil
+	index := &manifestIndex{data: data.String()}
+	sorted := true
+	var prevLink string
+	for start := 0; start < len(index.data); {
+		end := strings.IndexByte(index.data[start:], '\n')
+		if end < 0 {
+			end = len(index.data)
+		} else {
+			end += start
+		}
+		if line := strings.TrimSuffix(index.data[start:end], "\r"); line != "" {
+			index.lines = append(index.lines, start)
+			link, _ := parseManifestLine(line)
+			if link < prevLink {
+				sorted = false
+			}
+			prevLink = link
 		}
+		start = end + 1
+	}
+	if !sorted {
+		sort.SliceStable(index.lines, func(i, j int) bool {
+			return index.link(i) < index.link(j)
+		})
 	}
+	return index, nil
+}
 
-	return "", os.ErrNotExist
+func (x *manifestIndex) entry(i int) (link, target string) {
+	line := x.data[x.lines[i]:]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	return parseManifestLine(line)
+}
+
+func (x *manifestIndex) link(i int) string {
+	link, _ := x.entry(i)
+	return link
+}
+
+// search returns the index of the first line whose runfiles path does not
+// sort before link.
+func (x *manifestIndex) search(link string) int {
+	return sort.Search(len(x.lines), func(i int) bool {
+		return x.link(i) >= link
+	})
+}
+
+func (x *manifestIndex) lookup(link string) (string, bool, error) {
+	i := x.search(link)
+	if i == len(x.lines) {
+		return "", false, nil
+	}
+	l, target := x.entry(i)
+	return target, l == link, nil
+}
+
+// dirEntries returns the entries of the directory dir, which is "." for the
+// root directory, or nil if no runfiles path lies under it.
+func (x *manifestIndex) dirEntries(dir string) []manifestDirEntry {
+	prefix := ""
+	if dir != "." {
+		prefix = dir + "/"
+	}
+	var entries []manifestDirEntry
+	seen := make(map[string]bool)
+	for i := x.search(prefix); i < len(x.lines); {
+		link, target := x.entry(i)
+		if !strings.HasPrefix(link, prefix) {
+			break
+		}
+		name, _, isDir := strings.Cut(link[len(prefix):], "/")
+		if isDir {
+			// The entry corresponds to a directory that is a prefix of some
+			// manifest entries. Skip all of them, which sort before the
+			// character after "/".
+			i = x.search(prefix + name + "0")
+		} else {
+			i++
+		}
+		if !seen[name] {
+			seen[name] = true
+			entries = append(entries, manifestDirEntry{name, filepath.FromSlash(target), isDir})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	return entries
 }
 
 func (m *manifest) open(name string) (fs.File, error) {
@@ -147,53 +430,24 @@ func (m *manifest) open(name string) (fs.File, error) {
 			return nil, err
 		}
 		// err == os.ErrNotExist, but name may still refer to a directory that
-		// is a prefix of some manifest entry. We fall back to a trie lookup.
-	}
-
-	// At this point the file is not directly listed in the manifest (or
-	// contained in a directory that is). We lazily build a trie to allow
-	// efficient listing of the contents of intermediate directories.
-	if m.trie == nil {
-		m.trie = make(map[string]trie)
-		for k := range m.index {
-			segments := strings.Split(k, "/")
-			current := m.trie
-			for _, s := range segments {
-				if current[s] == nil {
-					current[s] = make(map[string]trie)
-				}
-				current = current[s]
-			}
-		}
+		// is a prefix of some manifest entry.
 	}
 
-	dir := m.trie
-	if name != "." {
-		segments := strings.Split(name, "/")
-		for _, s := range segments {
-			if dir == nil {
-				break
-			}
-			dir = dir[s]
-		}
-		if dir == nil {
-			return nil, os.ErrNotExist
-		}
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
 	}
-
-	entries := make([]manifestDirEntry, 0, len(dir))
-	for e := range dir {
-		entries = append(entries, manifestDirEntry{e, m.index[path.Join(name, e)]})
+	entries := index.dirEntries(name)
+	if entries == nil && name != "." {
+		return nil, os.ErrNotExist
 	}
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].name < entries[j].name
-	})
 	return &manifestReadDirFile{dirFile(path.Base(name)), entries}, nil
 }
 
 type manifestDirEntry struct {
-	name string
-	path string
+	name  string
+	path  string
+	isDir bool
 }
 
 type manifestReadDirFile struct {
@@ -214,10 +468,13 @@ func (m *manifestReadDirFile) ReadDir(n int) ([]fs.DirEntry, error) {
 	dirEntries := make([]fs.DirEntry, 0, len(entries))
 	for _, e := range entries {
 		var info fs.FileInfo
-		if e.path == "" {
+		if e.isDir {
 			// The entry corresponds to a directory that is a prefix of some
 			// manifest entry. We represent it as a read-only directory.
 			info = dirFileInfo(e.name)
+		} else if e.path == "" {
+			// The entry corresponds to an empty file.
+			info = emptyFileInfo(e.name)
 		} else {
 			// The entry corresponds to a real file in the manifest. The
 			// basename of the entry may differ from the basename of the path
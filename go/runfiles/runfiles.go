@@ -42,6 +42,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -65,7 +66,7 @@ type Runfiles struct {
 	// immutable once created.
 	impl        runfiles
 	env         []string
-	repoMapping map[repoMappingKey]string
+	repoMapping *repoMapping
 	sourceRepo  string
 }
 
@@ -157,8 +158,7 @@ func (r *Runfiles) Rlocation(path string) (string, error) {
 	mappedPath := path
 	split := strings.SplitN(path, "/", 2)
 	if len(split) == 2 {
-		key := repoMappingKey{r.sourceRepo, split[0]}
-		if targetRepoDirectory, exists := r.repoMapping[key]; exists {
+		if targetRepoDirectory, exists := r.repoMapping.lookup(r.sourceRepo, split[0]); exists {
 			mappedPath = targetRepoDirectory + "/" + split[1]
 		}
 	}
@@ -277,8 +277,101 @@ type runfiles interface {
 // https://cs.opensource.google/bazel/bazel/+/1b073ac0a719a09c9b2d1a52680517ab22dc971e:src/main/java/com/google/devtools/build/lib/analysis/Runfiles.java;l=424
 const repoMappingRlocation = "_repo_mapping"
 
+// repoMapping is a parsed repository mapping manifest.
+type repoMapping struct {
+	// exact holds the entries for a single source repo.
+	exact map[repoMappingKey]string
+	// prefixes holds the entries for all source repos whose canonical name
+	// starts with a given prefix, sorted by prefix. Bazel emits these entries
+	// for the repos generated by a module extension, which all have the same
+	// mapping, to keep the manifest small.
+	prefixes []repoMappingPrefix
+}
+
+type repoMappingPrefix struct {
+	sourceRepoPrefix string
+	// targets maps apparent repo names to target repo runfiles directories.
+	targets map[string]string
+}
+
+// lookup returns the runfiles directory of the repo with the given apparent
+// name as seen from sourceRepo. Exact entries take precedence over prefix
+// entries, and longer prefixes take precedence over shorter ones.
+func (m *repoMapping) lookup(sourceRepo, targetRepoApparentName string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	if target, ok := m.exact[repoMappingKey{sourceRepo, targetRepoApparentName}]; ok {
+		return target, true
+	}
+	var target string
+	var found bool
+	m.forEachPrefix(sourceRepo, func(p *repoMappingPrefix) bool {
+		target, found = p.targets[targetRepoApparentName]
+		return !found
+	})
+	return target, found
+}
+
+// visibleRepos returns the runfiles directories of all repos visible to
+// sourceRepo, keyed by their apparent names.
+func (m *repoMapping) visibleRepos(sourceRepo string) map[string]string {
+	visible := make(map[string]string)
+	if m == nil {
+		return visible
+	}
+	var matching []*repoMappingPrefix
+	m.forEachPrefix(sourceRepo, func(p *repoMappingPrefix) bool {
+		matching = append(matching, p)
+		return true
+	})
+	// Visit the shortest prefix first so that more specific entries win.
+	for i := len(matching) - 1; i >= 0; i-- {
+		for apparent, target := range matching[i].targets {
+			visible[apparent] = target
+		}
+	}
+	for k, target := range m.exact {
+		if k.sourceRepo == sourceRepo {
+			visible[k.targetRepoApparentName] = target
+		}
+	}
+	return visible
+}
+
+// forEachPrefix calls f for each prefix entry that matches sourceRepo, from
+// the longest prefix to the shortest, until f returns false.
+func (m *repoMapping) forEachPrefix(sourceRepo string, f func(*repoMappingPrefix) bool) {
+	// Every prefix of s sorts before or equal to s, so the last entry that
+	// does is the only candidate of its length or longer. If it is not a
+	// prefix of s, all matching prefixes are also prefixes of the part of s
+	// it shares, so the search continues with that.
+	s := sourceRepo
+	for {
+		i := sort.Search(len(m.prefixes), func(i int) bool {
+			return m.prefixes[i].sourceRepoPrefix > s
+		}) - 1
+		if i < 0 {
+			return
+		}
+		p := &m.prefixes[i]
+		if strings.HasPrefix(s, p.sourceRepoPrefix) {
+			if !f(p) || p.sourceRepoPrefix == "" {
+				return
+			}
+			s = p.sourceRepoPrefix[:len(p.sourceRepoPrefix)-1]
+		} else {
+			n := 0
+			for n < len(s) && n < len(p.sourceRepoPrefix) && s[n] == p.sourceRepoPrefix[n] {
+				n++
+			}
+			s = s[:n]
+		}
+	}
+}
+
 // Parses a repository mapping manifest file emitted with Bzlmod enabled.
-func parseRepoMapping(path string) (map[repoMappingKey]string, error) {
+func parseRepoMapping(path string) (*repoMapping, error) {
 	r, err := os.Open(path)
 	if err != nil {
 		// The repo mapping manifest only exists with Bzlmod, so it's not an
@@ -292,19 +385,37 @@ func parseRepoMapping(path string) (map[repoMappingKey]string, error) {
 	// Each line of the repository mapping manifest has the form:
 	// canonical name of source repo,apparent name of target repo,target repo runfiles directory
 	// https://cs.opensource.google/bazel/bazel/+/1b073ac0a719a09c9b2d1a52680517ab22dc971e:src/main/java/com/google/devtools/build/lib/analysis/RepoMappingManifestAction.java;l=117
+	// In the compact format, the canonical name of the source repo may end
+	// with "*", in which case the line applies to all source repos whose
+	// canonical name starts with the part before it.
 	s := bufio.NewScanner(r)
-	repoMapping := make(map[repoMappingKey]string)
+	m := &repoMapping{exact: make(map[repoMappingKey]string)}
+	prefixes := make(map[string]map[string]string)
 	for s.Scan() {
 		fields := strings.SplitN(s.Text(), ",", 3)
 		if len(fields) != 3 {
 			return nil, fmt.Errorf("runfiles: bad repo mapping line %q in file %s", s.Text(), path)
 		}
-		repoMapping[repoMappingKey{fields[0], fields[1]}] = fields[2]
+		if strings.HasSuffix(fields[0], "*") {
+			prefix := strings.TrimSuffix(fields[0], "*")
+			if prefixes[prefix] == nil {
+				prefixes[prefix] = make(map[string]string)
+			}
+			prefixes[prefix][fields[1]] = fields[2]
+		} else {
+			m.exact[repoMappingKey{fields[0], fields[1]}] = fields[2]
+		}
 	}
 
 	if err = s.Err(); err != nil {
 		return nil, fmt.Errorf("runfiles: error parsing repo mapping file %s: %w", path, err)
 	}
 
-	return repoMapping, nil
+	for prefix, targets := range prefixes {
+		m.prefixes = append(m.prefixes, repoMappingPrefix{prefix, targets})
+	}
+	sort.Slice(m.prefixes, func(i, j int) bool {
+		return m.prefixes[i].sourceRepoPrefix < m.prefixes[j].sourceRepoPrefix
+	})
+	return m, nil
 }
@@ -42,6 +42,7 @@ func main() {
 	case "compilepkg": action = compilePkg
 	case "nogo": action = nogo
 	case "nogovalidation": action = nogoValidation
+	case "nogostdlib": action = nogoStdlib
 	case "filterbuildid":
 		action = filterBuildID
 	case "gentestmain":
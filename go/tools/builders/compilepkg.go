@@ -43,6 +43,7 @@ func compilePkg(args []string) error {
 	var testFilter string
 	var gcFlags, asmFlags, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags quoteMultiFlag
 	var coverFormat string
+	var coverNative bool
 	var pgoprofile string
 	fs.Var(&unfilteredSrcs, "src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and compiled")
 	fs.Var(&coverSrcs, "cover", ".go file that should be instrumented for coverage (must also be a -src)")
@@ -65,9 +66,10 @@ func compilePkg(args []string) error {
 	fs.StringVar(&outLinkobjPath, "lo", "", "The full output archive file required by the linker")
 	fs.StringVar(&outInterfacePath, "o", "", "The export-only output archive required to compile dependent packages")
 	fs.StringVar(&cgoExportHPath, "cgoexport", "", "The _cgo_exports.h file to write")
-	fs.StringVar(&cgoGoSrcsPath, "cgo_go_srcs", "", "The directory to emit cgo-generated Go sources for nogo consumption to")
+	fs.StringVar(&cgoGoSrcsPath, "cgo_go_srcs", "", "The directory to emit cgo-generated Go sources for nogo and the packages driver to")
 	fs.StringVar(&testFilter, "testfilter", "off", "Controls test package filtering")
 	fs.StringVar(&coverFormat, "cover_format", "", "Emit source file paths in coverage instrumentation suitable for the specified coverage format")
+	fs.BoolVar(&coverNative, "cover_native", false, "Instrument for coverage with the compiler's coverage support (GOCOVERDIR) instead of coverdata")
 	fs.Var(&recompileInternalDeps, "recompile_internal_deps", "The import path of the direct dependencies that needs to be recompiled.")
 	fs.StringVar(&pgoprofile, "pgoprofile", "", "The pprof profile to consider for profile guided optimization.")
 	if err := fs.Parse(args); err != nil {
@@ -130,6 +132,7 @@ func compilePkg(args []string) error {
 		cgoExportHPath,
 		cgoGoSrcsPath,
 		coverFormat,
+		coverNative,
 		recompileInternalDeps,
 		pgoprofile)
 }
@@ -161,6 +164,7 @@ func compileArchive(
 	cgoExportHPath string,
 	cgoGoSrcsForNogoPath string,
 	coverFormat string,
+	coverNative bool,
 	recompileInternalDeps []string,
 	pgoprofile string,
 ) error {
@@ -244,7 +248,12 @@ func compileArchive(
 	cgoSrcsNogo := append([]string{}, cgoSrcs...)
 
 	// Instrument source files for coverage.
-	if coverMode != "" {
+	if coverMode != "" && coverNative {
+		goSrcs, cgoSrcs, gcFlags, err = instrumentArchiveForNativeCoverage(goenv, importPath, packageName, goSrcs, cgoSrcs, cgoEnabled, coverMode, coverSrcs, coverFormat, gcFlags, workDir)
+		if err != nil {
+			return err
+		}
+	} else if coverMode != "" {
 		relCoverPath := make(map[string]string)
 		for _, s := range coverSrcs {
 			relCoverPath[abs(s)] = s
@@ -308,7 +317,8 @@ func compileArchive(
 			}
 			// Also run cgo on original source files, not coverage instrumented, if using nogo.
 			// The compilation outputs are only used to run cgo, but the generated sources are
-			// passed to the separate nogo action via cgoGoSrcsForNogoPath.
+			// passed to the separate nogo action and the packages driver via cgoGoSrcsForNogoPath.
+			// Without nogo, cgoGoSrcsForNogoPath is not set in coverage builds.
 			_, _, _, err = cgo2(goenv, goSrcsNogo, cgoSrcsNogo, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs, packagePath, packageName, cc, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags, "", cgoGoSrcsForNogoPath)
 			if err != nil {
 				return err
@@ -331,7 +341,7 @@ func compileArchive(
 		gcFlags = append(gcFlags, createTrimPath(gcFlags, "."))
 	}
 
-	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, workDir)
+	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, coverNative, workDir)
 	if err != nil {
 		return err
 	}
@@ -436,7 +446,65 @@ func compileArchive(
 	return nil
 }
 
-func checkImportsAndBuildCfg(goenv *env, importPath string, srcs archiveSrcs, deps []archive, packageListPath string, recompileInternalDeps []string, compilingWithCgo bool, coverMode string, workDir string) (string, error) {
+// instrumentArchiveForNativeCoverage instruments the files among goSrcs and
+// cgoSrcs that are listed in coverSrcs with instrumentPackageForNativeCoverage.
+// It returns goSrcs and cgoSrcs with the instrumented files replacing the
+// original ones and the compiler flags needed to compile them.
+func instrumentArchiveForNativeCoverage(goenv *env, importPath, packageName string, goSrcs, cgoSrcs []string, cgoEnabled bool, coverMode string, coverSrcs []string, coverFormat string, gcFlags []string, workDir string) ([]string, []string, []string, error) {
+	relCoverPath := make(map[string]string)
+	for _, s := range coverSrcs {
+		relCoverPath[abs(s)] = s
+	}
+
+	var local bool
+	switch coverFormat {
+	case "go_cover":
+		// Files are reported as <importpath>/<basename>.
+		local = false
+	case "lcov":
+		// Bazel merges lcov reports across languages and thus assumes
+		// that the source file paths are relative to the exec root.
+		local = true
+	default:
+		return nil, nil, nil, fmt.Errorf("invalid value for -cover_format: %q", coverFormat)
+	}
+
+	combined := append([]string{}, goSrcs...)
+	if cgoEnabled {
+		combined = append(combined, cgoSrcs...)
+	}
+	var indices []int
+	var srcNames []string
+	for i, origSrc := range combined {
+		if relPath, ok := relCoverPath[origSrc]; ok {
+			indices = append(indices, i)
+			srcNames = append(srcNames, relPath)
+		}
+	}
+	if len(srcNames) == 0 {
+		return goSrcs, cgoSrcs, gcFlags, nil
+	}
+
+	coverVar := fmt.Sprintf("Cover_%s_", sanitizePathForIdentifier(importPath))
+	coverVar = strings.ReplaceAll(coverVar, "_", "Z")
+	coverOutSrcs, coverVarsSrc, coverCfg, err := instrumentPackageForNativeCoverage(goenv, srcNames, importPath, packageName, coverVar, coverMode, local, workDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for j, i := range indices {
+		if i < len(goSrcs) {
+			goSrcs[i] = coverOutSrcs[j]
+		} else {
+			cgoSrcs[i-len(goSrcs)] = coverOutSrcs[j]
+		}
+	}
+	goSrcs = append(goSrcs, coverVarsSrc)
+	// The file declaring the coverage variables has no line directives.
+	gcFlags = append(gcFlags, "-coveragecfg="+coverCfg, createTrimPath(gcFlags, workDir))
+	return goSrcs, cgoSrcs, gcFlags, nil
+}
+
+func checkImportsAndBuildCfg(goenv *env, importPath string, srcs archiveSrcs, deps []archive, packageListPath string, recompileInternalDeps []string, compilingWithCgo bool, coverMode string, coverNative bool, workDir string) (string, error) {
 	// Check that the filtered sources don't import anything outside of
 	// the standard library and the direct dependencies.
 	imports, err := checkImports(srcs.goSrcs, deps, packageListPath, importPath, recompileInternalDeps)
@@ -449,7 +517,16 @@ func checkImportsAndBuildCfg(goenv *env, importPath string, srcs archiveSrcs, de
 		imports["syscall"] = nil
 		imports["unsafe"] = nil
 	}
-	if coverMode != "" {
+	if coverMode != "" && coverNative {
+		if coverMode == "atomic" {
+			imports["sync/atomic"] = nil
+		}
+		// The instrumented files of main packages import runtime/coverage,
+		// which writes the coverage data when the program exits.
+		if len(srcs.goSrcs) > 0 && srcs.goSrcs[0].pkg == "main" {
+			imports["runtime/coverage"] = nil
+		}
+	} else if coverMode != "" {
 		if coverMode == "atomic" {
 			imports["sync/atomic"] = nil
 		}
@@ -16,12 +16,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"go/parser"
 	"go/token"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // instrumentForCoverage runs "go tool cover" on a source file to produce
@@ -108,3 +111,91 @@ func init() {
 	}
 	return nil
 }
+
+// coverPkgConfig is the configuration passed to "go tool cover -pkgcfg". It
+// mirrors CoverPkgConfig in cmd/internal/cov/covcmd.
+type coverPkgConfig struct {
+	OutConfig    string
+	PkgPath      string
+	PkgName      string
+	Granularity  string
+	ModulePath   string
+	Local        bool
+	EmitMetaFile string
+}
+
+// instrumentPackageForNativeCoverage runs "go tool cover -pkgcfg" on the
+// source files of a package that should be instrumented, the way "go build
+// -cover" does since Go 1.20. Unlike instrumentForCoverage, the instrumented
+// files don't depend on coverdata: the compiler registers the coverage
+// meta-data with the runtime, which writes counter data to GOCOVERDIR.
+//
+// srcNames are the names of the files as they should appear in coverage
+// reports, relative to the current directory. If local is true, the names
+// are recorded as given. Otherwise, they are recorded relative to importPath.
+//
+// instrumentPackageForNativeCoverage returns the instrumented files, which
+// replace srcNames, an extra file declaring the coverage variables, which
+// must be compiled into the package, and the configuration file to pass
+// to the compiler with -coveragecfg.
+func instrumentPackageForNativeCoverage(goenv *env, srcNames []string, importPath, packageName, coverVar, mode string, local bool, workDir string) (coverSrcs []string, coverVarsSrc, coverCfg string, err error) {
+	coverCfg = filepath.Join(workDir, "coveragecfg")
+	pkgcfg, err := json.Marshal(coverPkgConfig{
+		OutConfig:   coverCfg,
+		PkgPath:     importPath,
+		PkgName:     packageName,
+		Granularity: "perblock",
+		Local:       local,
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	pkgcfgPath := filepath.Join(workDir, "pkgcfg.txt")
+	if err := os.WriteFile(pkgcfgPath, pkgcfg, 0o666); err != nil {
+		return nil, "", "", err
+	}
+
+	// The first output holds the coverage variables, followed by one output
+	// per input file.
+	coverVarsSrc = filepath.Join(workDir, "covervars.go")
+	outputs := []string{coverVarsSrc}
+	for i := range srcNames {
+		coverSrcs = append(coverSrcs, filepath.Join(workDir, fmt.Sprintf("cover_%d.go", i)))
+	}
+	outputs = append(outputs, coverSrcs...)
+	outfilelistPath := filepath.Join(workDir, "coveroutfiles.txt")
+	if err := os.WriteFile(outfilelistPath, []byte(strings.Join(outputs, "\n")+"\n"), 0o666); err != nil {
+		return nil, "", "", err
+	}
+
+	goargs := goenv.goTool("cover", "-pkgcfg", pkgcfgPath, "-mode", mode, "-var", coverVar, "-outfilelist", outfilelistPath)
+	goargs = append(goargs, srcNames...)
+	if err := goenv.runCommand(goargs); err != nil {
+		return nil, "", "", err
+	}
+
+	// The compiler resolves relative paths in line directives relative to
+	// the directory of the instrumented file. Point them back to the
+	// original files, so that positions are the same as without coverage.
+	for i, coverSrc := range coverSrcs {
+		if err := absLineDirective(coverSrc, srcNames[i]); err != nil {
+			return nil, "", "", err
+		}
+	}
+	return coverSrcs, coverVarsSrc, coverCfg, nil
+}
+
+// absLineDirective replaces the line directive "go tool cover" writes at the
+// top of coverSrc for srcName with one using the absolute path of srcName.
+func absLineDirective(coverSrc, srcName string) error {
+	src, err := os.ReadFile(coverSrc)
+	if err != nil {
+		return err
+	}
+	directive := []byte(fmt.Sprintf("//line %s:1:1\n", srcName))
+	if !bytes.HasPrefix(src, directive) {
+		return nil
+	}
+	src = append([]byte(fmt.Sprintf("//line %s:1:1\n", abs(srcName))), src[len(directive):]...)
+	return os.WriteFile(coverSrc, src, 0o666)
+}
@@ -128,3 +128,42 @@ func TestRegisterCoverage(t *testing.T) {
 		}
 	}
 }
+
+func TestAbsLineDirective(t *testing.T) {
+	var filename = filepath.Join(t.TempDir(), "cover_0.go")
+	for _, test := range []struct {
+		name, in, out string
+	}{
+		{
+			name: "relative",
+			in:   "//line pkg/lib.go:1:1\npackage lib\n",
+			out:  "//line " + abs("pkg/lib.go") + ":1:1\npackage lib\n",
+		},
+		{
+			name: "other file",
+			in:   "//line pkg/other.go:1:1\npackage lib\n",
+			out:  "//line pkg/other.go:1:1\npackage lib\n",
+		},
+		{
+			name: "no directive",
+			in:   "package lib\n",
+			out:  "package lib\n",
+		},
+	} {
+		if err := os.WriteFile(filename, []byte(test.in), 0o666); err != nil {
+			t.Fatalf("writing input file: %v", err)
+		}
+		if err := absLineDirective(filename, "pkg/lib.go"); err != nil {
+			t.Errorf("%q: %+v", test.name, err)
+			continue
+		}
+		coverSrc, err := os.ReadFile(filename)
+		if err != nil {
+			t.Errorf("%q: %+v", test.name, err)
+			continue
+		}
+		if got, want := string(coverSrc), test.out; got != want {
+			t.Errorf("%q: got %q, want %q", test.name, got, want)
+		}
+	}
+}
@@ -80,12 +80,71 @@ var configs = map[string]config{
 			{{printf "regexp.MustCompile(%q)" $path}},
 			{{- end}}
 		},
+		{{- end -}}
+		{{- if $config.OnlyLabels}}
+		onlyLabels: []labelPattern{
+			{{- range $pattern, $comment := $config.OnlyLabels}}
+			{{- if $comment}}
+			// {{$comment}}
+			{{end -}}
+			{{printf "mustParseLabelPattern(%q)" $pattern}},
+			{{- end}}
+		},
+		{{- end -}}
+		{{- if $config.ExcludeLabels}}
+		excludeLabels: []labelPattern{
+			{{- range $pattern, $comment := $config.ExcludeLabels}}
+			{{- if $comment}}
+			// {{$comment}}
+			{{end -}}
+			{{printf "mustParseLabelPattern(%q)" $pattern}},
+			{{- end}}
+		},
+		{{- end -}}
+		{{- if $config.OnlyTags}}
+		onlyTags: []string{
+			{{- range $tag, $comment := $config.OnlyTags}}
+			{{- if $comment}}
+			// {{$comment}}
+			{{end -}}
+			{{printf "%q" $tag}},
+			{{- end}}
+		},
+		{{- end -}}
+		{{- if $config.ExcludeTags}}
+		excludeTags: []string{
+			{{- range $tag, $comment := $config.ExcludeTags}}
+			{{- if $comment}}
+			// {{$comment}}
+			{{end -}}
+			{{printf "%q" $tag}},
+			{{- end}}
+		},
+		{{- end -}}
+		{{- if $config.Severity}}
+		severity: {{printf "%q" $config.Severity}},
 		{{- end}}
 	},
 {{- end}}
 }
 
+// baseline maps the fingerprints of pre-existing diagnostics to the number of
+// times they may occur without being reported.
+var baseline = map[string]int{
+{{- range $fingerprint, $count := .Baseline}}
+	{{printf "%q" $fingerprint}}: {{$count}},
+{{- end}}
+}
+
 const debugMode = {{ .Debug }}
+
+func main() {
+{{- if .Standalone}}
+	standaloneMain()
+{{- else}}
+	nogoMain()
+{{- end}}
+}
 `
 
 func genNogoMain(args []string) error {
@@ -95,6 +154,9 @@ func genNogoMain(args []string) error {
 	flags.Var(&analyzerImportPaths, "analyzer_importpath", "import path of an analyzer library")
 	configFile := flags.String("config", "", "nogo config file")
 	debug := flags.Bool("debug", false, "enable debug mode")
+	baselineFile := flags.String("baseline", "", "nogo baseline file")
+	bzlmod := flags.Bool("bzlmod", false, "labels are formatted with canonical repository names")
+	standalone := flags.Bool("standalone", false, "generate the standalone driver, which loads packages with go/packages, instead of the binary run by the builder")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -114,7 +176,11 @@ func genNogoMain(args []string) error {
 		}
 	}()
 
-	config, err := buildConfig(*configFile)
+	config, err := buildConfig(*configFile, *bzlmod)
+	if err != nil {
+		return err
+	}
+	baseline, err := buildBaseline(*baselineFile)
 	if err != nil {
 		return err
 	}
@@ -137,12 +203,16 @@ func genNogoMain(args []string) error {
 	data := struct {
 		Imports    []Import
 		Configs    Configs
+		Baseline   map[string]int
 		NeedRegexp bool
 		Debug      bool
+		Standalone bool
 	}{
-		Imports: imports,
-		Configs: config,
-		Debug:   *debug,
+		Imports:    imports,
+		Configs:    config,
+		Baseline:   baseline,
+		Debug:      *debug,
+		Standalone: *standalone,
 	}
 	for _, c := range config {
 		if len(c.OnlyFiles) > 0 || len(c.ExcludeFiles) > 0 {
@@ -158,7 +228,7 @@ func genNogoMain(args []string) error {
 	return cErr
 }
 
-func buildConfig(path string) (Configs, error) {
+func buildConfig(path string, bzlmod bool) (Configs, error) {
 	if path == "" {
 		return Configs{}, nil
 	}
@@ -181,11 +251,31 @@ func buildConfig(path string) (Configs, error) {
 				return Configs{}, fmt.Errorf("invalid pattern for analysis %q: %v", name, err)
 			}
 		}
+		for pattern := range config.OnlyLabels {
+			if err := checkLabelPattern(pattern, bzlmod); err != nil {
+				return Configs{}, fmt.Errorf("invalid label pattern for analysis %q: %v", name, err)
+			}
+		}
+		for pattern := range config.ExcludeLabels {
+			if err := checkLabelPattern(pattern, bzlmod); err != nil {
+				return Configs{}, fmt.Errorf("invalid label pattern for analysis %q: %v", name, err)
+			}
+		}
+		switch config.Severity {
+		case "", "error", "warning", "info":
+		default:
+			return Configs{}, fmt.Errorf("invalid severity for analysis %q: %q, must be one of \"error\", \"warning\" and \"info\"", name, config.Severity)
+		}
 		configs[name] = Config{
 			// Description is currently unused.
 			OnlyFiles:     config.OnlyFiles,
 			ExcludeFiles:  config.ExcludeFiles,
+			OnlyLabels:    config.OnlyLabels,
+			ExcludeLabels: config.ExcludeLabels,
+			OnlyTags:      config.OnlyTags,
+			ExcludeTags:   config.ExcludeTags,
 			AnalyzerFlags: config.AnalyzerFlags,
+			Severity:      config.Severity,
 		}
 	}
 	return configs, nil
@@ -197,5 +287,54 @@ type Config struct {
 	Description   string
 	OnlyFiles     map[string]string `json:"only_files"`
 	ExcludeFiles  map[string]string `json:"exclude_files"`
+	OnlyLabels    map[string]string `json:"only_labels"`
+	ExcludeLabels map[string]string `json:"exclude_labels"`
+	OnlyTags      map[string]string `json:"only_tags"`
+	ExcludeTags   map[string]string `json:"exclude_tags"`
 	AnalyzerFlags map[string]string `json:"analyzer_flags"`
+	Severity      string            `json:"severity"`
+}
+
+// buildBaseline reads a baseline file and returns the number of times each
+// fingerprint may occur.
+func buildBaseline(path string) (map[string]int, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %v", err)
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(b, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal baseline file: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, f := range baseline.Findings {
+		if f.Fingerprint == "" {
+			return nil, fmt.Errorf("baseline entry for %s in %s has no fingerprint", f.Analyzer, f.File)
+		}
+		count := f.Count
+		if count <= 0 {
+			count = 1
+		}
+		counts[f.Fingerprint] += count
+	}
+	return counts, nil
+}
+
+// Baseline is the format of the file generated by the nogo_baseline tool.
+// Only the fingerprint and count of each finding are used; the other fields
+// help humans review the baseline.
+type Baseline struct {
+	Findings []BaselineFinding `json:"findings"`
+}
+
+type BaselineFinding struct {
+	Fingerprint string `json:"fingerprint"`
+	Analyzer    string `json:"analyzer"`
+	File        string `json:"file"`
+	Function    string `json:"function"`
+	Message     string `json:"message"`
+	Count       int    `json:"count"`
 }
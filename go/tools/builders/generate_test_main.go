@@ -71,7 +71,17 @@ type Cases struct {
 	TestMain    string
 	CoverMode   string
 	CoverFormat string
+	CoverNative bool
+	// CoverGoTool is the runfiles path of the go command used to convert
+	// native coverage data.
+	CoverGoTool string
 	Pkgname     string
+	// ShardStrategy selects how tests are assigned to shards, see
+	// bzltestutil.ShardTests.
+	ShardStrategy string
+	// TestDurations holds the durations in seconds of tests for the
+	// "duration" shard strategy.
+	TestDurations map[string]float64
 }
 
 // Version returns whether v is a supported Go version (like "go1.18").
@@ -101,21 +111,24 @@ import (
 {{if .TestMain}}
 	"reflect"
 {{end}}
-	"strconv"
 	"strings"
 	"testing"
 	"testing/internal/testdeps"
 
 {{if ne .CoverMode ""}}
+{{if .CoverNative}}
+	"runtime/coverage"
+{{else}}
 	"github.com/bazelbuild/rules_go/go/tools/coverdata"
 {{end}}
+{{end}}
 
 {{range $p := .Imports}}
 	{{$p.Name}} "{{$p.Path}}"
 {{end}}
 )
 
-var allTests = []testing.InternalTest{
+var tests = []testing.InternalTest{
 {{range .Tests}}
 	{"{{.Name}}", {{.Package}}.{{.Name}} },
 {{end}}
@@ -141,27 +154,65 @@ var examples = []testing.InternalExample{
 {{end}}
 }
 
-func testsInShard() []testing.InternalTest {
-	totalShards, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
-	if err != nil || totalShards <= 1 {
-		return allTests
+var testDurations = map[string]float64{
+{{range $name, $seconds := .TestDurations}}
+	{{printf "%q" $name}}: {{$seconds}},
+{{end}}
+}
+
+// shardTests removes the tests, examples, fuzz targets and benchmarks that do
+// not run in the current shard if the test is sharded.
+func shardTests() {
+	var names []string
+	for _, t := range tests {
+		names = append(names, t.Name)
 	}
-	file, err := os.Create(os.Getenv("TEST_SHARD_STATUS_FILE"))
-	if err != nil {
-		log.Fatalf("Failed to touch TEST_SHARD_STATUS_FILE: %v", err)
+	for _, e := range examples {
+		names = append(names, e.Name)
+	}
+{{if .Version "go1.18"}}
+	for _, f := range fuzzTargets {
+		names = append(names, f.Name)
+	}
+{{end}}
+	for _, b := range benchmarks {
+		names = append(names, b.Name)
+	}
+	inShard := bzltestutil.ShardTests("{{.ShardStrategy}}", testDurations, names)
+	if inShard == nil {
+		return
+	}
+
+	var shardTests []testing.InternalTest
+	for _, t := range tests {
+		if inShard[t.Name] {
+			shardTests = append(shardTests, t)
+		}
+	}
+	tests = shardTests
+	var shardExamples []testing.InternalExample
+	for _, e := range examples {
+		if inShard[e.Name] {
+			shardExamples = append(shardExamples, e)
+		}
 	}
-	_ = file.Close()
-	shardIndex, err := strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
-	if err != nil || shardIndex < 0 {
-		return allTests
+	examples = shardExamples
+{{if .Version "go1.18"}}
+	var shardFuzzTargets []testing.InternalFuzzTarget
+	for _, f := range fuzzTargets {
+		if inShard[f.Name] {
+			shardFuzzTargets = append(shardFuzzTargets, f)
+		}
 	}
-	tests := []testing.InternalTest{}
-	for i, t := range allTests {
-		if i % totalShards == shardIndex {
-			tests = append(tests, t)
+	fuzzTargets = shardFuzzTargets
+{{end}}
+	var shardBenchmarks []testing.InternalBenchmark
+	for _, b := range benchmarks {
+		if inShard[b.Name] {
+			shardBenchmarks = append(shardBenchmarks, b)
 		}
 	}
-	return tests
+	benchmarks = shardBenchmarks
 }
 
 func main() {
@@ -177,16 +228,27 @@ func main() {
 		os.Exit(exitCode)
 	}
 
+{{if and (ne .CoverMode "") .CoverNative}}
+	// The coverage data of the test is written when the test exits and
+	// converted together with that of the binaries it runs.
+	bzltestutil.SetupGoCoverDir("{{.CoverFormat}}", "{{.CoverGoTool}}", func(dir string) error {
+		if err := coverage.WriteMetaDir(dir); err != nil {
+			return err
+		}
+		return coverage.WriteCountersDir(dir)
+	})
+{{end}}
+	shardTests()
 	testDeps :=
-  {{if eq .CoverFormat "lcov"}}
+  {{if or (eq .CoverFormat "lcov") .CoverNative}}
 		bzltestutil.LcovTestDeps{TestDeps: testdeps.TestDeps{}}
   {{else}}
 		testdeps.TestDeps{}
   {{end}}
   {{if .Version "go1.18"}}
-	m := testing.MainStart(testDeps, testsInShard(), benchmarks, fuzzTargets, examples)
+	m := testing.MainStart(testDeps, tests, benchmarks, fuzzTargets, examples)
   {{else}}
-	m := testing.MainStart(testDeps, testsInShard(), benchmarks, examples)
+	m := testing.MainStart(testDeps, tests, benchmarks, examples)
   {{end}}
 
 	if filter := os.Getenv("TESTBRIDGE_TEST_ONLY"); filter != "" {
@@ -212,13 +274,16 @@ func main() {
 	if failfast := os.Getenv("TESTBRIDGE_TEST_RUNNER_FAIL_FAST"); failfast != "" {
 		flag.Lookup("test.failfast").Value.Set("true")
 	}
-{{if eq .CoverFormat "lcov"}}
+
+	bzltestutil.SetupBenchmarks()
+	bzltestutil.SetupFuzzing("{{.Pkgname}}")
+{{if or (eq .CoverFormat "lcov") .CoverNative}}
 	panicOnExit0Flag := flag.Lookup("test.paniconexit0").Value
 	testDeps.OriginalPanicOnExit = panicOnExit0Flag.(flag.Getter).Get().(bool)
 	// Setting this flag provides a way to run hooks right before testing.M.Run() returns.
 	panicOnExit0Flag.Set("true")
 {{end}}
-{{if ne .CoverMode ""}}
+{{if and (ne .CoverMode "") (not .CoverNative)}}
 	if len(coverdata.Counters) > 0 {
 		testing.RegisterCover(testing.Cover{
 			Mode: "{{ .CoverMode }}",
@@ -266,7 +331,12 @@ func genTestMain(args []string) error {
 	out := flags.String("output", "", "output file to write. Defaults to stdout.")
 	coverMode := flags.String("cover_mode", "", "the coverage mode to use")
 	coverFormat := flags.String("cover_format", "", "the coverage report type to generate (go_cover or lcov)")
+	coverNative := flags.Bool("cover_native", false, "whether packages are instrumented with the compiler's coverage support instead of coverdata")
+	coverGoTool := flags.String("cover_go_tool", "", "the runfiles path of the go command, which converts native coverage data")
 	pkgname := flags.String("pkgname", "", "package name of test")
+	shardStrategy := flags.String("shard_strategy", "", "how tests are assigned to shards (index, hash or duration)")
+	shardTimings := multiFlag{}
+	flags.Var(&shardTimings, "shard_timings", "File with the durations of tests for the duration shard strategy")
 	flags.Var(&imports, "import", "Packages to import")
 	flags.Var(&sources, "src", "Sources to process for tests")
 	if err := flags.Parse(args); err != nil {
@@ -317,7 +387,20 @@ func genTestMain(args []string) error {
 	cases := Cases{
 		CoverFormat: *coverFormat,
 		CoverMode:   *coverMode,
+		CoverNative: *coverNative,
+		CoverGoTool: *coverGoTool,
 		Pkgname:     *pkgname,
+
+		ShardStrategy: *shardStrategy,
+	}
+	if len(shardTimings) > 0 {
+		cases.TestDurations, err = readTestTimings(shardTimings)
+		if err != nil {
+			return err
+		}
+	}
+	if cases.CoverNative && !cases.Version("go1.23") {
+		return fmt.Errorf("native coverage requires Go 1.23 or later")
 	}
 
 	testFileSet := token.NewFileSet()
@@ -0,0 +1,145 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file parses Bazel labels and target patterns.
+// Note that this file is shared between the nogo binary and the builder, which
+// validates the patterns in the nogo configuration.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bazelLabel is a parsed Bazel label. repo is empty for the main repository.
+type bazelLabel struct {
+	repo, pkg, name string
+}
+
+// parseBazelLabel parses an absolute label as formatted by Starlark's str(),
+// e.g. "//foo:bar", "@@//foo:bar" or "@@rules_go~//foo:bar".
+func parseBazelLabel(s string) (bazelLabel, error) {
+	repo, rest, err := splitRepo(s)
+	if err != nil {
+		return bazelLabel{}, err
+	}
+	i := strings.IndexByte(rest, ':')
+	if i < 0 {
+		return bazelLabel{}, fmt.Errorf("label %q has no target name", s)
+	}
+	return bazelLabel{repo: repo, pkg: rest[:i], name: rest[i+1:]}, nil
+}
+
+// labelPattern is a parsed Bazel target pattern, as accepted on the command
+// line. Only absolute patterns are supported.
+type labelPattern struct {
+	repo, pkg string
+	// name is the target name, or empty if the pattern matches all targets
+	// in pkg.
+	name string
+	// recursive is true if the pattern matches all targets in pkg and its
+	// subpackages, as in "//foo/...".
+	recursive bool
+}
+
+// parseLabelPattern parses one of the following patterns, optionally prefixed
+// with a repository name such as "@repo":
+//
+//	//foo/bar:baz          the target //foo/bar:baz
+//	//foo/bar              the target //foo/bar:bar
+//	//foo/bar:all          all targets in package foo/bar, also ":*" and ":all-targets"
+//	//foo/...              all targets in foo and its subpackages
+//	//...                  all targets in the repository
+func parseLabelPattern(s string) (labelPattern, error) {
+	repo, rest, err := splitRepo(s)
+	if err != nil {
+		return labelPattern{}, err
+	}
+	p := labelPattern{repo: repo, pkg: rest}
+	hasName := false
+	if i := strings.IndexByte(rest, ':'); i >= 0 {
+		p.pkg, p.name, hasName = rest[:i], rest[i+1:], true
+		switch p.name {
+		case "all", "*", "all-targets":
+			p.name = ""
+		case "":
+			return labelPattern{}, fmt.Errorf("pattern %q has an empty target name", s)
+		}
+	}
+	if p.pkg == "..." || strings.HasSuffix(p.pkg, "/...") {
+		if p.name != "" {
+			return labelPattern{}, fmt.Errorf("pattern %q: only all targets of packages can be matched recursively", s)
+		}
+		p.recursive = true
+		p.pkg = strings.TrimSuffix(strings.TrimSuffix(p.pkg, "..."), "/")
+		return p, nil
+	}
+	if strings.Contains(p.pkg, "...") {
+		return labelPattern{}, fmt.Errorf("pattern %q: \"...\" is only supported at the end of the package", s)
+	}
+	if !hasName {
+		p.name = p.pkg[strings.LastIndexByte(p.pkg, '/')+1:]
+		if p.name == "" {
+			return labelPattern{}, fmt.Errorf("pattern %q doesn't name a target", s)
+		}
+	}
+	return p, nil
+}
+
+// splitRepo splits an absolute label or pattern into the repository name,
+// without leading '@' characters, and the part starting after "//".
+func splitRepo(s string) (repo, rest string, err error) {
+	i := strings.Index(s, "//")
+	if i < 0 || (i > 0 && s[0] != '@') {
+		return "", "", fmt.Errorf("%q is not an absolute label", s)
+	}
+	return strings.TrimLeft(s[:i], "@"), s[i+2:], nil
+}
+
+func (p labelPattern) matches(l bazelLabel) bool {
+	if p.repo != l.repo {
+		return false
+	}
+	if p.recursive {
+		return p.pkg == "" || l.pkg == p.pkg || strings.HasPrefix(l.pkg, p.pkg+"/")
+	}
+	return l.pkg == p.pkg && (p.name == "" || l.name == p.name)
+}
+
+// checkLabelPattern returns an error if pattern is invalid or can't match any
+// target. The configuration is a plain file, so repository names in patterns
+// can't be resolved like labels in BUILD files. With Bzlmod, the labels of
+// external targets use canonical repository names and thus patterns with
+// apparent names such as "@com_example_foo//..." never match.
+func checkLabelPattern(pattern string, bzlmod bool) error {
+	p, err := parseLabelPattern(pattern)
+	if err != nil {
+		return err
+	}
+	if bzlmod && p.repo != "" && !strings.HasPrefix(pattern, "@@") {
+		return fmt.Errorf("pattern %q refers to a repository by its apparent name, which doesn't match with Bzlmod; use the canonical repository name starting with \"@@\" instead", pattern)
+	}
+	return nil
+}
+
+// mustParseLabelPattern is like parseLabelPattern, but panics on invalid
+// patterns. It is used by the generated nogo configuration, whose patterns
+// are validated when it is generated.
+func mustParseLabelPattern(s string) labelPattern {
+	p, err := parseLabelPattern(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestParseBazelLabel(t *testing.T) {
+	tests := []struct {
+		Label string
+		Want  bazelLabel
+		Err   bool
+	}{
+		{Label: "//foo/bar:baz", Want: bazelLabel{pkg: "foo/bar", name: "baz"}},
+		{Label: "@@//foo:bar", Want: bazelLabel{pkg: "foo", name: "bar"}},
+		{Label: "@//:root", Want: bazelLabel{name: "root"}},
+		{Label: "@@rules_go~//go/tools:tool", Want: bazelLabel{repo: "rules_go~", pkg: "go/tools", name: "tool"}},
+		{Label: "//foo", Err: true},
+		{Label: "foo:bar", Err: true},
+	}
+	for _, tc := range tests {
+		got, err := parseBazelLabel(tc.Label)
+		if (err != nil) != tc.Err {
+			t.Errorf("parseBazelLabel(%q) returned error %v", tc.Label, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("parseBazelLabel(%q) = %+v, want %+v", tc.Label, got, tc.Want)
+		}
+	}
+}
+
+func TestLabelPatternMatches(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Matches []string
+		Misses  []string
+	}{
+		{
+			Pattern: "//...",
+			Matches: []string{"//:a", "//foo/bar:baz", "@@//foo:foo"},
+			Misses:  []string{"@@other//foo:foo"},
+		},
+		{
+			Pattern: "//services/...",
+			Matches: []string{"//services:a", "//services/api:server"},
+			Misses:  []string{"//servicesx:a", "//other/services:a"},
+		},
+		{
+			Pattern: "//services/...:all",
+			Matches: []string{"//services/api:server"},
+		},
+		{
+			Pattern: "//foo:all",
+			Matches: []string{"//foo:a", "//foo:b"},
+			Misses:  []string{"//foo/bar:a"},
+		},
+		{
+			Pattern: "//foo:*",
+			Matches: []string{"//foo:a"},
+		},
+		{
+			Pattern: "//foo/bar",
+			Matches: []string{"//foo/bar:bar"},
+			Misses:  []string{"//foo/bar:baz"},
+		},
+		{
+			Pattern: "//foo:bar",
+			Matches: []string{"//foo:bar"},
+			Misses:  []string{"//foo:baz", "//foo/bar:bar"},
+		},
+		{
+			Pattern: "@com_example//...",
+			Matches: []string{"@@com_example//pkg:lib"},
+			Misses:  []string{"//pkg:lib"},
+		},
+	}
+	for _, tc := range tests {
+		p, err := parseLabelPattern(tc.Pattern)
+		if err != nil {
+			t.Errorf("parseLabelPattern(%q): %v", tc.Pattern, err)
+			continue
+		}
+		for _, s := range tc.Matches {
+			if l, err := parseBazelLabel(s); err != nil || !p.matches(l) {
+				t.Errorf("%s does not match %s", tc.Pattern, s)
+			}
+		}
+		for _, s := range tc.Misses {
+			if l, err := parseBazelLabel(s); err != nil || p.matches(l) {
+				t.Errorf("%s matches %s", tc.Pattern, s)
+			}
+		}
+	}
+}
+
+func TestParseLabelPatternErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"foo/...",
+		"//foo:",
+		"//foo/...:bar",
+		"//foo/.../bar",
+		"//",
+	} {
+		if _, err := parseLabelPattern(pattern); err == nil {
+			t.Errorf("parseLabelPattern(%q) succeeded, want error", pattern)
+		}
+	}
+}
+
+func TestCheckLabelPattern(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Bzlmod  bool
+		Err     bool
+	}{
+		{Pattern: "//foo/...", Bzlmod: true},
+		{Pattern: "@//foo/...", Bzlmod: true},
+		{Pattern: "@@rules_go~//go/...", Bzlmod: true},
+		{Pattern: "@com_example_foo//...", Bzlmod: true, Err: true},
+		{Pattern: "@com_example_foo//...", Bzlmod: false},
+		{Pattern: "foo/...", Err: true},
+	}
+	for _, tc := range tests {
+		if err := checkLabelPattern(tc.Pattern, tc.Bzlmod); (err != nil) != tc.Err {
+			t.Errorf("checkLabelPattern(%q, %v) returned error %v", tc.Pattern, tc.Bzlmod, err)
+		}
+	}
+}
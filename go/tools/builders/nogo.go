@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -20,11 +21,11 @@ func nogo(args []string) error {
 
 	fs := flag.NewFlagSet("GoNogo", flag.ExitOnError)
 	goenv := envFlags(fs)
-	var unfilteredSrcs, ignoreSrcs, recompileInternalDeps multiFlag
+	var unfilteredSrcs, ignoreSrcs, recompileInternalDeps, tags multiFlag
 	var deps, facts archiveMultiFlag
-	var importPath, packagePath, nogoPath, packageListPath string
+	var importPath, packagePath, nogoPath, packageListPath, stdlibFactsDir, label string
 	var testFilter string
-	var outFactsPath, outLogPath string
+	var outFactsPath, outLogPath, outFixPath, outJSONPath, outSARIFPath, outProfilePath string
 	var coverMode string
 	fs.Var(&unfilteredSrcs, "src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and checked")
 	fs.Var(&ignoreSrcs, "ignore_src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and checked, but with its diagnostics ignored")
@@ -37,8 +38,15 @@ func nogo(args []string) error {
 	fs.StringVar(&coverMode, "cover_mode", "", "The coverage mode to use. Empty if coverage instrumentation should not be added.")
 	fs.StringVar(&testFilter, "testfilter", "off", "Controls test package filtering")
 	fs.StringVar(&nogoPath, "nogo", "", "The nogo binary")
+	fs.StringVar(&stdlibFactsDir, "stdlib_facts", "", "The directory containing the nogo facts of the standard library, as written by nogostdlib")
+	fs.StringVar(&label, "label", "", "The label of the target being compiled, used to scope analyzers")
+	fs.Var(&tags, "tag", "A tag of the target being compiled, used to scope analyzers")
 	fs.StringVar(&outFactsPath, "out_facts", "", "The file to emit serialized nogo facts to")
 	fs.StringVar(&outLogPath, "out_log", "", "The file to emit nogo logs into")
+	fs.StringVar(&outFixPath, "out_fix", "", "The file to emit a patch with the suggested fixes of nogo findings into")
+	fs.StringVar(&outJSONPath, "out_json", "", "The file to emit nogo findings into in JSON format")
+	fs.StringVar(&outSARIFPath, "out_sarif", "", "The file to emit nogo findings into in SARIF 2.1.0 format")
+	fs.StringVar(&outProfilePath, "out_profile", "", "The file to emit the time and memory spent per nogo analyzer into")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -77,15 +85,46 @@ func nogo(args []string) error {
 	defer cleanup()
 
 	compilingWithCgo := os.Getenv("CGO_ENABLED") == "1" && haveCgo
-	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, workDir)
+	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, false, workDir)
 	if err != nil {
 		return err
 	}
 
-	return runNogo(workDir, nogoPath, goSrcs, ignoreSrcs, facts, importPath, importcfgPath, outFactsPath, outLogPath)
+	if stdlibFactsDir != "" {
+		facts = append(facts, stdlibFacts(stdlibFactsDir, srcs.goSrcs, deps)...)
+	}
+
+	return runNogo(workDir, nogoPath, goSrcs, ignoreSrcs, facts, importPath, importcfgPath, label, tags, outFactsPath, outLogPath, outFixPath, outJSONPath, outSARIFPath, outProfilePath)
+}
+
+// stdlibFacts returns the facts files in dir of the standard library packages
+// imported by srcs. Imports of direct dependencies are skipped.
+func stdlibFacts(dir string, srcs []fileInfo, deps []archive) []archive {
+	seen := make(map[string]bool)
+	for _, dep := range deps {
+		seen[dep.importPath] = true
+		for _, alias := range dep.importPathAliases {
+			seen[alias] = true
+		}
+	}
+	var facts []archive
+	for _, src := range srcs {
+		for _, imp := range src.imports {
+			if seen[imp.path] {
+				continue
+			}
+			seen[imp.path] = true
+			file := stdlibFactsPath(abs(dir), imp.path)
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			facts = append(facts, archive{importPath: imp.path, packagePath: imp.path, file: file})
+		}
+	}
+	return facts
 }
 
-func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []archive, packagePath, importcfgPath, outFactsPath string, outLogPath string) error {
+func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []archive, packagePath, importcfgPath, label string, tags []string, outFactsPath string, outLogPath string, outFixPath string, outJSONPath, outSARIFPath, outProfilePath string) error {
 	if len(srcs) == 0 {
 		// emit_compilepkg expects a nogo facts file, even if it's empty.
 		// We also need to write the validation output log.
@@ -97,7 +136,13 @@ func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []ar
 		if err != nil {
 			return fmt.Errorf("error writing empty nogo log file: %v", err)
 		}
-		return nil
+		if outFixPath != "" {
+			err = os.WriteFile(outFixPath, nil, 0o666)
+			if err != nil {
+				return fmt.Errorf("error writing empty nogo fix file: %v", err)
+			}
+		}
+		return writeEmptyNogoReports(packagePath, outJSONPath, outSARIFPath, outProfilePath)
 	}
 	args := []string{nogoPath}
 	args = append(args, "-p", packagePath)
@@ -106,6 +151,24 @@ func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []ar
 		args = append(args, "-fact", fmt.Sprintf("%s=%s", fact.importPath, fact.file))
 	}
 	args = append(args, "-x", outFactsPath)
+	if label != "" {
+		args = append(args, "-label", label)
+	}
+	for _, tag := range tags {
+		args = append(args, "-tag", tag)
+	}
+	if outFixPath != "" {
+		args = append(args, "-fixpatch", outFixPath)
+	}
+	if outJSONPath != "" {
+		args = append(args, "-json", outJSONPath)
+	}
+	if outSARIFPath != "" {
+		args = append(args, "-sarif", outSARIFPath)
+	}
+	if outProfilePath != "" {
+		args = append(args, "-profile", outProfilePath)
+	}
 	for _, ignore := range ignores {
 		args = append(args, "-ignore", ignore)
 	}
@@ -128,6 +191,12 @@ func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []ar
 	defer outLog.Close()
 	err = cmd.Run()
 	if err == nil {
+		// nogo succeeds, but prints diagnostics with severity warning.
+		// Forward them to the action's output, which Bazel shows even if
+		// the action succeeds.
+		if out.Len() > 0 {
+			os.Stderr.Write(relativizePaths(out.Bytes()))
+		}
 		return nil
 	}
 	if exitErr, ok := err.(*exec.ExitError); ok {
@@ -149,3 +218,35 @@ func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []ar
 	return nil
 }
 
+// writeEmptyNogoReports writes the structured nogo reports and profile for a
+// package without Go sources, which nogo doesn't run on.
+func writeEmptyNogoReports(packagePath, outJSONPath, outSARIFPath, outProfilePath string) error {
+	if outJSONPath != "" {
+		report, err := newJSONReportData(packagePath).encode()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(outJSONPath, report, 0o666); err != nil {
+			return fmt.Errorf("error writing empty nogo JSON report: %v", err)
+		}
+	}
+	if outSARIFPath != "" {
+		report, err := encodeSarifLog(newSarifRun())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(outSARIFPath, report, 0o666); err != nil {
+			return fmt.Errorf("error writing empty nogo SARIF report: %v", err)
+		}
+	}
+	if outProfilePath != "" {
+		profile, err := json.Marshal(newNogoProfile(packagePath))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(outProfilePath, profile, 0o666); err != nil {
+			return fmt.Errorf("error writing empty nogo profile: %v", err)
+		}
+	}
+	return nil
+}
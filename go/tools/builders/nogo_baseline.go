@@ -0,0 +1,83 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/funcname"
+)
+
+var (
+	// positionPattern matches source positions such as "foo.go:12:3" or
+	// ":12:3" that analyzers embed in messages, e.g. to refer to a previous
+	// declaration.
+	positionPattern = regexp.MustCompile(`[^\s():]+\.go:\d+(:\d+)?|:\d+:\d+\b`)
+	// linePattern matches references to lines such as "line 12".
+	linePattern  = regexp.MustCompile(`\b(lines?) \d+\b`)
+	spacePattern = regexp.MustCompile(`\s+`)
+)
+
+// normalizeMessage strips the parts of a diagnostic message that change when
+// unrelated code moves around, such as line numbers. Other numbers, e.g. in
+// type names such as int32, are kept.
+func normalizeMessage(msg string) string {
+	msg = positionPattern.ReplaceAllString(msg, "<pos>")
+	msg = linePattern.ReplaceAllString(msg, "$1 N")
+	msg = spacePattern.ReplaceAllString(msg, " ")
+	return strings.TrimSpace(msg)
+}
+
+// diagnosticFingerprint identifies a diagnostic in a way that survives line
+// shifts: it is derived from the analyzer name, the file name relative to the
+// workspace root, the name of the enclosing function and the normalized
+// message, but not from the position of the diagnostic.
+func diagnosticFingerprint(analyzer, filename, function, msg string) string {
+	h := sha256.New()
+	for _, s := range []string{analyzer, filename, function, normalizeMessage(msg)} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// enclosingFunction returns the name of the function or method declaration
+// in files that contains pos. Methods are named like "(*T).M" or "T.M". It
+// returns the empty string for positions outside of function declarations.
+func enclosingFunction(fset *token.FileSet, files []*ast.File, pos token.Pos) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	for _, f := range files {
+		tf := fset.File(f.Pos())
+		if tf == nil || int(pos) < tf.Base() || int(pos) > tf.Base()+tf.Size() {
+			continue
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || pos < fn.Pos() || pos > fn.End() {
+				continue
+			}
+			return funcname.Of(fn)
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	tests := []struct {
+		Msg, Want string
+	}{
+		{
+			Msg:  "fmt.Sprintf format %d has arg x of wrong type string",
+			Want: "fmt.Sprintf format %d has arg x of wrong type string",
+		},
+		{
+			Msg:  "x redeclared, previous declaration at pkg/a.go:12:3",
+			Want: "x redeclared, previous declaration at <pos>",
+		},
+		{
+			Msg:  "position :7:14 and line 12 moved",
+			Want: "position <pos> and line N moved",
+		},
+		{
+			Msg:  "call has   3 arguments\nbut wants 2",
+			Want: "call has 3 arguments but wants 2",
+		},
+		{
+			Msg:  "conversion from int64 to int32 may overflow",
+			Want: "conversion from int64 to int32 may overflow",
+		},
+	}
+	for _, tc := range tests {
+		if got := normalizeMessage(tc.Msg); got != tc.Want {
+			t.Errorf("normalizeMessage(%q) = %q, want %q", tc.Msg, got, tc.Want)
+		}
+	}
+}
+
+func TestDiagnosticFingerprint(t *testing.T) {
+	fp := diagnosticFingerprint("printf", "pkg/a.go", "F", "bad call at pkg/a.go:10:2")
+	if moved := diagnosticFingerprint("printf", "pkg/a.go", "F", "bad call at pkg/a.go:14:2"); moved != fp {
+		t.Errorf("fingerprint changed when the referenced position moved: %s != %s", moved, fp)
+	}
+	for _, other := range []string{
+		diagnosticFingerprint("bools", "pkg/a.go", "F", "bad call at pkg/a.go:10:2"),
+		diagnosticFingerprint("printf", "pkg/b.go", "F", "bad call at pkg/a.go:10:2"),
+		diagnosticFingerprint("printf", "pkg/a.go", "G", "bad call at pkg/a.go:10:2"),
+		diagnosticFingerprint("printf", "pkg/a.go", "F", "other call at pkg/a.go:10:2"),
+	} {
+		if other == fp {
+			t.Errorf("fingerprints of different diagnostics collide: %s", fp)
+		}
+	}
+}
+
+const enclosingSrc = `package p
+
+var v = 1
+
+func F() {
+	_ = 1
+}
+
+type T struct{}
+
+func (T) Value() {
+	_ = 2
+}
+
+func (t *T) Pointer() {
+	_ = 3
+}
+
+type G[K comparable, V any] map[K]V
+
+func (g *G[K, V]) Generic() {
+	_ = 4
+}
+`
+
+func TestEnclosingFunction(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", enclosingSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []*ast.File{f}
+	base := token.Pos(fset.File(f.Pos()).Base())
+	tests := []struct {
+		Marker, Want string
+	}{
+		{Marker: "var v", Want: ""},
+		{Marker: "_ = 1", Want: "F"},
+		{Marker: "_ = 2", Want: "T.Value"},
+		{Marker: "_ = 3", Want: "(*T).Pointer"},
+		{Marker: "_ = 4", Want: "(*G).Generic"},
+	}
+	for _, tc := range tests {
+		pos := base + token.Pos(strings.Index(enclosingSrc, tc.Marker))
+		if got := enclosingFunction(fset, files, pos); got != tc.Want {
+			t.Errorf("enclosingFunction at %q = %q, want %q", tc.Marker, got, tc.Want)
+		}
+	}
+	if got := enclosingFunction(fset, files, token.NoPos); got != "" {
+		t.Errorf("enclosingFunction at NoPos = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileEdit is a single text replacement within a file, expressed as byte
+// offsets so that it is independent of the token.FileSet it came from.
+type fileEdit struct {
+	start, end int
+	newText    string
+}
+
+// fileEdits collects the edits for each file of a package, keyed by
+// filename.
+type fileEdits map[string][]fileEdit
+
+// sourceFiles returns the set of srcs that are not in ignores, which holds
+// the generated files of the package.
+func sourceFiles(srcs, ignores []string) map[string]bool {
+	ignored := make(map[string]bool, len(ignores))
+	for _, ignore := range ignores {
+		ignored[ignore] = true
+	}
+	sources := make(map[string]bool, len(srcs))
+	for _, src := range srcs {
+		if !ignored[src] {
+			sources[src] = true
+		}
+	}
+	return sources
+}
+
+// onlyEdits reports whether all files edited by candidate are in files.
+func onlyEdits(candidate fileEdits, files map[string]bool) bool {
+	for filename := range candidate {
+		if !files[filename] {
+			return false
+		}
+	}
+	return true
+}
+
+// conflicts reports whether any edit in candidate overlaps with an edit
+// in accepted. Identical edits do not conflict, since analyzers commonly
+// suggest the same change for related diagnostics.
+func conflicts(accepted, candidate fileEdits) bool {
+	for filename, cs := range candidate {
+		for i, c := range cs {
+			for _, a := range accepted[filename] {
+				if overlaps(a, c) {
+					return true
+				}
+			}
+			for _, other := range cs[i+1:] {
+				if overlaps(c, other) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func overlaps(a, b fileEdit) bool {
+	if a == b {
+		return false
+	}
+	if a.start == a.end && b.start == b.end {
+		// Two insertions at the same offset have no well-defined order.
+		return a.start == b.start
+	}
+	return a.start < b.end && b.start < a.end
+}
+
+// mergeEdits adds edits to existing, dropping exact duplicates.
+func mergeEdits(existing, edits []fileEdit) []fileEdit {
+	for _, e := range edits {
+		dup := false
+		for _, x := range existing {
+			if x == e {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			existing = append(existing, e)
+		}
+	}
+	return existing
+}
+
+// applyEdits returns the result of applying the non-overlapping edits to src.
+func applyEdits(src []byte, edits []fileEdit) ([]byte, error) {
+	sorted := make([]fileEdit, len(edits))
+	copy(sorted, edits)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].start != sorted[j].start {
+			return sorted[i].start < sorted[j].start
+		}
+		// Insertions go before a replacement starting at the same offset.
+		return sorted[i].end < sorted[j].end
+	})
+	var out bytes.Buffer
+	last := 0
+	for _, e := range sorted {
+		if e.start < last || e.end > len(src) {
+			return nil, fmt.Errorf("invalid edit [%d, %d) in file of size %d", e.start, e.end, len(src))
+		}
+		out.Write(src[last:e.start])
+		out.WriteString(e.newText)
+		last = e.end
+	}
+	out.Write(src[last:])
+	return out.Bytes(), nil
+}
+
+// writeFixPatch applies the edits to the files they refer to and writes a
+// unified diff for all of them to out. Paths in the diff are made relative
+// to cwd so that the patch can be applied with "patch -p1" from the
+// workspace root.
+func writeFixPatch(out *bytes.Buffer, edits fileEdits, cwd string) error {
+	filenames := make([]string, 0, len(edits))
+	for filename := range edits {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", filename, err)
+		}
+		dst, err := applyEdits(src, edits[filename])
+		if err != nil {
+			return fmt.Errorf("error applying fixes to %s: %v", filename, err)
+		}
+		name := filename
+		if cwd != "" {
+			if rel, err := filepath.Rel(cwd, filename); err == nil {
+				name = rel
+			}
+		}
+		name = filepath.ToSlash(name)
+		out.WriteString(unifiedDiff("a/"+name, "b/"+name, string(src), string(dst)))
+	}
+	return nil
+}
+
+// diffContext is the number of unchanged lines printed around each change.
+const diffContext = 3
+
+// lineOp is one line of an edit script produced by diffLines.
+type lineOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns a unified diff between before and after, or the empty
+// string if they are identical.
+func unifiedDiff(beforeName, afterName, before, after string) string {
+	if before == after {
+		return ""
+	}
+	ops := diffLines(splitLines(before), splitLines(after))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", beforeName, afterName)
+
+	// aLine[i] and bLine[i] are the 0-based line numbers in before and after
+	// at which ops[i] applies.
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Found a change. Extend the hunk while the next change is close
+		// enough for the context lines to touch.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		i = end
+		end += diffContext
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aCount, bCount := aLine[end]-aLine[start], bLine[end]-bLine[start]
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(aLine[start], aCount), hunkRange(bLine[start], bCount))
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range refers to the line before the change.
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits s into lines, keeping the line terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a minimal edit script turning a into b using Myers'
+// O(ND) algorithm.
+func diffLines(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the edit script.
+	var ops []lineOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, lineOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, lineOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, lineOp{'-', a[x-1]})
+			}
+			x, y = prevX, prevY
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
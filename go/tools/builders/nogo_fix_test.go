@@ -0,0 +1,239 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestApplyEdits(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Src   string
+		Edits []fileEdit
+		Want  string
+	}{
+		{
+			Name: "No edits",
+			Src:  "hello world",
+			Want: "hello world",
+		},
+		{
+			Name:  "Replacement",
+			Src:   "hello world",
+			Edits: []fileEdit{{start: 6, end: 11, newText: "gopher"}},
+			Want:  "hello gopher",
+		},
+		{
+			Name: "Unordered edits",
+			Src:  "a b c",
+			Edits: []fileEdit{
+				{start: 4, end: 5, newText: "C"},
+				{start: 0, end: 1, newText: "A"},
+			},
+			Want: "A b C",
+		},
+		{
+			Name: "Insertion before replacement",
+			Src:  "ab",
+			Edits: []fileEdit{
+				{start: 0, end: 1, newText: "A"},
+				{start: 0, end: 0, newText: ">"},
+			},
+			Want: ">Ab",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := applyEdits([]byte(tc.Src), tc.Edits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.Want {
+				t.Fatalf("applyEdits expect %q got %q", tc.Want, got)
+			}
+		})
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	accepted := fileEdits{
+		"a.go": {{start: 10, end: 20, newText: "x"}},
+	}
+	tests := []struct {
+		Name      string
+		Candidate fileEdits
+		Conflicts bool
+	}{
+		{
+			Name:      "Other file",
+			Candidate: fileEdits{"b.go": {{start: 10, end: 20, newText: "y"}}},
+		},
+		{
+			Name:      "Disjoint",
+			Candidate: fileEdits{"a.go": {{start: 20, end: 25, newText: "y"}}},
+		},
+		{
+			Name:      "Identical",
+			Candidate: fileEdits{"a.go": {{start: 10, end: 20, newText: "x"}}},
+		},
+		{
+			Name:      "Overlapping",
+			Candidate: fileEdits{"a.go": {{start: 15, end: 25, newText: "y"}}},
+			Conflicts: true,
+		},
+		{
+			Name:      "Insertion inside replacement",
+			Candidate: fileEdits{"a.go": {{start: 12, end: 12, newText: "y"}}},
+			Conflicts: true,
+		},
+		{
+			Name: "Overlapping within candidate",
+			Candidate: fileEdits{"b.go": {
+				{start: 0, end: 5, newText: "y"},
+				{start: 3, end: 8, newText: "z"},
+			}},
+			Conflicts: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			if got := conflicts(accepted, tc.Candidate); got != tc.Conflicts {
+				t.Fatalf("conflicts expect %t got %t", tc.Conflicts, got)
+			}
+		})
+	}
+}
+
+func TestOnlyEdits(t *testing.T) {
+	cgo1 := "bazel-out/k8-fastbuild/bin/pkg/pkg.a.cgo/foo.cgo1.go"
+	sources := sourceFiles([]string{"pkg/a.go", cgo1}, []string{cgo1})
+	tests := []struct {
+		Name      string
+		Candidate fileEdits
+		Want      bool
+	}{
+		{
+			Name:      "Source",
+			Candidate: fileEdits{"pkg/a.go": {{start: 0, end: 1, newText: "x"}}},
+			Want:      true,
+		},
+		{
+			Name:      "Generated",
+			Candidate: fileEdits{cgo1: {{start: 0, end: 1, newText: "x"}}},
+		},
+		{
+			Name: "Source and generated",
+			Candidate: fileEdits{
+				"pkg/a.go": {{start: 0, end: 1, newText: "x"}},
+				cgo1:       {{start: 0, end: 1, newText: "x"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			if got := onlyEdits(tc.Candidate, sources); got != tc.Want {
+				t.Fatalf("onlyEdits expect %t got %t", tc.Want, got)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Before, After string
+		Want          string
+	}{
+		{
+			Name:   "Identical",
+			Before: "a\nb\n",
+			After:  "a\nb\n",
+		},
+		{
+			Name:   "Single change",
+			Before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			After:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			Want: `--- a/f.go
++++ b/f.go
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			Name:   "Separate hunks",
+			Before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			After:  "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			Want: `--- a/f.go
++++ b/f.go
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++twelve
+`,
+		},
+		{
+			Name:   "Insertion into empty file",
+			Before: "",
+			After:  "package p\n",
+			Want: `--- a/f.go
++++ b/f.go
+@@ -0,0 +1 @@
++package p
+`,
+		},
+		{
+			Name:   "Missing trailing newline",
+			Before: "a\nb",
+			After:  "a\nc",
+			Want: `--- a/f.go
++++ b/f.go
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+\ No newline at end of file
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			got := unifiedDiff("a/f.go", "b/f.go", tc.Before, tc.After)
+			if got != tc.Want {
+				t.Fatalf("unifiedDiff expect:\n%s\ngot:\n%s", tc.Want, got)
+			}
+		})
+	}
+}
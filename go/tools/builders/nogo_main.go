@@ -22,6 +22,7 @@ package main
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -54,7 +55,9 @@ func init() {
 
 var typesSizes = types.SizesFor("gc", os.Getenv("GOARCH"))
 
-func main() {
+// nogoMain is the entry point of the nogo binary run by the builder's nogo
+// verb. The template in generate_nogo_main.go defines main.
+func nogoMain() {
 	log.SetFlags(0) // no timestamp
 	log.SetPrefix("nogo: ")
 	if err, exitCode := run(os.Args[1:]); err != nil {
@@ -77,27 +80,88 @@ func run(args []string) (error, int) {
 	importcfg := flags.String("importcfg", "", "The import configuration file")
 	packagePath := flags.String("p", "", "The package path (importmap) of the package being compiled")
 	xPath := flags.String("x", "", "The archive file where serialized facts should be written")
-	var ignores multiFlag
+	fixPath := flags.String("fixpatch", "", "The file where a unified diff applying the analyzers' suggested fixes should be written")
+	jsonPath := flags.String("json", "", "The file where the diagnostics should be written in JSON format")
+	sarifPath := flags.String("sarif", "", "The file where the diagnostics should be written in SARIF 2.1.0 format")
+	profilePath := flags.String("profile", "", "The file where the time and memory spent per analyzer should be written in JSON format. Analyzers are run one at a time if set.")
+	label := flags.String("label", "", "The label of the target the package belongs to")
+	factsOnly := flags.Bool("facts_only", false, "Only write the facts of the package, but don't report diagnostics. Used for the standard library.")
+	var ignores, tags multiFlag
 	flags.Var(&ignores, "ignore", "Names of files to ignore")
+	flags.Var(&tags, "tag", "A tag of the target the package belongs to (may be repeated)")
 	flags.Parse(args)
 	srcs := flags.Args()
 
+	target, err := newTargetInfo(*label, tags)
+	if err != nil {
+		return fmt.Errorf("error parsing target label: %v", err), nogoError
+	}
+
 	packageFile, importMap, err := readImportCfg(*importcfg)
 	if err != nil {
 		return fmt.Errorf("error parsing importcfg: %v", err), nogoError
 	}
 
-	diagnostics, facts, err := checkPackage(analyzers, *packagePath, packageFile, importMap, factMap, srcs, ignores)
+	var prof *nogoProfile
+	if *profilePath != "" {
+		prof = newNogoProfile(*packagePath)
+	}
+	imp := newImporter(importMap, packageFile, factMap)
+	result, err := checkPackage(analyzers, *packagePath, imp, srcs, ignores, target, prof)
 	if err != nil {
 		return fmt.Errorf("error running analyzers: %v", err), nogoError
 	}
 	// Write the facts file for downstream consumers before failing due to diagnostics.
 	if *xPath != "" {
-		if err := ioutil.WriteFile(abs(*xPath), facts, 0o666); err != nil {
+		if err := ioutil.WriteFile(abs(*xPath), result.facts, 0o666); err != nil {
 			return fmt.Errorf("error writing facts: %v", err), nogoError
 		}
 	}
-	if diagnostics != "" {
+	if *factsOnly {
+		return nil, nogoSuccess
+	}
+	if *fixPath != "" {
+		fixes, err := fixPatch(result.fset, result.entries, sourceFiles(srcs, ignores))
+		if err != nil {
+			return fmt.Errorf("error computing fixes: %v", err), nogoError
+		}
+		if err := ioutil.WriteFile(abs(*fixPath), fixes, 0o666); err != nil {
+			return fmt.Errorf("error writing fixes: %v", err), nogoError
+		}
+	}
+	if *jsonPath != "" {
+		report, err := jsonReport(*packagePath, result)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON report: %v", err), nogoError
+		}
+		if err := ioutil.WriteFile(abs(*jsonPath), report, 0o666); err != nil {
+			return fmt.Errorf("error writing JSON report: %v", err), nogoError
+		}
+	}
+	if *sarifPath != "" {
+		report, err := sarifReport(result)
+		if err != nil {
+			return fmt.Errorf("error encoding SARIF report: %v", err), nogoError
+		}
+		if err := ioutil.WriteFile(abs(*sarifPath), report, 0o666); err != nil {
+			return fmt.Errorf("error writing SARIF report: %v", err), nogoError
+		}
+	}
+	if *profilePath != "" {
+		data, err := json.Marshal(prof)
+		if err != nil {
+			return fmt.Errorf("error encoding profile: %v", err), nogoError
+		}
+		if err := ioutil.WriteFile(abs(*profilePath), data, 0o666); err != nil {
+			return fmt.Errorf("error writing profile: %v", err), nogoError
+		}
+	}
+	if warnings := result.warnings; warnings != "" {
+		// Warnings don't fail the build. The builder forwards them to the
+		// output of the action.
+		log.Printf("warnings found by nogo during build-time code analysis:\n%s\n", warnings)
+	}
+	if diagnostics := result.diagnostics; diagnostics != "" {
 		// debugMode is defined by the template in generate_nogo_main.go.
 		exitCode := nogoViolation
 		if debugMode {
@@ -153,12 +217,36 @@ func readImportCfg(file string) (packageFile map[string]string, importMap map[st
 	return packageFile, importMap, nil
 }
 
+// checkResult holds the outcome of running the analyzers on a package.
+type checkResult struct {
+	// diagnostics is the text that must be printed in the build log. It is
+	// empty if no source code diagnostics or errors need to be printed.
+	diagnostics string
+	// warnings is the text of the diagnostics with severity warning, which
+	// are printed without failing the build.
+	warnings string
+	// entries are the reported diagnostics in position order.
+	entries []diagnosticEntry
+	// errs are the errors that prevented some analyzers from producing
+	// results. They are included in diagnostics.
+	errs []error
+	// facts are the serialized facts for importers of the package.
+	facts []byte
+	// fset provides position information for entries.
+	fset *token.FileSet
+	// types is the type-checked package. It may be incomplete if the package
+	// has type errors.
+	types *types.Package
+}
+
 // checkPackage runs all the given analyzers on the specified package and
-// returns the source code diagnostics that the must be printed in the build log.
-// It returns an empty string if no source code diagnostics need to be printed.
+// returns the source code diagnostics that the must be printed in the build log
+// together with the facts for the package. Imported packages and their facts
+// are provided by imp. If prof is not nil, the analyzers are run one at a time
+// and their cost is recorded in prof.
 //
 // This implementation was adapted from that of golang.org/x/tools/go/checker/internal/checker.
-func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFile, importMap map[string]string, factMap map[string]string, filenames, ignoreFiles []string) (string, []byte, error) {
+func checkPackage(analyzers []*analysis.Analyzer, packagePath string, imp *importer, filenames, ignoreFiles []string, target *targetInfo, prof *nogoProfile) (*checkResult, error) {
 	// Register fact types and establish dependencies between analyzers.
 	actions := make(map[*analysis.Analyzer]*action)
 	var visit func(a *analysis.Analyzer) *action
@@ -185,29 +273,16 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 
 	roots := make([]*action, 0, len(analyzers))
 	for _, a := range analyzers {
-		if cfg, ok := configs[a.Name]; ok {
-			for flagKey, flagVal := range cfg.analyzerFlags {
-				if strings.HasPrefix(flagKey, "-") {
-					return "", nil, fmt.Errorf(
-						"%s: flag should not begin with '-': %s", a.Name, flagKey)
-				}
-				if flag := a.Flags.Lookup(flagKey); flag == nil {
-					return "", nil, fmt.Errorf("%s: unrecognized flag: %s", a.Name, flagKey)
-				}
-				if err := a.Flags.Set(flagKey, flagVal); err != nil {
-					return "", nil, fmt.Errorf(
-						"%s: invalid value for flag: %s=%s: %w", a.Name, flagKey, flagVal, err)
-				}
-			}
-		}
 		roots = append(roots, visit(a))
 	}
+	if err := applyAllAnalyzerFlags(analyzers); err != nil {
+		return nil, err
+	}
 
 	// Load the package, including AST, types, and facts.
-	imp := newImporter(importMap, packageFile, factMap)
-	pkg, err := load(packagePath, imp, filenames)
+	pkg, err := load(packagePath, imp, filenames, prof)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading package: %v", err)
+		return nil, fmt.Errorf("error loading package: %v", err)
 	}
 	for _, act := range actions {
 		act.pkg = pkg
@@ -219,6 +294,7 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 	}
 	// Process nolint directives similar to golangci-lint.
 	// Also skip over fully ignored files.
+	var directives []*nolintDirective
 	for _, f := range pkg.syntax {
 		if _, ok := ignoreFilesSet[pkg.fset.Position(f.Pos()).Filename]; ok {
 			for _, act := range actions {
@@ -234,16 +310,19 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 		// assignment and will apply the comment to the entire assignment.
 		commentMap := ast.NewCommentMap(pkg.fset, f, f.Comments)
 		for node, groups := range commentMap {
-			rng := &Range{
-				from: pkg.fset.Position(node.Pos()),
-				to:   pkg.fset.Position(node.End()).Line,
-			}
 			for _, group := range groups {
 				for _, comm := range group.List {
 					linters, ok := parseNolint(comm.Text)
 					if !ok {
 						continue
 					}
+					directive := newNolintDirective(comm, linters)
+					directives = append(directives, directive)
+					rng := &Range{
+						from:      pkg.fset.Position(node.Pos()),
+						to:        pkg.fset.Position(node.End()).Line,
+						directive: directive,
+					}
 					for analyzer, act := range actions {
 						if linters == nil || linters[analyzer.Name] {
 							act.nolint = append(act.nolint, rng)
@@ -255,17 +334,146 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 	}
 
 	// Execute the analyzers.
-	execAll(roots)
+	if prof != nil {
+		execProfiled(roots, prof, make(map[*action]bool))
+	} else {
+		execAll(roots)
+	}
+	if nolintlintChecks.enabled() {
+		roots = append(roots, checkNolint(pkg, actions, directives))
+	}
 
 	// Process diagnostics and encode facts for importers of this package.
-	diagnostics := checkAnalysisResults(roots, pkg)
+	diagnostics, warnings, entries, errs := checkAnalysisResults(roots, pkg, target)
+	endEncode := prof.startPhase("facts_encode")
 	facts := pkg.facts.Encode()
-	return diagnostics, facts, nil
+	endEncode()
+	return &checkResult{
+		diagnostics: diagnostics,
+		warnings:    warnings,
+		entries:     entries,
+		errs:        errs,
+		facts:       facts,
+		fset:        pkg.fset,
+		types:       pkg.types,
+	}, nil
+}
+
+// fixPatch returns a unified diff that applies the suggested fixes of the
+// given diagnostics to sources. Fixes that conflict with an earlier fix or
+// that edit other files, like the Go files generated by cgo, are left out and
+// mentioned in a comment at the top of the patch, which patch(1) ignores.
+func fixPatch(fset *token.FileSet, diagnostics []diagnosticEntry, sources map[string]bool) ([]byte, error) {
+	edits, skipped := collectFixes(fset, diagnostics, sources)
+	if len(edits) == 0 {
+		return nil, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("nogo failed to get CWD: %w", err)
+	}
+	out := &bytes.Buffer{}
+	if skipped > 0 {
+		fmt.Fprintf(out, "# nogo skipped %d suggested fixes that conflict with other fixes or edit generated files.\n", skipped)
+		fmt.Fprintf(out, "# Apply this patch and rebuild to get the remaining fixes.\n")
+	}
+	if err := writeFixPatch(out, edits, cwd); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+var (
+	analyzerFlagsOnce sync.Once
+	analyzerFlagsErr  error
+)
+
+// applyAllAnalyzerFlags sets the flags of the given analyzers and of
+// nolintlint from their configuration. The flags are only set once, so that
+// the standalone driver can check several packages concurrently.
+func applyAllAnalyzerFlags(analyzers []*analysis.Analyzer) error {
+	analyzerFlagsOnce.Do(func() {
+		for _, a := range analyzers {
+			if analyzerFlagsErr = applyAnalyzerFlags(a); analyzerFlagsErr != nil {
+				return
+			}
+		}
+		analyzerFlagsErr = applyAnalyzerFlags(nolintlintAnalyzer)
+	})
+	return analyzerFlagsErr
+}
+
+// applyAnalyzerFlags sets the flags of a from the analyzer_flags of its
+// configuration.
+func applyAnalyzerFlags(a *analysis.Analyzer) error {
+	cfg, ok := configs[a.Name]
+	if !ok {
+		return nil
+	}
+	for flagKey, flagVal := range cfg.analyzerFlags {
+		if strings.HasPrefix(flagKey, "-") {
+			return fmt.Errorf(
+				"%s: flag should not begin with '-': %s", a.Name, flagKey)
+		}
+		if flag := a.Flags.Lookup(flagKey); flag == nil {
+			return fmt.Errorf("%s: unrecognized flag: %s", a.Name, flagKey)
+		}
+		if err := a.Flags.Set(flagKey, flagVal); err != nil {
+			return fmt.Errorf(
+				"%s: invalid value for flag: %s=%s: %w", a.Name, flagKey, flagVal, err)
+		}
+	}
+	return nil
+}
+
+// nolintlintAnalyzer reports problems with //nolint directives. It is never
+// run like the other analyzers: its diagnostics are computed by checkNolint
+// once all other analyzers are done. All checks are disabled by default and
+// are enabled through the analyzer_flags of its configuration.
+var nolintlintAnalyzer = &analysis.Analyzer{
+	Name:             nolintlintName,
+	Doc:              "reports unused, unknown and unexplained //nolint directives",
+	Run:              func(*analysis.Pass) (interface{}, error) { return nil, nil },
+	RunDespiteErrors: true,
+}
+
+var nolintlintChecks nolintChecks
+
+func init() {
+	nolintlintAnalyzer.Flags.BoolVar(&nolintlintChecks.unused, "unused", false, "report directives that don't suppress any diagnostic")
+	nolintlintAnalyzer.Flags.BoolVar(&nolintlintChecks.unknown, "unknown", false, "report directives naming analyzers that nogo doesn't run")
+	nolintlintAnalyzer.Flags.BoolVar(&nolintlintChecks.explanation, "require-explanation", false, "report directives without an explanation")
+}
+
+// checkNolint returns an action holding the nolintlint diagnostics for the
+// nolint directives of pkg. It must be called after all actions have run, so
+// that the directives know which diagnostics they suppressed.
+func checkNolint(pkg *goPackage, actions map[*analysis.Analyzer]*action, directives []*nolintDirective) *action {
+	known := make(map[string]bool)
+	ran := make(map[string]bool)
+	for a, act := range actions {
+		known[a.Name] = true
+		if act.err == nil && (!pkg.illTyped || a.RunDespiteErrors) {
+			ran[a.Name] = true
+		}
+	}
+	act := &action{a: nolintlintAnalyzer, pkg: pkg}
+	for _, issue := range nolintlintChecks.check(directives, known, ran) {
+		act.diagnostics = append(act.diagnostics, analysis.Diagnostic{
+			Pos:     issue.pos,
+			End:     issue.end,
+			Message: issue.message,
+		})
+	}
+	return act
 }
 
 type Range struct {
 	from token.Position
 	to   int
+	// directive is the nolint directive the range comes from, or nil for
+	// ranges covering ignored files.
+	directive *nolintDirective
 }
 
 // An action represents one unit of analysis work: the application of
@@ -302,6 +510,22 @@ func execAll(actions []*action) {
 	wg.Wait()
 }
 
+// execProfiled runs the given actions and their dependencies one at a time,
+// dependencies first, so that the time and memory each one takes can be
+// attributed to its analyzer in prof.
+func execProfiled(actions []*action, prof *nogoProfile, done map[*action]bool) {
+	for _, act := range actions {
+		if done[act] {
+			continue
+		}
+		done[act] = true
+		execProfiled(act.deps, prof, done)
+		end := prof.startAnalyzer(act.a.Name)
+		act.exec()
+		end()
+	}
+}
+
 func (act *action) exec() { act.once.Do(act.execOnce) }
 
 func (act *action) execOnce() {
@@ -343,6 +567,9 @@ func (act *action) execOnce() {
 				continue
 			}
 			// Found a nolint range. Ignore the issue.
+			if rng.directive != nil {
+				rng.directive.markUsed(act.a.Name)
+			}
 			return
 		}
 		act.diagnostics = append(act.diagnostics, d)
@@ -386,11 +613,13 @@ func (act *action) execOnce() {
 }
 
 // load parses and type checks the source code in each file in filenames.
-// load also deserializes facts stored for imported packages.
-func load(packagePath string, imp *importer, filenames []string) (*goPackage, error) {
+// load also deserializes facts stored for imported packages. The cost of
+// each of these phases is recorded in prof if it is not nil.
+func load(packagePath string, imp *importer, filenames []string, prof *nogoProfile) (*goPackage, error) {
 	if len(filenames) == 0 {
 		return nil, errors.New("no filenames")
 	}
+	endParse := prof.startPhase("parse")
 	var syntax []*ast.File
 	for _, file := range filenames {
 		s, err := parser.ParseFile(imp.fset, file, nil, parser.ParseComments)
@@ -399,6 +628,7 @@ func load(packagePath string, imp *importer, filenames []string) (*goPackage, er
 		}
 		syntax = append(syntax, s)
 	}
+	endParse()
 	pkg := &goPackage{fset: imp.fset, syntax: syntax}
 
 	config := types.Config{Importer: imp}
@@ -413,13 +643,18 @@ func load(packagePath string, imp *importer, filenames []string) (*goPackage, er
 
 	initInstanceInfo(info)
 
+	// Type checking includes reading the export data of imported packages.
+	endTypeCheck := prof.startPhase("type_check")
 	types, err := config.Check(packagePath, pkg.fset, syntax, info)
+	endTypeCheck()
 	if err != nil {
 		pkg.illTyped, pkg.typeCheckError = true, err
 	}
 	pkg.types, pkg.typesInfo = types, info
 
+	endDecode := prof.startPhase("facts_decode")
 	pkg.facts, err = facts.NewDecoder(pkg.types).Decode(imp.readFacts)
+	endDecode()
 	if err != nil {
 		return nil, fmt.Errorf("internal error decoding facts: %v", err)
 	}
@@ -455,15 +690,82 @@ func (g *goPackage) String() string {
 	return g.types.Path()
 }
 
+// collectFixes gathers the text edits of the suggested fixes attached to the
+// given diagnostics. Only the first suggested fix of each diagnostic is
+// considered, since additional fixes are alternatives to each other.
+//
+// A fix is applied atomically: if any of its edits overlaps with an edit of a
+// fix that was accepted earlier, the whole fix is dropped. Diagnostics are
+// visited in order, so the fix for the earliest diagnostic wins. The number of
+// dropped fixes is returned along with the accepted edits. Fixes that edit a
+// file that is not in sources are dropped as well, since the patch could not
+// be applied to the workspace.
+func collectFixes(fset *token.FileSet, diagnostics []diagnosticEntry, sources map[string]bool) (fileEdits, int) {
+	edits := make(fileEdits)
+	skipped := 0
+	for _, d := range diagnostics {
+		if d.baselined || len(d.SuggestedFixes) == 0 {
+			continue
+		}
+		fix := d.SuggestedFixes[0]
+		candidate := make(fileEdits)
+		valid := true
+		for _, edit := range fix.TextEdits {
+			file := fset.File(edit.Pos)
+			if file == nil {
+				valid = false
+				break
+			}
+			end := edit.End
+			if !end.IsValid() {
+				end = edit.Pos
+			}
+			if fset.File(end) != file || end < edit.Pos {
+				valid = false
+				break
+			}
+			candidate[file.Name()] = append(candidate[file.Name()], fileEdit{
+				start:   file.Offset(edit.Pos),
+				end:     file.Offset(end),
+				newText: string(edit.NewText),
+			})
+		}
+		if !valid || !onlyEdits(candidate, sources) || conflicts(edits, candidate) {
+			skipped++
+			continue
+		}
+		for filename, fe := range candidate {
+			edits[filename] = mergeEdits(edits[filename], fe)
+		}
+	}
+	return edits, skipped
+}
+
+// diagnosticEntry is a diagnostic together with the analyzer that reported it.
+type diagnosticEntry struct {
+	analysis.Diagnostic
+	*analysis.Analyzer
+	// function is the name of the function declaration enclosing the
+	// diagnostic, if any.
+	function string
+	// fingerprint identifies the diagnostic in the baseline.
+	fingerprint string
+	// baselined is true if the diagnostic is suppressed by the baseline.
+	baselined bool
+	// severity is the configured severity of the analyzer, one of
+	// severityError, severityWarning and severityInfo.
+	severity string
+}
+
 // checkAnalysisResults checks the analysis diagnostics in the given actions
-// and returns a string containing all the diagnostics that should be printed
-// to the build log.
-func checkAnalysisResults(actions []*action, pkg *goPackage) string {
-	type entry struct {
-		analysis.Diagnostic
-		*analysis.Analyzer
-	}
-	var diagnostics []entry
+// and returns a string containing all the diagnostics that should fail the
+// build, a string containing the warnings that should only be printed, the
+// diagnostics themselves in position order and the errors encountered by the
+// analyzers. Diagnostics of analyzers that are configured not to apply to
+// target are dropped. Diagnostics suppressed by the baseline and diagnostics
+// with severity info are returned, but not printed.
+func checkAnalysisResults(actions []*action, pkg *goPackage, target *targetInfo) (string, string, []diagnosticEntry, []error) {
+	var diagnostics []diagnosticEntry
 	var errs []error
 	cwd, err := os.Getwd()
 	if cwd == "" || err != nil {
@@ -501,28 +803,39 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 			if actionConfig.excludeFiles != nil {
 				currentConfig.excludeFiles = actionConfig.excludeFiles
 			}
+			if actionConfig.onlyLabels != nil {
+				currentConfig.onlyLabels = actionConfig.onlyLabels
+			}
+			if actionConfig.excludeLabels != nil {
+				currentConfig.excludeLabels = actionConfig.excludeLabels
+			}
+			if actionConfig.onlyTags != nil {
+				currentConfig.onlyTags = actionConfig.onlyTags
+			}
+			if actionConfig.excludeTags != nil {
+				currentConfig.excludeTags = actionConfig.excludeTags
+			}
+			if actionConfig.severity != "" {
+				currentConfig.severity = actionConfig.severity
+			}
+		}
+		if !target.inScope(currentConfig) {
+			continue
+		}
+		severity := currentConfig.severity
+		if severity == "" {
+			severity = severityError
 		}
 
 		if currentConfig.onlyFiles == nil && currentConfig.excludeFiles == nil {
 			for _, diag := range act.diagnostics {
-				diagnostics = append(diagnostics, entry{Diagnostic: diag, Analyzer: act.a})
+				diagnostics = append(diagnostics, diagnosticEntry{Diagnostic: diag, Analyzer: act.a, severity: severity})
 			}
 			continue
 		}
 		// Discard diagnostics based on the analyzer configuration.
 		for _, d := range act.diagnostics {
-			// NOTE(golang.org/issue/31008): nilness does not set positions,
-			// so don't assume the position is valid.
-			p := pkg.fset.Position(d.Pos)
-			filename := "-"
-			if p.IsValid() {
-				filename = p.Filename
-			}
-			if cwd != "" {
-				if relname, err := filepath.Rel(cwd, filename); err == nil {
-					filename = relname
-				}
-			}
+			filename := relativeFilename(pkg.fset, cwd, d.Pos)
 			include := true
 			if len(currentConfig.onlyFiles) > 0 {
 				// This analyzer emits diagnostics for only a set of files.
@@ -543,7 +856,7 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 				}
 			}
 			if include {
-				diagnostics = append(diagnostics, entry{Diagnostic: d, Analyzer: act.a})
+				diagnostics = append(diagnostics, diagnosticEntry{Diagnostic: d, Analyzer: act.a, severity: severity})
 			}
 		}
 	}
@@ -551,25 +864,75 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 		errs = append(errs, fmt.Errorf("%d analyzers skipped due to type-checking error: %v", numSkipped, pkg.typeCheckError))
 	}
 	if len(diagnostics) == 0 && len(errs) == 0 {
-		return ""
+		return "", "", nil, nil
 	}
 
-	sort.Slice(diagnostics, func(i, j int) bool {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
 		return diagnostics[i].Pos < diagnostics[j].Pos
 	})
+
+	// Suppress the diagnostics recorded in the baseline. They are still
+	// returned, marked as baselined, so that the structured reports can be
+	// used to regenerate the baseline.
+	numReported := 0
+	baselined := make(map[string]int)
+	for i := range diagnostics {
+		d := &diagnostics[i]
+		d.function = enclosingFunction(pkg.fset, pkg.syntax, d.Pos)
+		d.fingerprint = diagnosticFingerprint(d.Name, filepath.ToSlash(relativeFilename(pkg.fset, cwd, d.Pos)), d.function, d.Message)
+		if baselined[d.fingerprint] < baseline[d.fingerprint] {
+			baselined[d.fingerprint]++
+			d.baselined = true
+			continue
+		}
+		numReported++
+	}
+	if numReported == 0 && len(errs) == 0 {
+		return "", "", diagnostics, nil
+	}
+
 	errMsg := &bytes.Buffer{}
-	sep := ""
+	warnMsg := &bytes.Buffer{}
+	sep, warnSep := "", ""
 	for _, err := range errs {
 		errMsg.WriteString(sep)
 		sep = "\n"
 		errMsg.WriteString(err.Error())
 	}
 	for _, d := range diagnostics {
-		errMsg.WriteString(sep)
-		sep = "\n"
-		fmt.Fprintf(errMsg, "%s: %s (%s)", pkg.fset.Position(d.Pos), d.Message, d.Name)
+		if d.baselined {
+			continue
+		}
+		switch d.severity {
+		case severityError:
+			errMsg.WriteString(sep)
+			sep = "\n"
+			fmt.Fprintf(errMsg, "%s: %s (%s)", pkg.fset.Position(d.Pos), d.Message, d.Name)
+		case severityWarning:
+			warnMsg.WriteString(warnSep)
+			warnSep = "\n"
+			fmt.Fprintf(warnMsg, "%s: %s (%s)", pkg.fset.Position(d.Pos), d.Message, d.Name)
+		}
+	}
+	return errMsg.String(), warnMsg.String(), diagnostics, errs
+}
+
+// relativeFilename returns the name of the file containing pos relative to
+// cwd, or "-" if pos is not valid.
+func relativeFilename(fset *token.FileSet, cwd string, pos token.Pos) string {
+	// NOTE(golang.org/issue/31008): nilness does not set positions,
+	// so don't assume the position is valid.
+	p := fset.Position(pos)
+	filename := "-"
+	if p.IsValid() {
+		filename = p.Filename
 	}
-	return errMsg.String()
+	if cwd != "" {
+		if relname, err := filepath.Rel(cwd, filename); err == nil {
+			filename = relname
+		}
+	}
+	return filename
 }
 
 // config determines which source files an analyzer will emit diagnostics for.
@@ -585,10 +948,101 @@ type config struct {
 	// analyzer will not emit diagnostics for.
 	excludeFiles []*regexp.Regexp
 
+	// onlyLabels is a list of target patterns matching the targets an
+	// analyzer will emit diagnostics for. When empty, the analyzer will emit
+	// diagnostics for all targets.
+	onlyLabels []labelPattern
+
+	// excludeLabels is a list of target patterns matching the targets an
+	// analyzer will not emit diagnostics for.
+	excludeLabels []labelPattern
+
+	// onlyTags is a list of tags. When not empty, an analyzer will only emit
+	// diagnostics for targets with at least one of them.
+	onlyTags []string
+
+	// excludeTags is a list of tags. An analyzer will not emit diagnostics for
+	// targets with any of them.
+	excludeTags []string
+
 	// analyzerFlags is a map of flag names to flag values which will be passed
 	// to Analyzer.Flags. Note that no leading '-' should be present in a flag
 	// name
 	analyzerFlags map[string]string
+
+	// severity is the severity of an analyzer's diagnostics. Only diagnostics
+	// with severity error fail the build. When empty, it defaults to
+	// severityError.
+	severity string
+}
+
+// Severities of diagnostics. Keep in sync with buildConfig in
+// generate_nogo_main.go.
+const (
+	// severityError diagnostics are printed and fail the build.
+	severityError = "error"
+	// severityWarning diagnostics are printed, but don't fail the build.
+	severityWarning = "warning"
+	// severityInfo diagnostics are only written to the structured reports.
+	severityInfo = "info"
+)
+
+// targetInfo describes the Bazel target the analyzed package belongs to.
+type targetInfo struct {
+	// label is nil if the label is unknown, in which case label patterns
+	// don't restrict analyzers.
+	label *bazelLabel
+	tags  map[string]bool
+}
+
+func newTargetInfo(label string, tags []string) (*targetInfo, error) {
+	t := &targetInfo{tags: make(map[string]bool)}
+	if label != "" {
+		l, err := parseBazelLabel(label)
+		if err != nil {
+			return nil, err
+		}
+		t.label = &l
+	}
+	for _, tag := range tags {
+		t.tags[tag] = true
+	}
+	return t, nil
+}
+
+// inScope reports whether an analyzer with the given configuration emits
+// diagnostics for the target.
+func (t *targetInfo) inScope(c config) bool {
+	if t.label != nil {
+		if len(c.onlyLabels) > 0 && !matchesAnyPattern(c.onlyLabels, *t.label) {
+			return false
+		}
+		if matchesAnyPattern(c.excludeLabels, *t.label) {
+			return false
+		}
+	}
+	if len(c.onlyTags) > 0 && !t.hasAnyTag(c.onlyTags) {
+		return false
+	}
+	return !t.hasAnyTag(c.excludeTags)
+}
+
+func (t *targetInfo) hasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		if t.tags[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyPattern(patterns []labelPattern, l bazelLabel) bool {
+	for _, p := range patterns {
+		if p.matches(l) {
+			return true
+		}
+	}
+	return false
 }
 
 // importer is an implementation of go/types.Importer that imports type
@@ -655,11 +1109,10 @@ func (i *importer) readFacts(pkgPath string) ([]byte, error) {
 	if facts == "" {
 		// Packages that were not built with the nogo toolchain will not be
 		// analyzed, so there's no opportunity to store facts. This includes
-		// packages in the standard library and packages built with go_tool_library,
-		// such as coverdata. Analyzers are expected to hard code information
-		// about standard library definitions and must gracefully handle packages
-		// that don't have facts. For example, the "printf" analyzer must know
-		// fmt.Printf accepts a format string.
+		// packages built with go_tool_library, such as coverdata. Facts for
+		// the standard library are computed by the nogostdlib builder verb,
+		// but may be incomplete for packages using cgo. Analyzers must
+		// gracefully handle packages that don't have facts.
 		return nil, nil
 	}
 	return os.ReadFile(facts)
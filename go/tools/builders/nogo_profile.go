@@ -0,0 +1,85 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// nogoProfile records the wall time and memory nogo spends on a package,
+// broken down by the phases of loading the package and by analyzer. It is
+// written as JSON to the nogo_profile output group and merged across
+// packages by the nogo_profile tool.
+type nogoProfile struct {
+	Package   string             `json:"package"`
+	Phases    []nogoProfileEntry `json:"phases"`
+	Analyzers []nogoProfileEntry `json:"analyzers"`
+}
+
+type nogoProfileEntry struct {
+	Name string `json:"name"`
+	// WallNanos is the elapsed wall time in nanoseconds.
+	WallNanos int64 `json:"wall_ns"`
+	// AllocBytes is the number of heap bytes allocated, whether or not they
+	// were freed since.
+	AllocBytes uint64 `json:"alloc_bytes"`
+}
+
+func newNogoProfile(packagePath string) *nogoProfile {
+	return &nogoProfile{
+		Package:   packagePath,
+		Phases:    []nogoProfileEntry{},
+		Analyzers: []nogoProfileEntry{},
+	}
+}
+
+// startPhase starts measuring a phase of checking the package and returns a
+// function that ends the measurement. It does nothing on a nil profile, so
+// callers don't need to check whether profiling is enabled.
+func (p *nogoProfile) startPhase(name string) func() {
+	if p == nil {
+		return func() {}
+	}
+	stop := startMeasurement(name)
+	return func() { p.Phases = append(p.Phases, stop()) }
+}
+
+// startAnalyzer is like startPhase, but for running an analyzer. Allocations
+// can only be attributed to a single analyzer if analyzers don't run
+// concurrently.
+func (p *nogoProfile) startAnalyzer(name string) func() {
+	if p == nil {
+		return func() {}
+	}
+	stop := startMeasurement(name)
+	return func() { p.Analyzers = append(p.Analyzers, stop()) }
+}
+
+func startMeasurement(name string) func() nogoProfileEntry {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	alloc := m.TotalAlloc
+	start := time.Now()
+	return func() nogoProfileEntry {
+		wall := time.Since(start)
+		runtime.ReadMemStats(&m)
+		return nogoProfileEntry{
+			Name:       name,
+			WallNanos:  wall.Nanoseconds(),
+			AllocBytes: m.TotalAlloc - alloc,
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var sink []byte
+
+func TestNogoProfile(t *testing.T) {
+	// Profiling is disabled with a nil profile.
+	var disabled *nogoProfile
+	disabled.startPhase("parse")()
+	disabled.startAnalyzer("printf")()
+
+	p := newNogoProfile("example.com/p")
+	endPhase := p.startPhase("parse")
+	time.Sleep(time.Millisecond)
+	endPhase()
+	endAnalyzer := p.startAnalyzer("printf")
+	sink = make([]byte, 1<<20)
+	endAnalyzer()
+
+	if len(p.Phases) != 1 || p.Phases[0].Name != "parse" || p.Phases[0].WallNanos < int64(time.Millisecond) {
+		t.Errorf("unexpected phases: %+v", p.Phases)
+	}
+	if len(p.Analyzers) != 1 || p.Analyzers[0].Name != "printf" || p.Analyzers[0].AllocBytes < 1<<20 {
+		t.Errorf("unexpected analyzers: %+v", p.Analyzers)
+	}
+}
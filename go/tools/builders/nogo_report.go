@@ -0,0 +1,307 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Machine-readable reports of the diagnostics found by nogo.
+// The code in this file is compiled into the nogo binary together with
+// nogo_main.go.
+
+package main
+
+import (
+	"go/token"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// jsonReport encodes the diagnostics in result as JSON.
+func jsonReport(packagePath string, result *checkResult) ([]byte, error) {
+	conv := newPositionConverter(result.fset)
+	report := newJSONReportData(packagePath)
+	for _, d := range result.entries {
+		jd := jsonDiagnostic{
+			Analyzer: d.Analyzer.Name,
+			Severity: d.severity,
+			Category: d.Category,
+			Message:  d.Message,
+			URL:      diagnosticURL(d.Analyzer, d.Diagnostic),
+			Start:    conv.json(d.Pos),
+			End:      conv.jsonEnd(d.End),
+
+			Function:    d.function,
+			Fingerprint: d.fingerprint,
+			Baselined:   d.baselined,
+		}
+		for _, r := range d.Related {
+			jd.Related = append(jd.Related, jsonRelated{
+				Message: r.Message,
+				Start:   conv.json(r.Pos),
+				End:     conv.jsonEnd(r.End),
+			})
+		}
+		for _, fix := range d.SuggestedFixes {
+			jf := jsonSuggestedFix{Message: fix.Message, Edits: []jsonTextEdit{}}
+			for _, edit := range fix.TextEdits {
+				end := edit.End
+				if !end.IsValid() {
+					end = edit.Pos
+				}
+				jf.Edits = append(jf.Edits, jsonTextEdit{
+					Start:   conv.json(edit.Pos),
+					End:     conv.json(end),
+					NewText: string(edit.NewText),
+				})
+			}
+			jd.SuggestedFixes = append(jd.SuggestedFixes, jf)
+		}
+		report.Diagnostics = append(report.Diagnostics, jd)
+	}
+	for _, err := range result.errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	return report.encode()
+}
+
+// sarifReport encodes the diagnostics in result as a SARIF 2.1.0 log with a
+// single run. Every analyzer linked into nogo is listed as a rule.
+func sarifReport(result *checkResult) ([]byte, error) {
+	conv := newPositionConverter(result.fset)
+	ruleIndex := make(map[string]int)
+	run := newSarifRun()
+	for _, a := range analyzers {
+		ruleIndex[a.Name] = len(run.Tool.Driver.Rules)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRuleFor(a))
+	}
+
+	for _, d := range result.entries {
+		index, ok := ruleIndex[d.Analyzer.Name]
+		if !ok {
+			// Diagnostics reported by analyzers that nogo adds itself.
+			index = len(run.Tool.Driver.Rules)
+			ruleIndex[d.Analyzer.Name] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRuleFor(d.Analyzer))
+		}
+		sr := sarifResult{
+			RuleID:    d.Analyzer.Name,
+			RuleIndex: index,
+			Level:     sarifLevel(d.severity),
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{conv.sarifLocation(d.Pos, d.End)},
+		}
+		if d.fingerprint != "" {
+			sr.PartialFingerprints = map[string]string{"nogo/v1": d.fingerprint}
+		}
+		if d.baselined {
+			sr.Suppressions = []sarifSuppression{{
+				Kind:          "external",
+				Justification: "recorded in the nogo baseline",
+			}}
+		}
+		if d.Category != "" {
+			sr.Properties = map[string]interface{}{"category": d.Category}
+		}
+		for i, r := range d.Related {
+			id := i
+			loc := conv.sarifLocation(r.Pos, r.End)
+			loc.ID = &id
+			loc.Message = &sarifMessage{Text: r.Message}
+			sr.RelatedLocations = append(sr.RelatedLocations, loc)
+		}
+		for _, fix := range d.SuggestedFixes {
+			sr.Fixes = append(sr.Fixes, conv.sarifFix(fix))
+		}
+		run.Results = append(run.Results, sr)
+	}
+	if len(result.errs) > 0 {
+		invocation := sarifInvocation{ExecutionSuccessful: false}
+		for _, err := range result.errs {
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+				Level:   "error",
+				Message: sarifMessage{Text: err.Error()},
+			})
+		}
+		run.Invocations = []sarifInvocation{invocation}
+	}
+
+	return encodeSarifLog(run)
+}
+
+// sarifLevel returns the SARIF level of a diagnostic with the given severity.
+func sarifLevel(severity string) string {
+	switch severity {
+	case severityWarning:
+		return "warning"
+	case severityInfo:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+func sarifRuleFor(a *analysis.Analyzer) sarifRule {
+	rule := sarifRule{ID: a.Name, HelpURI: a.URL}
+	if doc := strings.TrimSpace(a.Doc); doc != "" {
+		short := doc
+		if i := strings.Index(short, "\n\n"); i >= 0 {
+			short = short[:i]
+		}
+		rule.ShortDescription = &sarifMessage{Text: strings.TrimSpace(short)}
+		rule.FullDescription = &sarifMessage{Text: doc}
+	}
+	return rule
+}
+
+// diagnosticURL returns the documentation URL of d, resolved relative to the
+// URL of the analyzer a as described by analysis.Diagnostic.URL.
+func diagnosticURL(a *analysis.Analyzer, d analysis.Diagnostic) string {
+	ref := d.URL
+	if ref == "" && d.Category != "" {
+		ref = "#" + d.Category
+	}
+	if ref == "" {
+		return ""
+	}
+	base, err := url.Parse(a.URL)
+	if err != nil {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// positionConverter converts token.Pos values to the positions used in the
+// reports. Filenames are made relative to the working directory of nogo,
+// which is the execution root.
+type positionConverter struct {
+	fset     *token.FileSet
+	cwd      string
+	contents map[string][]byte
+}
+
+func newPositionConverter(fset *token.FileSet) *positionConverter {
+	cwd, _ := os.Getwd()
+	return &positionConverter{fset: fset, cwd: cwd, contents: make(map[string][]byte)}
+}
+
+func (c *positionConverter) filename(name string) string {
+	if c.cwd != "" {
+		if rel, err := filepath.Rel(c.cwd, name); err == nil {
+			name = rel
+		}
+	}
+	return filepath.ToSlash(name)
+}
+
+func (c *positionConverter) json(pos token.Pos) jsonPosition {
+	// NOTE(golang.org/issue/31008): nilness does not set positions,
+	// so don't assume the position is valid.
+	p := c.fset.Position(pos)
+	if !p.IsValid() {
+		return jsonPosition{Filename: "-"}
+	}
+	return jsonPosition{
+		Filename: c.filename(p.Filename),
+		Offset:   p.Offset,
+		Line:     p.Line,
+		Column:   p.Column,
+	}
+}
+
+func (c *positionConverter) jsonEnd(end token.Pos) *jsonPosition {
+	if !end.IsValid() {
+		return nil
+	}
+	p := c.json(end)
+	return &p
+}
+
+// runeColumn converts the byte-based column of p to a 1-based column
+// counting Unicode code points, as declared by the SARIF run's columnKind.
+func (c *positionConverter) runeColumn(p token.Position) int {
+	content, ok := c.contents[p.Filename]
+	if !ok {
+		content, _ = os.ReadFile(p.Filename)
+		c.contents[p.Filename] = content
+	}
+	lineStart := p.Offset - (p.Column - 1)
+	if lineStart < 0 || p.Offset > len(content) {
+		return p.Column
+	}
+	return utf8.RuneCount(content[lineStart:p.Offset]) + 1
+}
+
+func (c *positionConverter) sarifRegion(pos, end token.Pos) *sarifRegion {
+	start := c.fset.Position(pos)
+	if !start.IsValid() {
+		return nil
+	}
+	region := &sarifRegion{StartLine: start.Line, StartColumn: c.runeColumn(start)}
+	if e := c.fset.Position(end); end.IsValid() && e.IsValid() {
+		region.EndLine, region.EndColumn = e.Line, c.runeColumn(e)
+	}
+	return region
+}
+
+func (c *positionConverter) sarifArtifact(pos token.Pos) sarifArtifactLocation {
+	p := c.fset.Position(pos)
+	if !p.IsValid() {
+		return sarifArtifactLocation{URI: "-"}
+	}
+	u := url.URL{Path: c.filename(p.Filename)}
+	return sarifArtifactLocation{URI: u.String(), URIBaseID: sarifSrcRoot}
+}
+
+func (c *positionConverter) sarifLocation(pos, end token.Pos) sarifLocation {
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: c.sarifArtifact(pos),
+		Region:           c.sarifRegion(pos, end),
+	}}
+}
+
+func (c *positionConverter) sarifFix(fix analysis.SuggestedFix) sarifFix {
+	sf := sarifFix{
+		Description:     sarifMessage{Text: fix.Message},
+		ArtifactChanges: []sarifArtifactChange{},
+	}
+	changes := make(map[string]int)
+	for _, edit := range fix.TextEdits {
+		end := edit.End
+		if !end.IsValid() {
+			end = edit.Pos
+		}
+		artifact := c.sarifArtifact(edit.Pos)
+		i, ok := changes[artifact.URI]
+		if !ok {
+			i = len(sf.ArtifactChanges)
+			changes[artifact.URI] = i
+			sf.ArtifactChanges = append(sf.ArtifactChanges, sarifArtifactChange{ArtifactLocation: artifact})
+		}
+		replacement := sarifReplacement{}
+		if region := c.sarifRegion(edit.Pos, end); region != nil {
+			replacement.DeletedRegion = *region
+		}
+		if len(edit.NewText) > 0 {
+			replacement.InsertedContent = &sarifMessage{Text: string(edit.NewText)}
+		}
+		sf.ArtifactChanges[i].Replacements = append(sf.ArtifactChanges[i].Replacements, replacement)
+	}
+	return sf
+}
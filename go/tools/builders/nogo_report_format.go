@@ -0,0 +1,223 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The structure of the machine-readable nogo reports. The code in this file
+// is compiled into both the nogo binary and the builder, which writes the
+// reports itself for packages that nogo doesn't run on.
+
+package main
+
+import "encoding/json"
+
+// jsonReportData is the top-level object of the JSON report written with
+// -json. It describes the diagnostics for a single package.
+type jsonReportData struct {
+	Package     string           `json:"package"`
+	Diagnostics []jsonDiagnostic `json:"diagnostics"`
+	Errors      []string         `json:"errors,omitempty"`
+}
+
+type jsonDiagnostic struct {
+	Analyzer       string             `json:"analyzer"`
+	Severity       string             `json:"severity"`
+	Category       string             `json:"category,omitempty"`
+	Message        string             `json:"message"`
+	URL            string             `json:"url,omitempty"`
+	Start          jsonPosition       `json:"start"`
+	End            *jsonPosition      `json:"end,omitempty"`
+	Related        []jsonRelated      `json:"related,omitempty"`
+	SuggestedFixes []jsonSuggestedFix `json:"suggested_fixes,omitempty"`
+	// Function is the name of the enclosing function declaration.
+	Function string `json:"function,omitempty"`
+	// Fingerprint identifies the diagnostic in a nogo baseline.
+	Fingerprint string `json:"fingerprint"`
+	// Baselined is true if the diagnostic is suppressed by the baseline and
+	// thus isn't printed to the build log.
+	Baselined bool `json:"baselined,omitempty"`
+}
+
+// jsonPosition is a source position. Filename is relative to the execution
+// root, Line and Column are 1-based and Column and Offset count bytes.
+type jsonPosition struct {
+	Filename string `json:"filename"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+type jsonRelated struct {
+	Message string        `json:"message"`
+	Start   jsonPosition  `json:"start"`
+	End     *jsonPosition `json:"end,omitempty"`
+}
+
+type jsonSuggestedFix struct {
+	Message string         `json:"message"`
+	Edits   []jsonTextEdit `json:"edits"`
+}
+
+type jsonTextEdit struct {
+	Start   jsonPosition `json:"start"`
+	End     jsonPosition `json:"end"`
+	NewText string       `json:"new_text"`
+}
+
+// newJSONReportData returns the JSON report for a package without
+// diagnostics.
+func newJSONReportData(packagePath string) *jsonReportData {
+	return &jsonReportData{
+		Package:     packagePath,
+		Diagnostics: []jsonDiagnostic{},
+	}
+}
+
+func (r *jsonReportData) encode() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// The following types implement the subset of the SARIF 2.1.0 object model
+// used by nogo. See
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// sarifSrcRoot is the base ID of artifact locations, which are relative
+	// to the root of the workspace.
+	sarifSrcRoot = "%SRCROOT%"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	ColumnKind  string            `json:"columnKind"`
+	Results     []sarifResult     `json:"results"`
+	Invocations []sarifInvocation `json:"invocations,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string        `json:"id"`
+	ShortDescription *sarifMessage `json:"shortDescription,omitempty"`
+	FullDescription  *sarifMessage `json:"fullDescription,omitempty"`
+	HelpURI          string        `json:"helpUri,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix      `json:"fixes,omitempty"`
+	// PartialFingerprints identify the result across runs, see
+	// diagnosticFingerprint.
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	Suppressions        []sarifSuppression     `json:"suppressions,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion   `json:"deletedRegion"`
+	InsertedContent *sarifMessage `json:"insertedContent,omitempty"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+// newSarifRun returns a run of nogo without rules and results.
+func newSarifRun() sarifRun {
+	return sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "nogo",
+			InformationURI: "https://github.com/bazelbuild/rules_go/blob/master/go/nogo.rst",
+			Rules:          []sarifRule{},
+		}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+}
+
+// encodeSarifLog encodes a SARIF log with the single run.
+func encodeSarifLog(run sarifRun) ([]byte, error) {
+	return json.MarshalIndent(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+}
@@ -0,0 +1,269 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file implements the standalone nogo driver, which runs the analyzers
+// outside of Bazel builds on packages loaded with golang.org/x/tools/go/packages.
+// It is generated from the same template as the nogo binary run by the
+// builder and only compiled into the standalone driver.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// standaloneMain is the entry point of the standalone nogo driver.
+func standaloneMain() {
+	log.SetFlags(0) // no timestamp
+	log.SetPrefix("nogo: ")
+	if err, exitCode := runStandalone(os.Args[1:]); err != nil {
+		log.Print(err)
+		os.Exit(exitCode)
+	}
+}
+
+// runStandalone loads the packages matching the patterns in args together with
+// their dependencies and checks them in dependency order. Diagnostics are only
+// reported for the packages matching the patterns. Facts are computed for all
+// packages.
+func runStandalone(args []string) (error, int) {
+	flags := flag.NewFlagSet("nogo", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [-test] [-tags=tag,...] [package pattern...]\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	tests := flags.Bool("test", false, "Also check the test packages of the matching packages")
+	buildTags := flags.String("tags", "", "Comma-separated list of build tags to apply when loading packages")
+	flags.Parse(args)
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	// Report paths relative to the workspace when run with "bazel run".
+	if dir := os.Getenv("BUILD_WORKSPACE_DIRECTORY"); dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("error changing to the workspace directory: %v", err), nogoError
+		}
+	}
+	if os.Getenv("GOARCH") == "" {
+		typesSizes = types.SizesFor("gc", runtime.GOARCH)
+	}
+
+	cfg := &packages.Config{
+		// Type information is computed by checkPackage. go/packages only needs
+		// to provide the files and the import graph, which a GOPACKAGESDRIVER
+		// such as the one in rules_go can do without building the packages.
+		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedDeps,
+		Tests: *tests,
+	}
+	if *buildTags != "" {
+		cfg.BuildFlags = []string{"-tags=" + *buildTags}
+	}
+	roots, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return fmt.Errorf("error loading packages: %v", err), nogoError
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("no packages match %s", strings.Join(patterns, " ")), nogoError
+	}
+	if packages.PrintErrors(roots) > 0 {
+		return errors.New("errors loading packages"), nogoError
+	}
+
+	factsDir, err := os.MkdirTemp("", "nogo")
+	if err != nil {
+		return fmt.Errorf("error creating facts directory: %v", err), nogoError
+	}
+	defer os.RemoveAll(factsDir)
+
+	pkgs := checkStandalonePackages(roots, factsDir)
+
+	var diagnostics, warnings []string
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if !pkg.root {
+			continue
+		}
+		// Test variants of a package share files with the package, so the
+		// same diagnostic may be reported more than once.
+		for _, text := range []string{pkg.err, pkg.diagnostics} {
+			for _, line := range splitDiagnostics(text) {
+				if !seen[line] {
+					seen[line] = true
+					diagnostics = append(diagnostics, line)
+				}
+			}
+		}
+		for _, line := range splitDiagnostics(pkg.warnings) {
+			if !seen[line] {
+				seen[line] = true
+				warnings = append(warnings, line)
+			}
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("nogo failed to get CWD: %w", err), nogoError
+	}
+	if len(warnings) > 0 {
+		log.Printf("warnings found by nogo during code analysis:\n%s\n", relativizeStandalonePaths(strings.Join(warnings, "\n"), cwd))
+	}
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("errors found by nogo during code analysis:\n%s\n", relativizeStandalonePaths(strings.Join(diagnostics, "\n"), cwd)), nogoViolation
+	}
+	return nil, nogoSuccess
+}
+
+// standalonePackage is a package loaded by go/packages together with the
+// results of checking it.
+type standalonePackage struct {
+	*packages.Package
+	// root is true if the package matches the patterns on the command line.
+	root bool
+	// done is closed once the package has been checked.
+	done chan struct{}
+	// types and factsPath are needed to check the importers of the package.
+	// They are empty if the package could not be checked.
+	types     *types.Package
+	factsPath string
+	// diagnostics, warnings and err are only reported for roots.
+	diagnostics, warnings, err string
+}
+
+// checkStandalonePackages checks the packages in the import graph of roots,
+// as many at a time as there are CPUs. A package is checked once all its
+// dependencies are. All packages share a single FileSet, so that positions
+// of imported objects are valid in their importers. The facts of each package
+// are written to factsDir. The packages are returned in dependency order.
+func checkStandalonePackages(roots []*packages.Package, factsDir string) []*standalonePackage {
+	var pkgs []*standalonePackage
+	byPkg := make(map[*packages.Package]*standalonePackage)
+	packages.Visit(roots, nil, func(p *packages.Package) {
+		pkg := &standalonePackage{Package: p, done: make(chan struct{})}
+		byPkg[p] = pkg
+		pkgs = append(pkgs, pkg)
+	})
+	for _, root := range roots {
+		byPkg[root].root = true
+	}
+
+	fset := token.NewFileSet()
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, pkg := range pkgs {
+		wg.Add(1)
+		go func(i int, pkg *standalonePackage) {
+			defer wg.Done()
+			defer close(pkg.done)
+			for _, dep := range pkg.Imports {
+				<-byPkg[dep].done
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			factsPath := filepath.Join(factsDir, fmt.Sprintf("%d.facts", i))
+			if err := checkStandalonePackage(pkg, byPkg, fset, factsPath); err != nil {
+				pkg.err = fmt.Sprintf("%s: %v", pkg.ID, err)
+			}
+		}(i, pkg)
+	}
+	wg.Wait()
+	return pkgs
+}
+
+// checkStandalonePackage runs the analyzers on pkg. The types and facts of its
+// dependencies are passed to the analyzers just like the builder passes export
+// data and facts files to the nogo binary.
+func checkStandalonePackage(pkg *standalonePackage, byPkg map[*packages.Package]*standalonePackage, fset *token.FileSet, factsPath string) error {
+	if pkg.PkgPath == "unsafe" || len(pkg.CompiledGoFiles) == 0 {
+		// unsafe is known to the importer. Packages without Go files, e.g. those
+		// with only assembly, can't be imported by Go code.
+		return nil
+	}
+
+	importMap := make(map[string]string)
+	factMap := make(map[string]string)
+	imp := newImporter(importMap, nil, factMap)
+	imp.fset = fset
+	for path, dep := range pkg.Imports {
+		if path != dep.PkgPath {
+			importMap[path] = dep.PkgPath
+		}
+		if d := byPkg[dep]; d.types != nil {
+			imp.packageCache[dep.PkgPath] = d.types
+			factMap[dep.PkgPath] = d.factsPath
+		}
+	}
+
+	// Files generated by cgo are checked, but their diagnostics are ignored
+	// just like in the build.
+	goFiles := make(map[string]bool)
+	for _, f := range pkg.GoFiles {
+		goFiles[f] = true
+	}
+	var ignores []string
+	for _, f := range pkg.CompiledGoFiles {
+		if !goFiles[f] {
+			ignores = append(ignores, f)
+		}
+	}
+
+	// The rules_go GOPACKAGESDRIVER uses labels as package IDs, so analyzers
+	// are scoped by label patterns just like in the build. Tags are unknown.
+	label := ""
+	if _, err := parseBazelLabel(pkg.ID); err == nil {
+		label = pkg.ID
+	}
+	target, err := newTargetInfo(label, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := checkPackage(analyzers, pkg.PkgPath, imp, pkg.CompiledGoFiles, ignores, target, nil)
+	if err != nil {
+		return fmt.Errorf("error running analyzers: %v", err)
+	}
+	if err := os.WriteFile(factsPath, result.facts, 0o666); err != nil {
+		return fmt.Errorf("error writing facts: %v", err)
+	}
+	pkg.types, pkg.factsPath = result.types, factsPath
+	pkg.diagnostics, pkg.warnings = result.diagnostics, result.warnings
+	return nil
+}
+
+// splitDiagnostics splits the diagnostics printed by nogo into lines.
+func splitDiagnostics(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// relativizeStandalonePaths makes the absolute paths returned by go/packages
+// relative to cwd, like the paths in the build log.
+func relativizeStandalonePaths(text, cwd string) string {
+	return strings.ReplaceAll(text, cwd+string(filepath.Separator), "")
+}
@@ -0,0 +1,269 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stdlibNogoPackage is a package of the standard library that nogo computes
+// facts for.
+type stdlibNogoPackage struct {
+	// path is the package path, e.g. "vendor/golang.org/x/net/dns/dnsmessage".
+	path string
+	// srcs are the absolute paths of the package's Go files.
+	srcs []string
+	// deps are the paths of the imported packages that nogo computes facts
+	// for.
+	deps []string
+}
+
+// nogoStdlib runs nogo on the packages of the standard library in dependency
+// order and writes the facts of each package to <out>/<package path>.facts.
+// The nogo verb passes these files to nogo for the standard library imports
+// of a package, so that analyzers see facts about the standard library just
+// as they see facts about other dependencies.
+func nogoStdlib(args []string) error {
+	args, _, err := expandParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("nogostdlib", flag.ExitOnError)
+	goenv := envFlags(flags)
+	nogoPath := flags.String("nogo", "", "The nogo binary")
+	out := flags.String("out", "", "The directory to write the facts of each package to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.checkFlagsAndSetGoroot(); err != nil {
+		return err
+	}
+	goroot := os.Getenv("GOROOT")
+	if goroot == "" {
+		return errors.New("GOROOT not set")
+	}
+	goroot = abs(goroot)
+	outDir := abs(*out)
+
+	// Packages are only looked up in GOROOT.
+	os.Setenv("GO111MODULE", "off")
+
+	archives, err := listStdlibArchives(goroot, goenv.installSuffix)
+	if err != nil {
+		return err
+	}
+	// The sources are read from the SDK since GOROOT only contains archives
+	// if the standard library is built by rules_go.
+	pkgs, err := listStdlibNogoPackages(abs(goenv.sdk), archives)
+	if err != nil {
+		return err
+	}
+
+	workDir, cleanup, err := goenv.workDir()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	importcfgPath := filepath.Join(workDir, "importcfg")
+	if err := os.WriteFile(importcfgPath, stdlibImportcfg(archives), 0o666); err != nil {
+		return err
+	}
+	return runNogoOnStdlib(abs(*nogoPath), importcfgPath, workDir, outDir, pkgs)
+}
+
+// listStdlibArchives returns a map from the path of each package of the
+// standard library for which there is export data to the archive holding it.
+func listStdlibArchives(goroot, installSuffix string) (map[string]string, error) {
+	pkgDir := filepath.Join(goroot, "pkg", installSuffix)
+	archives := make(map[string]string)
+	err := filepath.WalkDir(pkgDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".a") {
+			return nil
+		}
+		rel, err := filepath.Rel(pkgDir, path)
+		if err != nil {
+			return err
+		}
+		archives[filepath.ToSlash(strings.TrimSuffix(rel, ".a"))] = path
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing standard library archives: %v", err)
+	}
+	return archives, nil
+}
+
+// listStdlibNogoPackages returns the packages of the standard library in the
+// SDK at sdk that have archives and that nogo can analyze, sorted by path.
+func listStdlibNogoPackages(sdk string, archives map[string]string) ([]*stdlibNogoPackage, error) {
+	bctx := build.Default
+	bctx.GOROOT = sdk
+	bctx.GOPATH = ""
+	// nogo can't type-check cgo files without running cgo first. Analyze the
+	// pure Go variant of the packages instead, which may lack facts about
+	// objects only declared in cgo files.
+	bctx.CgoEnabled = false
+
+	paths := make([]string, 0, len(archives))
+	for path := range archives {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	byPath := make(map[string]*stdlibNogoPackage)
+	var pkgs []*stdlibNogoPackage
+	var bpkgs []*build.Package
+	for _, path := range paths {
+		bp, err := bctx.Import(path, "", 0)
+		if err != nil {
+			// For example, runtime/cgo has no Go files without cgo.
+			var noGoErr *build.NoGoError
+			if errors.As(err, &noGoErr) {
+				continue
+			}
+			return nil, fmt.Errorf("error loading standard library package %s: %v", path, err)
+		}
+		pkg := &stdlibNogoPackage{path: path}
+		for _, f := range bp.GoFiles {
+			pkg.srcs = append(pkg.srcs, filepath.Join(bp.Dir, f))
+		}
+		byPath[path] = pkg
+		pkgs = append(pkgs, pkg)
+		bpkgs = append(bpkgs, bp)
+	}
+
+	// Resolve imports of vendored packages, e.g. golang.org/x/net/dns/dnsmessage
+	// imported by net refers to vendor/golang.org/x/net/dns/dnsmessage.
+	for i, pkg := range pkgs {
+		bp := bpkgs[i]
+		for _, imp := range bp.Imports {
+			dep, err := bctx.Import(imp, bp.Dir, build.FindOnly)
+			if err != nil {
+				continue
+			}
+			if _, ok := byPath[dep.ImportPath]; ok && dep.ImportPath != pkg.path {
+				pkg.deps = append(pkg.deps, dep.ImportPath)
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// stdlibImportcfg returns an importcfg file for nogo listing all archives of
+// the standard library.
+func stdlibImportcfg(archives map[string]string) []byte {
+	paths := make([]string, 0, len(archives))
+	for path := range archives {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	buf := &bytes.Buffer{}
+	for _, path := range paths {
+		if vendored := strings.TrimPrefix(path, "vendor/"); vendored != path {
+			fmt.Fprintf(buf, "importmap %s=%s\n", vendored, path)
+		}
+		fmt.Fprintf(buf, "packagefile %s=%s\n", path, archives[path])
+	}
+	return buf.Bytes()
+}
+
+// stdlibFactsPath returns the path of the facts file of the standard library
+// package with the given path below dir.
+func stdlibFactsPath(dir, path string) string {
+	return filepath.Join(dir, filepath.FromSlash(path)+".facts")
+}
+
+// runNogoOnStdlib runs nogo on all packages, as many at a time as there are
+// CPUs. A package is analyzed once the facts of all its dependencies are
+// available. If nogo fails on a package, the error is logged and the package
+// gets an empty facts file, so that the analysis of the other packages and of
+// the build can proceed without its facts.
+func runNogoOnStdlib(nogoPath, importcfgPath, workDir, outDir string, pkgs []*stdlibNogoPackage) error {
+	done := make(map[string]chan struct{})
+	for _, pkg := range pkgs {
+		done[pkg.path] = make(chan struct{})
+	}
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []string
+	for _, pkg := range pkgs {
+		wg.Add(1)
+		go func(pkg *stdlibNogoPackage) {
+			defer wg.Done()
+			defer close(done[pkg.path])
+			for _, dep := range pkg.deps {
+				<-done[dep]
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			err := runNogoOnStdlibPackage(nogoPath, importcfgPath, workDir, outDir, pkg)
+			if err == nil {
+				return
+			}
+			log.Print(err)
+			if err := os.WriteFile(stdlibFactsPath(outDir, pkg.path), nil, 0o666); err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(pkg)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func runNogoOnStdlibPackage(nogoPath, importcfgPath, workDir, outDir string, pkg *stdlibNogoPackage) error {
+	outPath := stdlibFactsPath(outDir, pkg.path)
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o777); err != nil {
+		return err
+	}
+	args := []string{"-p", pkg.path, "-importcfg", importcfgPath, "-x", outPath, "-facts_only"}
+	for _, dep := range pkg.deps {
+		args = append(args, "-fact", fmt.Sprintf("%s=%s", dep, stdlibFactsPath(outDir, dep)))
+	}
+	args = append(args, pkg.srcs...)
+
+	paramsFile := filepath.Join(workDir, strings.ReplaceAll(pkg.path, "/", "_")+".param")
+	if err := writeParamsFile(paramsFile, args); err != nil {
+		return fmt.Errorf("error writing nogo params file: %v", err)
+	}
+	cmd := exec.Command(nogoPath, "-param="+paramsFile)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error running nogo on %s: %v\n%s", pkg.path, err, relativizePaths(out))
+	}
+	return nil
+}
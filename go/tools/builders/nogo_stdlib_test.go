@@ -0,0 +1,113 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestListStdlibNogoPackages(t *testing.T) {
+	sdk := t.TempDir()
+	for name, content := range map[string]string{
+		"src/a/a.go":                      "package a\n\nimport (\n\t\"b\"\n\t\"golang.org/x/v\"\n\t\"unsafe\"\n)\n",
+		"src/a/a_test.go":                 "package a\n",
+		"src/b/b.go":                      "package b\n",
+		"src/c/c.go":                      "package c\n\nimport \"C\"\n",
+		"src/vendor/golang.org/x/v/v.go":  "package v\n\nimport \"b\"\n",
+		"src/vendor/golang.org/x/v/v_x.s": "",
+	} {
+		path := filepath.Join(sdk, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archives := map[string]string{
+		"a":                     "pkg/a.a",
+		"b":                     "pkg/b.a",
+		"c":                     "pkg/c.a",
+		"vendor/golang.org/x/v": "pkg/vendor/golang.org/x/v.a",
+	}
+	t.Setenv("GO111MODULE", "off")
+
+	pkgs, err := listStdlibNogoPackages(sdk, archives)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for _, pkg := range pkgs {
+		got[pkg.path] = pkg.deps
+		if len(pkg.srcs) != 1 {
+			t.Errorf("%s: got sources %v, want exactly one", pkg.path, pkg.srcs)
+		}
+	}
+	want := map[string][]string{
+		"a":                     {"b", "vendor/golang.org/x/v"},
+		"b":                     nil,
+		"vendor/golang.org/x/v": {"b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got packages %v, want %v", got, want)
+	}
+}
+
+func TestStdlibImportcfg(t *testing.T) {
+	got := string(stdlibImportcfg(map[string]string{
+		"fmt":                          "/goroot/pkg/linux_amd64/fmt.a",
+		"vendor/golang.org/x/net/idna": "/goroot/pkg/linux_amd64/vendor/golang.org/x/net/idna.a",
+	}))
+	want := `packagefile fmt=/goroot/pkg/linux_amd64/fmt.a
+importmap golang.org/x/net/idna=vendor/golang.org/x/net/idna
+packagefile vendor/golang.org/x/net/idna=/goroot/pkg/linux_amd64/vendor/golang.org/x/net/idna.a
+`
+	if got != want {
+		t.Errorf("got importcfg:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRunNogoOnStdlibFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the nogo binary")
+	}
+	dir := t.TempDir()
+	nogoPath := filepath.Join(dir, "nogo")
+	if err := os.WriteFile(nogoPath, []byte("#!/bin/sh\necho analyzer panicked >&2\nexit 1\n"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(dir, "out")
+	pkgs := []*stdlibNogoPackage{
+		{path: "a", deps: []string{"vendor/golang.org/x/v"}},
+		{path: "vendor/golang.org/x/v"},
+	}
+
+	if err := runNogoOnStdlib(nogoPath, "importcfg", dir, outDir, pkgs); err != nil {
+		t.Fatalf("got error %v, want failures to be logged", err)
+	}
+	for _, pkg := range pkgs {
+		data, err := os.ReadFile(stdlibFactsPath(outDir, pkg.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 0 {
+			t.Errorf("%s: got facts %q, want none", pkg.path, data)
+		}
+	}
+}
@@ -14,7 +14,18 @@
 
 package main
 
-import "strings"
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// nolintlintName is the name of the analyzer that reports problems with
+// nolint directives.
+const nolintlintName = "nolintlint"
 
 // Parse nolint directives and return the applicable linters. If all linters
 // apply, returns (nil, true).
@@ -42,3 +53,122 @@ func parseNolint(text string) (map[string]bool, bool) {
 	}
 	return result, true
 }
+
+// hasNolintExplanation reports whether a nolint directive is followed by an
+// explanation comment, as in "//nolint:foo // the foo lint is wrong here".
+func hasNolintExplanation(text string) bool {
+	text = strings.TrimLeft(text, "/ ")
+	i := strings.Index(text, "//")
+	return i >= 0 && strings.TrimSpace(text[i+2:]) != ""
+}
+
+// nolintDirective is a single //nolint comment in the analyzed package. It
+// records the analyzers it suppressed diagnostics for, so that unused
+// directives can be reported.
+type nolintDirective struct {
+	pos, end token.Pos
+	// text is the directive without the explanation, e.g. "//nolint:foo".
+	text string
+	// linters are the analyzers the directive applies to, or nil if it
+	// applies to all analyzers.
+	linters   map[string]bool
+	explained bool
+
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+func newNolintDirective(comment *ast.Comment, linters map[string]bool) *nolintDirective {
+	text := strings.TrimLeft(comment.Text, "/ ")
+	text = strings.TrimSpace(strings.Split(text, "//")[0])
+	return &nolintDirective{
+		pos:       comment.Pos(),
+		end:       comment.End(),
+		text:      "//" + text,
+		linters:   linters,
+		explained: hasNolintExplanation(comment.Text),
+	}
+}
+
+// markUsed records that the directive suppressed a diagnostic of analyzer.
+func (d *nolintDirective) markUsed(analyzer string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.used == nil {
+		d.used = make(map[string]bool)
+	}
+	d.used[analyzer] = true
+}
+
+// nolintChecks selects the problems with nolint directives that are reported
+// as diagnostics of the nolintlint analyzer.
+type nolintChecks struct {
+	// unused reports directives that didn't suppress any diagnostic.
+	unused bool
+	// unknown reports directives naming analyzers that nogo doesn't run.
+	unknown bool
+	// explanation reports directives without an explanation comment.
+	explanation bool
+}
+
+func (c nolintChecks) enabled() bool {
+	return c.unused || c.unknown || c.explanation
+}
+
+// nolintIssue is a problem found in a nolint directive.
+type nolintIssue struct {
+	pos, end token.Pos
+	message  string
+}
+
+// check returns the issues of the given directives. known is the set of
+// analyzer names nogo runs and ran is the subset of analyzers that ran to
+// completion on the package; a directive can only be found to be unused for
+// the latter. Directives that name the nolintlint analyzer are not checked.
+func (c nolintChecks) check(directives []*nolintDirective, known, ran map[string]bool) []nolintIssue {
+	var issues []nolintIssue
+	report := func(d *nolintDirective, format string, args ...interface{}) {
+		issues = append(issues, nolintIssue{
+			pos:     d.pos,
+			end:     d.end,
+			message: fmt.Sprintf(format, args...),
+		})
+	}
+	for _, d := range directives {
+		if d.linters[nolintlintName] {
+			continue
+		}
+		var linters []string
+		for linter := range d.linters {
+			linters = append(linters, linter)
+		}
+		sort.Strings(linters)
+
+		if c.unknown {
+			for _, linter := range linters {
+				if !known[linter] {
+					report(d, "directive `%s` names unknown analyzer %q", d.text, linter)
+				}
+			}
+		}
+		if c.unused {
+			d.mu.Lock()
+			if d.linters == nil {
+				if len(d.used) == 0 && len(ran) == len(known) {
+					report(d, "directive `%s` is unused", d.text)
+				}
+			} else {
+				for _, linter := range linters {
+					if ran[linter] && !d.used[linter] {
+						report(d, "directive `%s` is unused for analyzer %q", d.text, linter)
+					}
+				}
+			}
+			d.mu.Unlock()
+		}
+		if c.explanation && !d.explained {
+			report(d, "directive `%s` should provide an explanation such as `%s // this is why`", d.text, d.text)
+		}
+	}
+	return issues
+}
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"go/ast"
 	"reflect"
 	"testing"
 )
@@ -89,3 +90,93 @@ func TestParseNolint(t *testing.T) {
 		})
 	}
 }
+
+func TestHasNolintExplanation(t *testing.T) {
+	tests := []struct {
+		Comment   string
+		Explained bool
+	}{
+		{Comment: "//nolint"},
+		{Comment: "//nolint:foo"},
+		{Comment: "//nolint:foo //"},
+		{Comment: "//nolint:foo // the foo lint is invalid for this line", Explained: true},
+		{Comment: "// nolint // generated code", Explained: true},
+	}
+	for _, tc := range tests {
+		if got := hasNolintExplanation(tc.Comment); got != tc.Explained {
+			t.Errorf("hasNolintExplanation(%q) = %t, want %t", tc.Comment, got, tc.Explained)
+		}
+	}
+}
+
+func TestNolintChecks(t *testing.T) {
+	directive := func(text string, used ...string) *nolintDirective {
+		linters, _ := parseNolint(text)
+		d := newNolintDirective(&ast.Comment{Text: text}, linters)
+		for _, a := range used {
+			d.markUsed(a)
+		}
+		return d
+	}
+	known := map[string]bool{"bools": true, "printf": true, "nilness": true}
+	ran := map[string]bool{"bools": true, "printf": true}
+	directives := []*nolintDirective{
+		directive("//nolint:bools // explained", "bools"),
+		directive("//nolint:bools,printf", "bools"),
+		directive("//nolint:nilness // nilness did not run"),
+		directive("//nolint:foo // explained"),
+		directive("//nolint // explained"),
+		directive("//nolint:nolintlint,bools"),
+	}
+
+	tests := []struct {
+		Name   string
+		Checks nolintChecks
+		Want   []string
+	}{
+		{
+			Name: "Disabled",
+		},
+		{
+			Name:   "Unused",
+			Checks: nolintChecks{unused: true},
+			Want: []string{
+				"directive `//nolint:bools,printf` is unused for analyzer \"printf\"",
+			},
+		},
+		{
+			Name:   "Unknown",
+			Checks: nolintChecks{unknown: true},
+			Want: []string{
+				"directive `//nolint:foo` names unknown analyzer \"foo\"",
+			},
+		},
+		{
+			Name:   "Explanation",
+			Checks: nolintChecks{explanation: true},
+			Want: []string{
+				"directive `//nolint:bools,printf` should provide an explanation such as `//nolint:bools,printf // this is why`",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			var got []string
+			for _, issue := range tc.Checks.check(directives, known, ran) {
+				got = append(got, issue.message)
+			}
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("got issues %q, want %q", got, tc.Want)
+			}
+		})
+	}
+
+	// A directive for all analyzers is only unused if all analyzers ran.
+	all := []*nolintDirective{directive("//nolint")}
+	if issues := (nolintChecks{unused: true}).check(all, known, ran); len(issues) != 0 {
+		t.Errorf("got issues %v for a directive covering analyzers that didn't run", issues)
+	}
+	if issues := (nolintChecks{unused: true}).check(all, known, known); len(issues) != 1 {
+		t.Errorf("got issues %v, want one unused directive", issues)
+	}
+}
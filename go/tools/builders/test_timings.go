@@ -0,0 +1,137 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readTestTimings reads the durations of tests, in seconds, from the
+// shard_timings files of a go_test. Each file is either a JUnit XML report
+// like the test.xml files written by go_test, or a text file with one
+// "TestName duration" line per test, where the duration is parsed by
+// time.ParseDuration. Lines starting with "#" are comments.
+//
+// Only top-level tests are read. If a test is listed several times, e.g. in
+// the reports of several runs, its longest duration is used.
+func readTestTimings(files []string) (map[string]float64, error) {
+	timings := make(map[string]float64)
+	add := func(name string, seconds float64) {
+		if strings.ContainsRune(name, '/') {
+			return
+		}
+		if d, ok := timings[name]; !ok || seconds > d {
+			timings[name] = seconds
+		}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+			err = readXMLTestTimings(data, add)
+		} else {
+			err = readTextTestTimings(data, add)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return timings, nil
+}
+
+// readXMLTestTimings reads the durations of tests from a JUnit XML report.
+// Reports written with GO_TEST_XML_REPORT=detailed name a subtest such as
+// TestA/foo "foo" and put the package name and its parent test in the
+// classname, e.g. "example.com/pkg.TestA", so the full name is rebuilt from
+// the classname.
+func readXMLTestTimings(data []byte, add func(string, float64)) error {
+	type testCase struct {
+		Name      string `xml:"name,attr"`
+		Classname string `xml:"classname,attr"`
+		Time      string `xml:"time,attr"`
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var suite string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "testsuite" {
+			suite = ""
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "name" {
+					suite = attr.Value
+				}
+			}
+			continue
+		}
+		if start.Name.Local != "testcase" {
+			continue
+		}
+		var c testCase
+		if err := dec.DecodeElement(&c, &start); err != nil {
+			return err
+		}
+		if parent := strings.TrimPrefix(c.Classname, suite+"."); suite != "" && parent != c.Classname {
+			c.Name = parent + "/" + c.Name
+		}
+		if c.Time == "" {
+			// Tests that did not finish have no duration.
+			continue
+		}
+		seconds, err := strconv.ParseFloat(c.Time, 64)
+		if err != nil {
+			return fmt.Errorf("invalid time for test %s: %q", c.Name, c.Time)
+		}
+		add(c.Name, seconds)
+	}
+}
+
+func readTextTestTimings(data []byte, add func(string, float64)) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: expected a test name and a duration, got %q", lineNum, line)
+		}
+		d, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		add(fields[0], d.Seconds())
+	}
+	return scanner.Err()
+}
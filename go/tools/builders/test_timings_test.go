@@ -0,0 +1,104 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadTestTimings(t *testing.T) {
+	dir := t.TempDir()
+	shard1 := filepath.Join(dir, "shard_1_of_2.xml")
+	if err := os.WriteFile(shard1, []byte(`<testsuites>
+	<testsuite errors="1" failures="0" skipped="0" tests="4" time="12.000" name="example.com/pkg">
+		<testcase classname="pkg" name="TestSlow" time="10.500"></testcase>
+		<testcase classname="pkg" name="TestSlow/case" time="10.000"></testcase>
+		<testcase classname="pkg" name="ExampleFoo" time="0.010"></testcase>
+		<testcase classname="pkg" name="TestHang" time="">
+			<error message="timed out" type=""></error>
+		</testcase>
+	</testsuite>
+</testsuites>`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	shard2 := filepath.Join(dir, "shard_2_of_2.xml")
+	if err := os.WriteFile(shard2, []byte(`<testsuites>
+	<testsuite errors="0" failures="0" skipped="0" tests="1" time="2.000" name="example.com/pkg">
+		<testcase classname="pkg" name="TestFast" time="1.250"></testcase>
+	</testsuite>
+</testsuites>`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	text := filepath.Join(dir, "timings.txt")
+	if err := os.WriteFile(text, []byte(`# Recorded on CI.
+TestSlow 5s
+TestMedium 1m30s
+`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readTestTimings([]string{shard1, shard2, text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"TestSlow":   10.5,
+		"ExampleFoo": 0.01,
+		"TestFast":   1.25,
+		"TestMedium": 90,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadTestTimingsDetailedXML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.xml")
+	if err := os.WriteFile(file, []byte(`<testsuites>
+	<testsuite errors="0" failures="0" skipped="0" tests="4" time="3.000" name="example.com/pkg">
+		<testcase classname="example.com/pkg" name="TestA" time="2.000"></testcase>
+		<testcase classname="example.com/pkg.TestA" name="TestB" time="1.500"></testcase>
+		<testcase classname="example.com/pkg.TestA/TestB" name="case" time="1.000"></testcase>
+		<testcase classname="example.com/pkg" name="TestB" time="0.500"></testcase>
+	</testsuite>
+</testsuites>`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readTestTimings([]string{file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"TestA": 2,
+		"TestB": 0.5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got timings %v, want %v", got, want)
+	}
+}
+
+func TestReadTestTimingsInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "timings.txt")
+	if err := os.WriteFile(file, []byte("TestSlow five seconds\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTestTimings([]string{file}); err == nil {
+		t.Error("expected an error for an invalid timings file")
+	}
+}
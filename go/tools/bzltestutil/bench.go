@@ -0,0 +1,127 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// benchmarkResultsFile is the name of the file in TEST_UNDECLARED_OUTPUTS_DIR
+// that the results of benchmarks are written to, in the format read by
+// benchstat.
+const benchmarkResultsFile = "benchmarks.txt"
+
+var (
+	// _benchmarkResultPattern matches the result lines of benchmarks, e.g.
+	// "BenchmarkFoo-8   1000   1234 ns/op   16 B/op   1 allocs/op".
+	_benchmarkResultPattern = regexp.MustCompile(`^(Benchmark\S*)\s+(\d+)\s+(.*\S)\s*$`)
+	// _benchmarkConfigPattern matches the configuration lines printed before
+	// the results, e.g. "goos: linux".
+	_benchmarkConfigPattern = regexp.MustCompile(`^[a-z][^\s:]*: `)
+)
+
+// isBenchmarking reports whether the test is run in benchmark mode, which is
+// enabled by setting GO_BENCH to a pattern of the benchmarks to run, like the
+// -bench flag of 'go test'.
+func isBenchmarking() bool {
+	return os.Getenv("GO_BENCH") != ""
+}
+
+// SetupBenchmarks sets the flags of the testing package to only run
+// benchmarks if GO_BENCH is set. GO_BENCH_TIME and GO_BENCH_COUNT correspond
+// to the -benchtime and -count flags of 'go test'. Memory allocations are
+// always reported.
+//
+// This must be called after testing.MainStart and before testing.M.Run.
+func SetupBenchmarks() {
+	bench := os.Getenv("GO_BENCH")
+	if bench == "" {
+		return
+	}
+	flag.Lookup("test.bench").Value.Set(bench)
+	flag.Lookup("test.run").Value.Set("^$")
+	flag.Lookup("test.benchmem").Value.Set("true")
+	for env, name := range map[string]string{
+		"GO_BENCH_TIME":  "test.benchtime",
+		"GO_BENCH_COUNT": "test.count",
+	} {
+		if value := os.Getenv(env); value != "" {
+			if err := flag.Lookup(name).Value.Set(value); err != nil {
+				log.Fatalf("invalid value for %s: %q: %s", env, value, err)
+			}
+		}
+	}
+}
+
+// parseBenchmarkResult parses a result line of a benchmark into the name of
+// the benchmark and its metrics, starting with the number of iterations.
+func parseBenchmarkResult(line string) (name string, metrics []xmlProperty, ok bool) {
+	m := _benchmarkResultPattern.FindStringSubmatch(line)
+	if m == nil {
+		return "", nil, false
+	}
+	fields := strings.Fields(m[3])
+	if len(fields)%2 != 0 {
+		return "", nil, false
+	}
+	metrics = append(metrics, xmlProperty{Name: "iterations", Value: m[2]})
+	for i := 0; i < len(fields); i += 2 {
+		if _, err := strconv.ParseFloat(fields[i], 64); err != nil {
+			return "", nil, false
+		}
+		metrics = append(metrics, xmlProperty{Name: fields[i+1], Value: fields[i]})
+	}
+	return m[1], metrics, true
+}
+
+// writeBenchmarkResults extracts the configuration and result lines of
+// benchmarks from test2json's output and writes them to
+// TEST_UNDECLARED_OUTPUTS_DIR, if set.
+func writeBenchmarkResults(r io.Reader) error {
+	outputsDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outputsDir == "" {
+		return nil
+	}
+	var results bytes.Buffer
+	dec := json.NewDecoder(r)
+	for {
+		var e jsonEvent
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding test2json output: %s", err)
+		}
+		if e.Action != "output" {
+			continue
+		}
+		line := strings.TrimSuffix(e.Output, "\n")
+		if _, _, ok := parseBenchmarkResult(line); ok || (e.Test == "" && _benchmarkConfigPattern.MatchString(line)) {
+			results.WriteString(line)
+			results.WriteByte('\n')
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(outputsDir, benchmarkResultsFile), results.Bytes(), 0o666)
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseBenchmarkResult(t *testing.T) {
+	for _, tt := range []struct {
+		line    string
+		name    string
+		metrics []xmlProperty
+	}{
+		{
+			line: "BenchmarkFoo-8   \t    1000\t      1234 ns/op\t      16 B/op\t       1 allocs/op",
+			name: "BenchmarkFoo-8",
+			metrics: []xmlProperty{
+				{Name: "iterations", Value: "1000"},
+				{Name: "ns/op", Value: "1234"},
+				{Name: "B/op", Value: "16"},
+				{Name: "allocs/op", Value: "1"},
+			},
+		}, {
+			line: "BenchmarkFoo/bar=1  \t     100\t         8.860 ns/op\t        42.00 widgets/op",
+			name: "BenchmarkFoo/bar=1",
+			metrics: []xmlProperty{
+				{Name: "iterations", Value: "100"},
+				{Name: "ns/op", Value: "8.860"},
+				{Name: "widgets/op", Value: "42.00"},
+			},
+		},
+		{line: "BenchmarkFoo"},
+		{line: "BenchmarkFoo 100 a lot of time"},
+		{line: "--- FAIL: BenchmarkFoo"},
+		{line: "    foo_test.go:12: BenchmarkFoo 100 10 ns/op"},
+	} {
+		t.Run(tt.line, func(t *testing.T) {
+			name, metrics, ok := parseBenchmarkResult(tt.line)
+			if ok != (tt.name != "") {
+				t.Fatalf("got ok = %t, want %t", ok, tt.name != "")
+			}
+			if name != tt.name || !reflect.DeepEqual(metrics, tt.metrics) {
+				t.Errorf("got %q, %v; want %q, %v", name, metrics, tt.name, tt.metrics)
+			}
+		})
+	}
+}
+
+func TestWriteBenchmarkResults(t *testing.T) {
+	outputsDir := t.TempDir()
+	t.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outputsDir)
+	f, err := os.Open("testdata/bench.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := writeBenchmarkResults(f); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outputsDir, benchmarkResultsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `goos: linux
+goarch: amd64
+pkg: pkg/testing
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkA-4      	     100	        20.76 ns/op	        42.00 widgets/op	       0 B/op	       0 allocs/op
+BenchmarkA-4      	     100	        13.43 ns/op	        42.00 widgets/op	       0 B/op	       0 allocs/op
+BenchmarkB/sub-4  	     100	         8.860 ns/op	       0 B/op	       0 allocs/op
+BenchmarkB/sub-4  	     100	        11.59 ns/op	       0 B/op	       0 allocs/op
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
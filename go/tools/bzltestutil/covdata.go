@@ -0,0 +1,161 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// goCoverDir is the directory the coverage data of the test and of the
+	// instrumented binaries it runs is written to. It is empty if the test
+	// isn't built with native coverage or the data isn't collected.
+	goCoverDir string
+	// goCoverFormat is the format of the coverage report, "lcov" or
+	// "go_cover".
+	goCoverFormat string
+	// goTool is the path of the go command of the SDK, relative to the
+	// runfiles directory.
+	goTool string
+	// writeGoCoverData writes the coverage data of the test itself to a
+	// directory.
+	writeGoCoverData func(dir string) error
+)
+
+// SetupGoCoverDir prepares collecting the coverage of a test built with the
+// compiler's coverage support. It is called by the generated test main, which
+// provides writeCoverData to write the coverage data of the test with
+// runtime/coverage when the test exits. GOCOVERDIR is pointed to the same
+// temporary directory, so that binaries instrumented for coverage and run by
+// the test, e.g. go_binary targets in data, write their coverage data there.
+//
+// When the test exits, the data is converted to a coverage profile with
+// "go tool covdata textfmt", using the go command at the runfiles path
+// sdkGoTool. The profile is written to COVERAGE_OUTPUT_FILE or, for the lcov
+// format, converted to LCOV and stored in COVERAGE_DIR.
+//
+// GOCOVERDIR is left alone if it is already set, so that the raw data of
+// binaries can still be collected by the user.
+func SetupGoCoverDir(format, sdkGoTool string, writeCoverData func(dir string) error) {
+	if format == "lcov" && coverageDir == "" || format != "lcov" && os.Getenv("COVERAGE_OUTPUT_FILE") == "" {
+		return
+	}
+	dir, err := os.MkdirTemp("", "gocoverdir")
+	if err != nil {
+		log.Printf("Not collecting coverage: %s", err)
+		return
+	}
+	if os.Getenv("GOCOVERDIR") == "" {
+		if err := os.Setenv("GOCOVERDIR", dir); err != nil {
+			log.Printf("Not collecting coverage of binaries: %s", err)
+		}
+	}
+	goCoverDir = dir
+	goCoverFormat = format
+	goTool = sdkGoTool
+	writeGoCoverData = writeCoverData
+}
+
+// ConvertGoCoverDir writes the coverage data of the test to the directory set
+// up by SetupGoCoverDir and converts it together with the data of the
+// binaries run by the test.
+func ConvertGoCoverDir() error {
+	if goCoverDir == "" {
+		return nil
+	}
+	defer os.RemoveAll(goCoverDir)
+
+	if err := writeGoCoverData(goCoverDir); err != nil {
+		return fmt.Errorf("error writing coverage data: %v", err)
+	}
+	profile, err := readGoCoverDir(goCoverDir)
+	if err != nil {
+		return err
+	}
+
+	if goCoverFormat != "lcov" {
+		return os.WriteFile(os.Getenv("COVERAGE_OUTPUT_FILE"), profile, 0o666)
+	}
+	out, err := os.CreateTemp(coverageDir, "go_coverage.*.dat")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return convertCoverToLcov(bytes.NewReader(profile), out)
+}
+
+// readGoCoverDir converts the coverage data files in dir to a coverage
+// profile with "go tool covdata textfmt". The blocks of each file are
+// adjacent in the profile, as convertCoverToLcov expects.
+func readGoCoverDir(dir string) ([]byte, error) {
+	textFile := filepath.Join(dir, "coverage.txt")
+	cmd := exec.Command(filepath.Join(os.Getenv("TEST_SRCDIR"), goTool), "tool", "covdata", "textfmt", "-i="+dir, "-o="+textFile)
+	// Use the tools of the SDK the test was built with, even if the test
+	// sets GOTOOLCHAIN.
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("error running go tool covdata: %v\n%s", err, out)
+	}
+	text, err := os.Open(textFile)
+	if err != nil {
+		return nil, err
+	}
+	defer text.Close()
+
+	mode := ""
+	var lines []string
+	scanner := bufio.NewScanner(text)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "mode: ") {
+			mode = line
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return coverLinePath(lines[i]) < coverLinePath(lines[j])
+	})
+	profile := &bytes.Buffer{}
+	if mode != "" {
+		profile.WriteString(mode)
+		profile.WriteByte('\n')
+	}
+	for _, line := range lines {
+		profile.WriteString(line)
+		profile.WriteByte('\n')
+	}
+	return profile.Bytes(), nil
+}
+
+// coverLinePath returns the path of the file a line of a coverage profile
+// refers to.
+func coverLinePath(line string) string {
+	if i := strings.LastIndexByte(line, ':'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
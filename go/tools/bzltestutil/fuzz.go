@@ -0,0 +1,197 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"flag"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir"
+)
+
+// fuzzCorpusDir is the directory, relative to the package directory, that the
+// testing package reads the seed corpus from and writes new crashers to.
+var fuzzCorpusDir = filepath.Join("testdata", "fuzz")
+
+// isFuzzing reports whether the test is run in fuzzing mode, which is enabled
+// by setting GO_FUZZ_TARGET to the fuzz target to run, like the -fuzz flag of
+// 'go test'.
+func isFuzzing() bool {
+	return os.Getenv("GO_FUZZ_TARGET") != ""
+}
+
+// SetupFuzzing sets the flags of the testing package for fuzzing if
+// GO_FUZZ_TARGET is set. GO_FUZZ_TIME sets the time to fuzz for, like the
+// -fuzztime flag of 'go test'. The fuzz cache, which holds the corpus
+// generated while fuzzing, is stored in GO_FUZZ_CACHE_DIR or in the user's
+// cache directory so that it persists across runs.
+//
+// This must be called after testing.MainStart and before testing.M.Run.
+func SetupFuzzing(pkg string) {
+	target := os.Getenv("GO_FUZZ_TARGET")
+	if target == "" {
+		return
+	}
+	fuzzFlag := flag.Lookup("test.fuzz")
+	if fuzzFlag == nil {
+		log.Fatal("fuzzing requires Go 1.18 or later")
+	}
+	fuzzFlag.Value.Set(target)
+	if fuzzTime := os.Getenv("GO_FUZZ_TIME"); fuzzTime != "" {
+		if err := flag.Lookup("test.fuzztime").Value.Set(fuzzTime); err != nil {
+			log.Fatalf("invalid value for GO_FUZZ_TIME: %q: %s", fuzzTime, err)
+		}
+	}
+	cacheDir, err := fuzzCacheDir(pkg)
+	if err != nil {
+		log.Fatalf("Failed to create fuzz cache directory: %s", err)
+	}
+	flag.Lookup("test.fuzzcachedir").Value.Set(cacheDir)
+
+	// The fuzzing engine starts its workers by running os.Args[0], which is
+	// relative to the directory the test was started in.
+	if !filepath.IsAbs(os.Args[0]) && strings.ContainsRune(os.Args[0], filepath.Separator) && chdir.TestExecDir != "" {
+		os.Args[0] = filepath.Join(chdir.TestExecDir, os.Args[0])
+	}
+}
+
+// fuzzCacheDir returns the fuzz cache directory of the package pkg, which is
+// created if needed. Like with 'go test', the caches of the fuzz targets in
+// pkg are subdirectories named after the targets.
+func fuzzCacheDir(pkg string) (string, error) {
+	base := os.Getenv("GO_FUZZ_CACHE_DIR")
+	if base == "" {
+		if userCacheDir, err := os.UserCacheDir(); err == nil {
+			base = filepath.Join(userCacheDir, "rules_go", "fuzz")
+		}
+	}
+	if base != "" {
+		dir := filepath.Join(base, filepath.FromSlash(pkg))
+		if err := os.MkdirAll(dir, 0o777); err == nil {
+			return dir, nil
+		} else if os.Getenv("GO_FUZZ_CACHE_DIR") != "" {
+			return "", err
+		}
+	}
+	// The user's cache directory is usually not writable in the sandbox.
+	tmpDir := os.Getenv("TEST_TMPDIR")
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	dir := filepath.Join(tmpDir, "fuzz", filepath.FromSlash(pkg))
+	return dir, os.MkdirAll(dir, 0o777)
+}
+
+// fuzzOutputs is used by Wrap to preserve the files written while fuzzing,
+// which would otherwise be lost with the sandbox or the runfiles tree.
+//
+// With 'bazel test', new crashers and new entries of the fuzz cache are copied
+// to TEST_UNDECLARED_OUTPUTS_DIR, in the testdata/fuzz/FuzzX layout of seed
+// corpora. With 'bazel run', new crashers are copied to the package directory
+// in the workspace, where 'go test' would write them.
+type fuzzOutputs struct {
+	destDir  string
+	cacheDir string
+	seen     map[string]bool
+}
+
+func newFuzzOutputs(pkg string) (*fuzzOutputs, error) {
+	o := &fuzzOutputs{seen: make(map[string]bool)}
+	if workspaceDir := os.Getenv("BUILD_WORKSPACE_DIRECTORY"); workspaceDir != "" && chdir.RunDir != "" && !filepath.IsAbs(chdir.RunDir) {
+		o.destDir = filepath.Join(workspaceDir, chdir.RunDir)
+	} else if outputsDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"); outputsDir != "" {
+		o.destDir = outputsDir
+		cacheDir, err := fuzzCacheDir(pkg)
+		if err != nil {
+			return nil, err
+		}
+		o.cacheDir = cacheDir
+	}
+	err := o.walk(func(path, rel string) error {
+		o.seen[path] = true
+		return nil
+	})
+	return o, err
+}
+
+// walk calls fn for each file of the seed corpora and of the fuzz cache, with
+// the path of the file relative to testdata/fuzz.
+func (o *fuzzOutputs) walk(fn func(path, rel string) error) error {
+	for _, root := range []string{fuzzCorpusDir, o.cacheDir} {
+		if root == "" {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			return fn(path, rel)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect copies the files written since newFuzzOutputs was called.
+func (o *fuzzOutputs) collect() error {
+	if o.destDir == "" {
+		return nil
+	}
+	return o.walk(func(path, rel string) error {
+		if o.seen[path] {
+			return nil
+		}
+		dest := filepath.Join(o.destDir, fuzzCorpusDir, rel)
+		log.Printf("Saving fuzzing input %s to %s", rel, dest)
+		return copyFile(path, dest)
+	})
+}
+
+func copyFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o777); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -18,14 +18,20 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"testing/internal/testdeps"
+
+	"github.com/bazelbuild/rules_go/go/tools/funcname"
 )
 
 // Lock in the COVERAGE_DIR during test setup in case the test uses e.g. os.Clearenv.
@@ -34,7 +40,8 @@ var coverageDir = os.Getenv("COVERAGE_DIR")
 // ConvertCoverToLcov converts the go coverprofile file coverage.dat.cover to
 // the expectedLcov format and stores it in coverage.dat, where it is picked up by
 // Bazel.
-// The conversion emits line and branch coverage, but not function coverage.
+// The conversion emits line coverage and, if the source files can be found,
+// function and branch coverage.
 func ConvertCoverToLcov() error {
 	inPath := flag.Lookup("test.coverprofile").Value.String()
 	in, err := os.Open(inPath)
@@ -62,18 +69,28 @@ func ConvertCoverToLcov() error {
 var _coverLinePattern = regexp.MustCompile(`^(?P<path>.+):(?P<startLine>\d+)\.(?P<startColumn>\d+),(?P<endLine>\d+)\.(?P<endColumn>\d+) (?P<numStmt>\d+) (?P<count>\d+)$`)
 
 const (
-	_pathIdx      = 1
-	_startLineIdx = 2
-	_endLineIdx   = 4
-	_countIdx     = 7
+	_pathIdx        = 1
+	_startLineIdx   = 2
+	_startColumnIdx = 3
+	_endLineIdx     = 4
+	_endColumnIdx   = 5
+	_countIdx       = 7
 )
 
+// coverBlock is a block of a go coverage profile, which corresponds to a
+// single coverage counter.
+type coverBlock struct {
+	startLine, startColumn, endLine, endColumn uint32
+	count                                      uint32
+}
+
 func convertCoverToLcov(coverReader io.Reader, lcovWriter io.Writer) error {
 	cover := bufio.NewScanner(coverReader)
 	lcov := bufio.NewWriter(lcovWriter)
 	defer lcov.Flush()
 	currentPath := ""
 	var lineCounts map[uint32]uint32
+	var blocks []coverBlock
 	for cover.Scan() {
 		l := cover.Text()
 		m := _coverLinePattern.FindStringSubmatch(l)
@@ -86,47 +103,63 @@ func convertCoverToLcov(coverReader io.Reader, lcovWriter io.Writer) error {
 
 		if m[_pathIdx] != currentPath {
 			if currentPath != "" {
-				if err := emitLcovLines(lcov, currentPath, lineCounts); err != nil {
+				if err := emitLcovFile(lcov, currentPath, lineCounts, blocks); err != nil {
 					return err
 				}
 			}
 			currentPath = m[_pathIdx]
 			lineCounts = make(map[uint32]uint32)
+			blocks = nil
 		}
 
-		startLine, err := strconv.ParseUint(m[_startLineIdx], 10, 32)
-		if err != nil {
-			return err
-		}
-		endLine, err := strconv.ParseUint(m[_endLineIdx], 10, 32)
-		if err != nil {
-			return err
-		}
-		count, err := strconv.ParseUint(m[_countIdx], 10, 32)
-		if err != nil {
-			return err
+		var block coverBlock
+		for _, f := range []struct {
+			idx int
+			dst *uint32
+		}{
+			{_startLineIdx, &block.startLine},
+			{_startColumnIdx, &block.startColumn},
+			{_endLineIdx, &block.endLine},
+			{_endColumnIdx, &block.endColumn},
+			{_countIdx, &block.count},
+		} {
+			v, err := strconv.ParseUint(m[f.idx], 10, 32)
+			if err != nil {
+				return err
+			}
+			*f.dst = uint32(v)
 		}
-		for line := uint32(startLine); line <= uint32(endLine); line++ {
+		blocks = append(blocks, block)
+		for line := block.startLine; line <= block.endLine; line++ {
 			prevCount, ok := lineCounts[line]
-			if !ok || uint32(count) > prevCount {
-				lineCounts[line] = uint32(count)
+			if !ok || block.count > prevCount {
+				lineCounts[line] = block.count
 			}
 		}
 	}
 	if currentPath != "" {
-		if err := emitLcovLines(lcov, currentPath, lineCounts); err != nil {
+		if err := emitLcovFile(lcov, currentPath, lineCounts, blocks); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func emitLcovLines(lcov io.StringWriter, path string, lineCounts map[uint32]uint32) error {
+func emitLcovFile(lcov io.StringWriter, path string, lineCounts map[uint32]uint32, blocks []coverBlock) error {
 	_, err := lcov.WriteString(fmt.Sprintf("SF:%s\n", path))
 	if err != nil {
 		return err
 	}
 
+	if fns, branches, ok := analyzeCoverSource(path, blocks); ok {
+		if err := emitLcovFunctions(lcov, fns); err != nil {
+			return err
+		}
+		if err := emitLcovBranches(lcov, branches); err != nil {
+			return err
+		}
+	}
+
 	// Emit the coverage counters for the individual source lines.
 	sortedLines := make([]uint32, 0, len(lineCounts))
 	for line := range lineCounts {
@@ -152,9 +185,233 @@ func emitLcovLines(lcov io.StringWriter, path string, lineCounts map[uint32]uint
 	return nil
 }
 
+// lcovFunction is a function declared in a source file and the number of
+// times it has been called.
+type lcovFunction struct {
+	line  int
+	name  string
+	count uint32
+}
+
+// lcovBranch is a branch of an if, switch or select statement. Branches of the
+// same statement share a block number.
+type lcovBranch struct {
+	line, block, branch int
+	count               uint32
+	// reached is false if the statement itself has never been executed.
+	reached bool
+}
+
+func emitLcovFunctions(lcov io.StringWriter, fns []lcovFunction) error {
+	numCovered := 0
+	for _, fn := range fns {
+		if _, err := lcov.WriteString(fmt.Sprintf("FN:%d,%s\n", fn.line, fn.name)); err != nil {
+			return err
+		}
+	}
+	for _, fn := range fns {
+		if fn.count > 0 {
+			numCovered++
+		}
+		if _, err := lcov.WriteString(fmt.Sprintf("FNDA:%d,%s\n", fn.count, fn.name)); err != nil {
+			return err
+		}
+	}
+	_, err := lcov.WriteString(fmt.Sprintf("FNF:%d\nFNH:%d\n", len(fns), numCovered))
+	return err
+}
+
+func emitLcovBranches(lcov io.StringWriter, branches []lcovBranch) error {
+	numCovered := 0
+	for _, b := range branches {
+		taken := "-"
+		if b.reached {
+			taken = strconv.FormatUint(uint64(b.count), 10)
+		}
+		if b.count > 0 {
+			numCovered++
+		}
+		if _, err := lcov.WriteString(fmt.Sprintf("BRDA:%d,%d,%d,%s\n", b.line, b.block, b.branch, taken)); err != nil {
+			return err
+		}
+	}
+	_, err := lcov.WriteString(fmt.Sprintf("BRF:%d\nBRH:%d\n", len(branches), numCovered))
+	return err
+}
+
+// analyzeCoverSource parses the source file at path and maps the coverage
+// blocks recorded for it to the functions declared in the file and to the
+// branches of its if, switch and select statements. Only branches with a
+// coverage counter of their own are reported, which excludes the implicit
+// else of an if and the implicit default of a switch.
+//
+// ok is false if the source file can't be found or parsed, in which case only
+// line coverage can be reported.
+func analyzeCoverSource(path string, blocks []coverBlock) (fns []lcovFunction, branches []lcovBranch, ok bool) {
+	srcPath := findCoverSource(path)
+	if srcPath == "" {
+		return nil, nil, false
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, srcPath, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return !positionBefore(blocks[j].startLine, blocks[j].startColumn, blocks[i].startLine, blocks[i].startColumn)
+	})
+	// firstBlock returns the first block that starts in [from, to).
+	firstBlock := func(from, to token.Pos) *coverBlock {
+		fromPos, toPos := fset.Position(from), fset.Position(to)
+		for i := range blocks {
+			b := &blocks[i]
+			if positionBefore(b.startLine, b.startColumn, uint32(fromPos.Line), uint32(fromPos.Column)) {
+				continue
+			}
+			if !positionBefore(b.startLine, b.startColumn, uint32(toPos.Line), uint32(toPos.Column)) {
+				return nil
+			}
+			return b
+		}
+		return nil
+	}
+	// enclosingBlock returns the innermost block that contains pos.
+	enclosingBlock := func(pos token.Pos) *coverBlock {
+		p := fset.Position(pos)
+		line, column := uint32(p.Line), uint32(p.Column)
+		var enclosing *coverBlock
+		for i := range blocks {
+			b := &blocks[i]
+			if positionBefore(line, column, b.startLine, b.startColumn) {
+				break
+			}
+			if !positionBefore(b.endLine, b.endColumn, line, column) {
+				enclosing = b
+			}
+		}
+		return enclosing
+	}
+	// addBranches records the branches of the statement at pos, each of which
+	// is given by the range [from, to) its coverage block starts in.
+	addBranches := func(pos token.Pos, ranges [][2]token.Pos) {
+		var counts []uint32
+		for _, r := range ranges {
+			b := firstBlock(r[0], r[1])
+			if b == nil {
+				// Not instrumented the way we expect, e.g. an empty select.
+				return
+			}
+			counts = append(counts, b.count)
+		}
+		reached := false
+		if b := enclosingBlock(pos); b != nil {
+			reached = b.count > 0
+		}
+		block := 0
+		if len(branches) > 0 {
+			block = branches[len(branches)-1].block + 1
+		}
+		for i, count := range counts {
+			branches = append(branches, lcovBranch{
+				line:    fset.Position(pos).Line,
+				block:   block,
+				branch:  i,
+				count:   count,
+				reached: reached || count > 0,
+			})
+		}
+	}
+	// clauseRanges returns the ranges of the case clauses of a switch or
+	// select statement. The coverage block of a clause starts after its colon.
+	clauseRanges := func(body *ast.BlockStmt) [][2]token.Pos {
+		var ranges [][2]token.Pos
+		for _, stmt := range body.List {
+			switch clause := stmt.(type) {
+			case *ast.CaseClause:
+				ranges = append(ranges, [2]token.Pos{clause.Colon + 1, clause.End() + 1})
+			case *ast.CommClause:
+				ranges = append(ranges, [2]token.Pos{clause.Colon + 1, clause.End() + 1})
+			}
+		}
+		return ranges
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body == nil {
+				break
+			}
+			// The first block of a function is executed on every call.
+			if b := firstBlock(n.Body.Lbrace+1, n.Body.Rbrace+1); b != nil {
+				fns = append(fns, lcovFunction{
+					line:  fset.Position(n.Pos()).Line,
+					name:  funcname.Of(n),
+					count: b.count,
+				})
+			}
+		case *ast.IfStmt:
+			ranges := [][2]token.Pos{{n.Body.Lbrace + 1, n.Body.Rbrace + 1}}
+			if n.Else != nil {
+				// The block of the else starts right after the else keyword.
+				ranges = append(ranges, [2]token.Pos{n.Body.End(), n.Else.End()})
+			}
+			addBranches(n.Pos(), ranges)
+		case *ast.SwitchStmt:
+			addBranches(n.Pos(), clauseRanges(n.Body))
+		case *ast.TypeSwitchStmt:
+			addBranches(n.Pos(), clauseRanges(n.Body))
+		case *ast.SelectStmt:
+			addBranches(n.Pos(), clauseRanges(n.Body))
+		}
+		return true
+	})
+	return fns, branches, true
+}
+
+// positionBefore reports whether line1.column1 comes before line2.column2.
+func positionBefore(line1, column1, line2, column2 uint32) bool {
+	return line1 < line2 || line1 == line2 && column1 < column2
+}
+
+// findCoverSource returns the path of the source file a coverage profile refers
+// to, or an empty string if it can't be found. The profiles use paths relative
+// to the execution root, which contains the instrumented sources in coverage
+// runs and is the parent of the bazel-out directory holding the runfiles
+// directory of the test. Sources that are runfiles of the test are found in
+// the runfiles directory as well.
+func findCoverSource(path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	srcDir := os.Getenv("TEST_SRCDIR")
+	if srcDir == "" {
+		return ""
+	}
+	var candidates []string
+	sep := string(filepath.Separator)
+	if i := strings.LastIndex(srcDir, sep+"bazel-out"+sep); i >= 0 {
+		candidates = append(candidates, filepath.Join(srcDir[:i], path))
+	}
+	if externalPrefix := "external" + sep; strings.HasPrefix(path, externalPrefix) {
+		candidates = append(candidates, filepath.Join(srcDir, strings.TrimPrefix(path, externalPrefix)))
+	} else if workspace := os.Getenv("TEST_WORKSPACE"); workspace != "" {
+		candidates = append(candidates, filepath.Join(srcDir, workspace, path))
+	}
+	for _, candidate := range candidates {
+		if fi, err := os.Stat(candidate); err == nil && fi.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return ""
+}
+
 // LcovTestDeps is a patched version of testdeps.TestDeps that allows to
 // hook into the SetPanicOnExit0 call happening right before testing.M.Run
-// returns.
+// returns. It is used to convert the coverage profile to LCOV and to collect
+// native coverage, see SetupGoCoverDir.
 // This trick relies on the testDeps interface defined in this package being
 // identical to the actual testing.testDeps interface, which differs between
 // major versions of Go.
@@ -172,12 +429,20 @@ type LcovTestDeps struct {
 // data already available.
 func (ltd LcovTestDeps) SetPanicOnExit0(panicOnExit bool) {
 	if !panicOnExit {
-		lcovAtExitHook()
+		coverageAtExitHook()
 	}
 	ltd.TestDeps.SetPanicOnExit0(ltd.OriginalPanicOnExit)
 }
 
-func lcovAtExitHook() {
+func coverageAtExitHook() {
+	if goCoverDir != "" {
+		// The test is built with native coverage, see SetupGoCoverDir.
+		if err := ConvertGoCoverDir(); err != nil {
+			log.Printf("Failed to collect coverage: %s", err)
+			os.Exit(TestWrapperAbnormalExit)
+		}
+		return
+	}
 	if err := ConvertCoverToLcov(); err != nil {
 		log.Printf("Failed to collect coverage: %s", err)
 		os.Exit(TestWrapperAbnormalExit)
@@ -1,6 +1,8 @@
 package bzltestutil
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -69,3 +71,113 @@ end_of_record
 		})
 	}
 }
+
+func TestConvertCoverToLcovFunctionsAndBranches(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "lib.go")
+	if err := os.WriteFile(src, []byte(`package lib
+
+type T struct{}
+
+func (*T) Sign(x int) int {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
+
+func Kind(v interface{}) string {
+	switch v.(type) {
+	case int:
+		return "int"
+	default:
+		return "other"
+	}
+}
+
+func Unused() {}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	goCover := strings.ReplaceAll(`mode: count
+SRC:6.2,6.11 1 2
+SRC:7.3,8.1 1 2
+SRC:8.9,8.18 1 0
+SRC:9.3,10.1 1 0
+SRC:11.2,11.10 1 0
+SRC:15.2,15.18 1 1
+SRC:17.3,17.15 1 1
+SRC:19.3,19.17 1 0
+SRC:23.16,23.16 0 0
+`, "SRC", src)
+	expectedLcov := strings.ReplaceAll(`SF:SRC
+FN:5,(*T).Sign
+FN:14,Kind
+FN:23,Unused
+FNDA:2,(*T).Sign
+FNDA:1,Kind
+FNDA:0,Unused
+FNF:3
+FNH:2
+BRDA:6,0,0,2
+BRDA:6,0,1,0
+BRDA:8,1,0,-
+BRDA:15,2,0,1
+BRDA:15,2,1,0
+BRF:5
+BRH:2
+DA:6,2
+DA:7,2
+DA:8,2
+DA:9,0
+DA:10,0
+DA:11,0
+DA:15,1
+DA:17,1
+DA:19,0
+DA:23,0
+LH:5
+LF:10
+end_of_record
+`, "SRC", src)
+
+	var out strings.Builder
+	if err := convertCoverToLcov(strings.NewReader(goCover), &out); err != nil {
+		t.Fatalf("convertCoverToLcov returned unexpected error: %+v", err)
+	}
+	if actualLcov := out.String(); actualLcov != expectedLcov {
+		t.Errorf("convertCoverToLcov returned:\n%s\nexpected:\n%s", actualLcov, expectedLcov)
+	}
+}
+
+func TestFindCoverSource(t *testing.T) {
+	dir := t.TempDir()
+	execRoot := filepath.Join(dir, "execroot", "_main")
+	srcDir := filepath.Join(execRoot, "bazel-out", "k8-fastbuild", "bin", "pkg", "pkg_test_", "pkg_test.runfiles")
+	for _, f := range []string{
+		filepath.Join(execRoot, "pkg", "lib.go"),
+		filepath.Join(srcDir, "repo", "data.go"),
+		filepath.Join(dir, "unrelated.go"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(f), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte("package p\n"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEST_SRCDIR", srcDir)
+	t.Setenv("TEST_WORKSPACE", "_main")
+
+	for path, want := range map[string]string{
+		"pkg/lib.go":            filepath.Join(execRoot, "pkg", "lib.go"),
+		"external/repo/data.go": filepath.Join(srcDir, "repo", "data.go"),
+		"unrelated.go":          "",
+		"pkg/missing.go":        "",
+	} {
+		if got := findCoverSource(path); got != want {
+			t.Errorf("findCoverSource(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// retryAttempts returns the number of times Wrap reruns the top-level tests
+// that failed, which is set with GO_TEST_RETRY_FAILED. Tests are not retried
+// while fuzzing or running benchmarks.
+func retryAttempts() int {
+	retryEnv := os.Getenv("GO_TEST_RETRY_FAILED")
+	if retryEnv == "" {
+		return 0
+	}
+	retries, err := strconv.Atoi(retryEnv)
+	if err != nil || retries < 0 {
+		log.Fatalf("invalid value for GO_TEST_RETRY_FAILED: %q", retryEnv)
+	}
+	if isFuzzing() || isBenchmarking() {
+		return 0
+	}
+	return retries
+}
+
+// isTestFailure reports whether err is the error of a test binary that
+// exited because some tests failed, as opposed to a panic, a timeout or a
+// failure to start.
+func isTestFailure(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+}
+
+// failedTests returns the top-level tests, examples and fuzz targets that
+// failed according to test2json's output of a run of the test binary. It
+// returns nil if a test did not finish, e.g. because the binary crashed,
+// since rerunning only the failed tests would then miss the tests that did
+// not run.
+func failedTests(r io.Reader) ([]string, error) {
+	var failed []string
+	states := make(map[string]string)
+	dec := json.NewDecoder(r)
+	for {
+		var e jsonEvent
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if e.Test == "" || strings.ContainsRune(e.Test, '/') {
+			continue
+		}
+		switch e.Action {
+		case "run", "pass", "skip":
+			states[e.Test] = e.Action
+		case "fail":
+			if states[e.Test] != "fail" {
+				failed = append(failed, e.Test)
+			}
+			states[e.Test] = e.Action
+		}
+	}
+	for _, state := range states {
+		if state == "run" {
+			return nil, nil
+		}
+	}
+	return failed, nil
+}
+
+// retryRunFlag returns the -test.run flag that selects exactly the given
+// top-level tests.
+func retryRunFlag(tests []string) string {
+	patterns := make([]string, len(tests))
+	for i, test := range tests {
+		patterns[i] = regexp.QuoteMeta(test)
+	}
+	return "-test.run=^(" + strings.Join(patterns, "|") + ")$"
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFailedTests(t *testing.T) {
+	for _, tt := range []struct {
+		name, events string
+		want         []string
+	}{
+		{
+			name: "failures",
+			events: `{"Action":"run","Test":"TestOK"}
+{"Action":"pass","Test":"TestOK"}
+{"Action":"run","Test":"TestA"}
+{"Action":"run","Test":"TestA/sub"}
+{"Action":"fail","Test":"TestA/sub"}
+{"Action":"fail","Test":"TestA"}
+{"Action":"run","Test":"ExampleB"}
+{"Action":"fail","Test":"ExampleB"}
+{"Action":"fail"}
+`,
+			want: []string{"TestA", "ExampleB"},
+		}, {
+			name: "crash",
+			events: `{"Action":"run","Test":"TestA"}
+{"Action":"fail","Test":"TestA"}
+{"Action":"run","Test":"TestB"}
+{"Action":"output","Test":"TestB","Output":"panic: boom\n"}
+{"Action":"fail"}
+`,
+			want: nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := failedTests(strings.NewReader(tt.events))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryRunFlag(t *testing.T) {
+	flag := retryRunFlag([]string{"TestA", "Test$B"})
+	if want := `-test.run=^(TestA|Test\$B)$`; flag != want {
+		t.Fatalf("got %s, want %s", flag, want)
+	}
+	re := regexp.MustCompile(strings.TrimPrefix(flag, "-test.run="))
+	for name, want := range map[string]bool{"TestA": true, "Test$B": true, "TestAB": false} {
+		if got := re.MatchString(name); got != want {
+			t.Errorf("%s matches %s: got %t, want %t", flag, name, got, want)
+		}
+	}
+}
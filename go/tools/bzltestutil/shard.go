@@ -0,0 +1,163 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Strategies for assigning tests to shards, selected with the shard_strategy
+// attribute of go_test.
+const (
+	// shardByIndex assigns tests round-robin in the order they are declared.
+	// Examples, fuzz targets and benchmarks run in every shard.
+	shardByIndex = "index"
+	// shardByHash assigns tests by a hash of their name, so that adding or
+	// removing a test does not move the other tests to different shards.
+	shardByHash = "hash"
+	// shardByDuration assigns tests so that the shards take about the same
+	// time to run, based on durations recorded in the shard_timings files.
+	shardByDuration = "duration"
+)
+
+// ShardTests returns the names of the tests that run in the current shard,
+// or nil if the test is not sharded. names lists the tests, examples, fuzz
+// targets and benchmarks of the package in the order they are declared.
+// durations is only used by the "duration" strategy and holds the duration
+// in seconds of the tests that have one.
+//
+// The tests that run in the shard are logged to stderr.
+func ShardTests(strategy string, durations map[string]float64, names []string) map[string]bool {
+	totalShards, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
+	if err != nil || totalShards <= 1 {
+		return nil
+	}
+	file, err := os.Create(os.Getenv("TEST_SHARD_STATUS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to touch TEST_SHARD_STATUS_FILE: %v", err)
+	}
+	_ = file.Close()
+	shardIndex, err := strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
+	if err != nil || shardIndex < 0 {
+		return nil
+	}
+
+	if strategy == "" {
+		strategy = shardByIndex
+	}
+	inShard := make(map[string]bool)
+	var runnable []string
+	for _, name := range names {
+		switch {
+		case strategy == shardByIndex && !strings.HasPrefix(name, "Test"):
+			// Only tests are sharded by index, like before the other
+			// strategies were added.
+			inShard[name] = true
+		case strings.HasPrefix(name, "Benchmark") == isBenchmarking():
+			// Benchmarks only run in benchmark mode, which runs nothing else.
+			runnable = append(runnable, name)
+		}
+	}
+	names = runnable
+
+	shards, err := assignShards(strategy, durations, names, totalShards)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var shardNames []string
+	for i, name := range names {
+		if shards[i] == shardIndex {
+			inShard[name] = true
+			shardNames = append(shardNames, name)
+		}
+	}
+	log.Printf("Shard %d of %d runs %d of %d tests (%s strategy): %s", shardIndex+1, totalShards, len(shardNames), len(names), strategy, strings.Join(shardNames, ", "))
+	return inShard
+}
+
+// assignShards returns the index of the shard each test in names runs in.
+func assignShards(strategy string, durations map[string]float64, names []string, totalShards int) ([]int, error) {
+	shards := make([]int, len(names))
+	switch strategy {
+	case shardByIndex:
+		for i := range names {
+			shards[i] = i % totalShards
+		}
+
+	case shardByHash:
+		for i, name := range names {
+			h := fnv.New32a()
+			h.Write([]byte(name))
+			shards[i] = int(h.Sum32() % uint32(totalShards))
+		}
+
+	case shardByDuration:
+		// Tests without a recorded duration, usually new ones, are assumed to
+		// take as long as the average test.
+		var total float64
+		var known int
+		for _, name := range names {
+			if d, ok := durations[name]; ok {
+				total += d
+				known++
+			}
+		}
+		defaultDuration := 1.0
+		if known > 0 {
+			defaultDuration = total / float64(known)
+		}
+		weights := make([]float64, len(names))
+		order := make([]int, len(names))
+		for i, name := range names {
+			if d, ok := durations[name]; ok {
+				weights[i] = d
+			} else {
+				weights[i] = defaultDuration
+			}
+			order[i] = i
+		}
+
+		// Assign the longest tests first, each to the shard that currently
+		// has the least work. Ties are broken by name and by shard index so
+		// that the assignment is deterministic.
+		sort.SliceStable(order, func(a, b int) bool {
+			if weights[order[a]] != weights[order[b]] {
+				return weights[order[a]] > weights[order[b]]
+			}
+			return names[order[a]] < names[order[b]]
+		})
+		loads := make([]float64, totalShards)
+		for _, i := range order {
+			shard := 0
+			for s := range loads {
+				if loads[s] < loads[shard] {
+					shard = s
+				}
+			}
+			shards[i] = shard
+			loads[shard] += weights[i]
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown shard strategy: %q", strategy)
+	}
+	return shards, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAssignShardsByIndex(t *testing.T) {
+	got, err := assignShards("index", nil, []string{"TestA", "TestB", "TestC", "TestD", "TestE"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 0, 1, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAssignShardsByHashIsStable(t *testing.T) {
+	names := []string{"TestA", "TestB", "TestC", "TestD", "ExampleE"}
+	before, err := assignShards("hash", nil, names, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := assignShards("hash", nil, append([]string{"TestNew"}, names...), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after[1:]) {
+		t.Errorf("adding a test moved other tests: got %v, want %v", after[1:], before)
+	}
+}
+
+func TestAssignShardsByDuration(t *testing.T) {
+	names := []string{"TestSlow", "TestMedium", "TestFast1", "TestFast2", "TestNew"}
+	durations := map[string]float64{
+		"TestSlow":   10,
+		"TestMedium": 6,
+		"TestFast1":  1,
+		"TestFast2":  1,
+	}
+	got, err := assignShards("duration", durations, names, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TestNew is assumed to take the average of 4.5s.
+	if want := []int{0, 1, 0, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAssignShardsUnknownStrategy(t *testing.T) {
+	if _, err := assignShards("random", nil, []string{"TestA"}, 2); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestShardTests(t *testing.T) {
+	t.Setenv("TEST_TOTAL_SHARDS", "2")
+	t.Setenv("TEST_SHARD_INDEX", "1")
+	t.Setenv("TEST_SHARD_STATUS_FILE", filepath.Join(t.TempDir(), "shard_status"))
+	t.Setenv("GO_BENCH", "")
+
+	// Only tests are sharded by index; examples and benchmarks run in every
+	// shard.
+	got := ShardTests("index", nil, []string{"TestA", "BenchmarkB", "TestC", "ExampleD"})
+	if want := map[string]bool{"TestC": true, "BenchmarkB": true, "ExampleD": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = ShardTests("hash", nil, []string{"TestA", "BenchmarkB", "ExampleC", "ExampleD"})
+	if _, ok := got["BenchmarkB"]; ok {
+		t.Errorf("got %v, want no benchmarks outside of benchmark mode", got)
+	}
+
+	t.Setenv("GO_BENCH", ".")
+	got = ShardTests("duration", nil, []string{"TestA", "BenchmarkB", "TestC", "BenchmarkD"})
+	if want := map[string]bool{"BenchmarkD": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -15,9 +15,29 @@
 package bzltestutil
 
 import (
+	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
+)
+
+const (
+	// maxQuitMargin bounds how long before TEST_TIMEOUT the wrapper dumps the
+	// goroutines of the test. Bazel sends SIGTERM at TEST_TIMEOUT, so the dump
+	// has to happen before that.
+	maxQuitMargin = 10 * time.Second
+
+	// quitGracePeriod is how long the wrapper waits for the test to exit after
+	// sending SIGQUIT before it kills the test.
+	quitGracePeriod = 5 * time.Second
+
+	// goroutineDumpFile is the name of the file in TEST_UNDECLARED_OUTPUTS_DIR
+	// that the goroutine dump of a test that timed out is written to.
+	goroutineDumpFile = "test_timeout_goroutines.txt"
 )
 
 func RegisterTimeoutHandler() {
@@ -40,3 +60,144 @@ func RegisterTimeoutHandler() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM)
 }
+
+// timeoutWatcher is used by Wrap to diagnose tests that don't exit before
+// Bazel's timeout, e.g. because they hang in cgo or in TestMain before
+// -test.timeout takes effect. If the test is still running shortly before
+// TEST_TIMEOUT, it is sent SIGQUIT, which makes the Go runtime dump all
+// goroutines to stderr. The dump is also written to
+// TEST_UNDECLARED_OUTPUTS_DIR by using the watcher as a writer for the
+// stderr of the test.
+type timeoutWatcher struct {
+	mu       sync.Mutex
+	timer    *time.Timer
+	timedOut bool
+	dump     *os.File
+}
+
+// testDeadline is the time by which Bazel expects the test to finish
+// according to TEST_TIMEOUT. Wrap computes it once when it starts, so that
+// reruns of failed tests share the time of the test instead of each getting
+// all of it.
+type testDeadline struct {
+	// timeout is TEST_TIMEOUT, or zero if it is not set.
+	timeout time.Duration
+	at      time.Time
+}
+
+func newTestDeadline(now time.Time) testDeadline {
+	testTimeout, err := strconv.Atoi(os.Getenv("TEST_TIMEOUT"))
+	if err != nil || testTimeout <= 0 {
+		return testDeadline{}
+	}
+	timeout := time.Duration(testTimeout) * time.Second
+	return testDeadline{timeout: timeout, at: now.Add(timeout)}
+}
+
+// quitTime returns when a test that is still running is sent SIGQUIT.
+func (d testDeadline) quitTime() time.Time {
+	return d.at.Add(-quitMargin(d.timeout))
+}
+
+// retryTime returns how much time a rerun of failed tests starting at now has
+// before it is sent SIGQUIT. Failed tests are only rerun if this is at least
+// the margin before SIGQUIT, since the goroutine dump of a rerun that can't
+// finish in time would be of little use.
+func (d testDeadline) retryTime(now time.Time) (left time.Duration, ok bool) {
+	if d.timeout == 0 {
+		return 0, true
+	}
+	left = d.quitTime().Sub(now)
+	return left, left >= quitMargin(d.timeout)
+}
+
+// env returns the environment that sets TEST_TIMEOUT of a run of the test
+// binary starting at now to the time left before the deadline. The test
+// binary sets -test.timeout from it.
+func (d testDeadline) env(now time.Time) []string {
+	if d.timeout == 0 {
+		return nil
+	}
+	left := int(d.at.Sub(now) / time.Second)
+	if left < 1 {
+		left = 1
+	}
+	return []string{"TEST_TIMEOUT=" + strconv.Itoa(left)}
+}
+
+// start starts watching the test process p if TEST_TIMEOUT is set.
+func (w *timeoutWatcher) start(p *os.Process, deadline testDeadline) {
+	if deadline.timeout == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = time.AfterFunc(time.Until(deadline.quitTime()), func() {
+		w.quit(p, deadline.timeout)
+	})
+}
+
+// quitMargin returns how long before timeout the test is sent SIGQUIT. The
+// margin is a tenth of the timeout, up to maxQuitMargin, so that short
+// timeouts still leave the test most of its time.
+func quitMargin(timeout time.Duration) time.Duration {
+	if margin := timeout / 10; margin < maxQuitMargin {
+		return margin
+	}
+	return maxQuitMargin
+}
+
+func (w *timeoutWatcher) quit(p *os.Process, timeout time.Duration) {
+	w.mu.Lock()
+	w.timedOut = true
+	if dir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"); dir != "" {
+		f, err := os.Create(filepath.Join(dir, goroutineDumpFile))
+		if err != nil {
+			log.Printf("Failed to create goroutine dump: %s", err)
+		} else {
+			w.dump = f
+		}
+	}
+	w.mu.Unlock()
+
+	log.Printf("Test is still running %s before TEST_TIMEOUT of %s, sending SIGQUIT to dump its goroutines", quitMargin(timeout), timeout)
+	if err := p.Signal(syscall.SIGQUIT); err != nil {
+		// SIGQUIT is not supported on Windows.
+		p.Kill()
+		return
+	}
+	time.AfterFunc(quitGracePeriod, func() {
+		// Tests can intercept SIGQUIT with signal.Notify.
+		p.Kill()
+	})
+}
+
+// Write writes to the goroutine dump once the test has timed out and discards
+// p otherwise.
+func (w *timeoutWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dump != nil {
+		if _, err := w.dump.Write(p); err != nil {
+			log.Printf("Failed to write goroutine dump: %s", err)
+			w.dump.Close()
+			w.dump = nil
+		}
+	}
+	return len(p), nil
+}
+
+// stop stops watching the test after it exited and reports whether it was
+// stopped because it timed out.
+func (w *timeoutWatcher) stop() (timedOut bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.dump != nil {
+		w.dump.Close()
+		w.dump = nil
+	}
+	return w.timedOut
+}
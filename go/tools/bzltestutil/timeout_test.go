@@ -0,0 +1,76 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuitMargin(t *testing.T) {
+	for _, tt := range []struct {
+		timeout, want time.Duration
+	}{
+		{timeout: time.Second, want: 100 * time.Millisecond},
+		{timeout: 60 * time.Second, want: 6 * time.Second},
+		{timeout: 300 * time.Second, want: maxQuitMargin},
+		{timeout: 3600 * time.Second, want: maxQuitMargin},
+	} {
+		if got := quitMargin(tt.timeout); got != tt.want {
+			t.Errorf("quitMargin(%s) = %s, want %s", tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestTestDeadline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Setenv("TEST_TIMEOUT", "60")
+	d := newTestDeadline(start)
+	if want := start.Add(54 * time.Second); !d.quitTime().Equal(want) {
+		t.Errorf("quitTime() = %s, want %s", d.quitTime(), want)
+	}
+	for _, tt := range []struct {
+		elapsed  time.Duration
+		wantLeft time.Duration
+		wantOk   bool
+		wantEnv  []string
+	}{
+		{elapsed: 0, wantLeft: 54 * time.Second, wantOk: true, wantEnv: []string{"TEST_TIMEOUT=60"}},
+		{elapsed: 30*time.Second + 500*time.Millisecond, wantLeft: 23*time.Second + 500*time.Millisecond, wantOk: true, wantEnv: []string{"TEST_TIMEOUT=29"}},
+		{elapsed: 48 * time.Second, wantLeft: 6 * time.Second, wantOk: true, wantEnv: []string{"TEST_TIMEOUT=12"}},
+		{elapsed: 50 * time.Second, wantLeft: 4 * time.Second, wantOk: false, wantEnv: []string{"TEST_TIMEOUT=10"}},
+		{elapsed: 70 * time.Second, wantLeft: -16 * time.Second, wantOk: false, wantEnv: []string{"TEST_TIMEOUT=1"}},
+	} {
+		now := start.Add(tt.elapsed)
+		if left, ok := d.retryTime(now); left != tt.wantLeft || ok != tt.wantOk {
+			t.Errorf("after %s: retryTime() = %s, %t, want %s, %t", tt.elapsed, left, ok, tt.wantLeft, tt.wantOk)
+		}
+		if env := d.env(now); !reflect.DeepEqual(env, tt.wantEnv) {
+			t.Errorf("after %s: env() = %v, want %v", tt.elapsed, env, tt.wantEnv)
+		}
+	}
+}
+
+func TestTestDeadlineUnset(t *testing.T) {
+	t.Setenv("TEST_TIMEOUT", "")
+	d := newTestDeadline(time.Now())
+	if _, ok := d.retryTime(time.Now().Add(time.Hour)); !ok {
+		t.Error("retryTime() = false without TEST_TIMEOUT, want true")
+	}
+	if env := d.env(time.Now()); env != nil {
+		t.Errorf("env() = %v without TEST_TIMEOUT, want nil", env)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir"
 )
@@ -38,6 +39,10 @@ import (
 // We use 6, in line with Bazel's RUN_FAILURE.
 const TestWrapperAbnormalExit = 6
 
+// jsonOutputFile is the name of the file in TEST_UNDECLARED_OUTPUTS_DIR that
+// Wrap writes the test2json event stream to.
+const jsonOutputFile = "test.json"
+
 func ShouldWrap() bool {
 	if wrapEnv, ok := os.LookupEnv("GO_TEST_WRAP"); ok {
 		wrap, err := strconv.ParseBool(wrapEnv)
@@ -46,10 +51,39 @@ func ShouldWrap() bool {
 		}
 		return wrap
 	}
+	if isFuzzing() {
+		// The wrapper preserves the files written while fuzzing.
+		return true
+	}
+	if write, explicit := shouldWriteJSON(); write && explicit {
+		return true
+	}
+	if retryAttempts() > 0 {
+		// Failed tests are retried by the wrapper.
+		return true
+	}
 	_, ok := os.LookupEnv("XML_OUTPUT_FILE")
 	return ok
 }
 
+// shouldWriteJSON indicates if the wrapper should write the test2json event
+// stream to TEST_UNDECLARED_OUTPUTS_DIR. This is the default, which can be
+// disabled by setting GO_TEST_JSON=0. Setting GO_TEST_JSON=1 explicitly also
+// enables the wrapper when no XML report is requested, writes the stream to
+// stdout if TEST_UNDECLARED_OUTPUTS_DIR is not set, and runs the test binary
+// with -test.v, like 'go test -json'.
+func shouldWriteJSON() (write, explicit bool) {
+	jsonEnv, ok := os.LookupEnv("GO_TEST_JSON")
+	if !ok {
+		return true, false
+	}
+	write, err := strconv.ParseBool(jsonEnv)
+	if err != nil {
+		log.Fatalf("invalid value for GO_TEST_JSON: %q", jsonEnv)
+	}
+	return write, true
+}
+
 // shouldAddTestV indicates if the test wrapper should prepend a -test.v flag to
 // the test args. This is required to get information about passing tests from
 // test2json for complete XML reports.
@@ -61,7 +95,27 @@ func shouldAddTestV() bool {
 		}
 		return wrap
 	}
-	return false
+	if retryAttempts() > 0 {
+		// Tests that pass on retry are only reported with -test.v.
+		return true
+	}
+	write, explicit := shouldWriteJSON()
+	return write && explicit
+}
+
+// shouldWriteDetailedXML indicates if the XML report should be written in the
+// detailed format, which is selected by setting GO_TEST_XML_REPORT=detailed.
+// The default format is "flat".
+func shouldWriteDetailedXML() bool {
+	switch format := os.Getenv("GO_TEST_XML_REPORT"); format {
+	case "", "flat":
+		return false
+	case "detailed":
+		return true
+	default:
+		log.Fatalf("invalid value for GO_TEST_XML_REPORT: %q", format)
+		return false
+	}
 }
 
 // streamMerger intelligently merges an input stdout and stderr stream and dumps
@@ -112,9 +166,20 @@ func (m *streamMerger) Wait() {
 }
 
 func Wrap(pkg string) error {
+	// Check the format of the report before running the test, so that an
+	// invalid value doesn't discard the results.
+	detailedXML := shouldWriteDetailedXML()
+
 	var jsonBuffer bytes.Buffer
-	jsonConverter := NewConverter(&jsonBuffer, pkg, Timestamp)
-	streamMerger := NewStreamMerger(jsonConverter)
+	var jsonOutput io.Writer = &jsonBuffer
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	outputsDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if write, explicit := shouldWriteJSON(); write && explicit && outputsDir == "" {
+		// Without an output directory, e.g. with 'bazel run', the event
+		// stream replaces the output of the test, like with 'go test -json'.
+		jsonOutput = io.MultiWriter(&jsonBuffer, os.Stdout)
+		stdout, stderr = io.Discard, io.Discard
+	}
 
 	args := os.Args[1:]
 	if shouldAddTestV() {
@@ -132,18 +197,66 @@ func Wrap(pkg string) error {
 	// will be killed by Bazel after the grace period (15s) expires.
 	signal.Ignore(syscall.SIGTERM)
 
-	cmd := exec.Command(exePath, args...)
-	cmd.Env = append(os.Environ(), "GO_TEST_WRAP=0")
-	cmd.Stderr = io.MultiWriter(os.Stderr, streamMerger.ErrW)
-	cmd.Stdout = io.MultiWriter(os.Stdout, streamMerger.OutW)
-	streamMerger.Start()
-	err := cmd.Run()
-	streamMerger.ErrW.Close()
-	streamMerger.OutW.Close()
-	streamMerger.Wait()
-	jsonConverter.Close()
+	var fuzz *fuzzOutputs
+	if isFuzzing() {
+		var err error
+		if fuzz, err = newFuzzOutputs(pkg); err != nil {
+			return fmt.Errorf("error preparing fuzzing: %s", err)
+		}
+	}
+
+	deadline := newTestDeadline(time.Now())
+	retries := retryAttempts()
+	runArgs := args
+	var runEnv []string
+	var err error
+	var timedOut bool
+	for attempt := 1; ; attempt++ {
+		attemptStart := jsonBuffer.Len()
+		timedOut, err = runTestBinary(exePath, runArgs, runEnv, pkg, deadline, jsonOutput, stdout, stderr)
+		if attempt > retries || timedOut || !isTestFailure(err) {
+			break
+		}
+		failed, ferr := failedTests(bytes.NewReader(jsonBuffer.Bytes()[attemptStart:]))
+		if ferr != nil {
+			log.Printf("Failed to find the failed tests: %s", ferr)
+			break
+		} else if len(failed) == 0 {
+			break
+		}
+		now := time.Now()
+		if left, ok := deadline.retryTime(now); !ok {
+			log.Printf("Not retrying %d failed tests, only %s is left before TEST_TIMEOUT of %s: %s", len(failed), left.Round(time.Second), deadline.timeout, strings.Join(failed, ", "))
+			break
+		}
+		log.Printf("Retrying %d failed tests (retry %d of %d): %s", len(failed), attempt, retries, strings.Join(failed, ", "))
+		// The last -test.run flag takes precedence.
+		runArgs = append(args[:len(args):len(args)], retryRunFlag(failed))
+		runEnv = deadline.env(now)
+	}
+	if fuzz != nil {
+		if ferr := fuzz.collect(); ferr != nil {
+			log.Printf("Failed to save fuzzing inputs: %s", ferr)
+		}
+	}
+	if outputsDir != "" {
+		if write, _ := shouldWriteJSON(); write {
+			if jerr := ioutil.WriteFile(filepath.Join(outputsDir, jsonOutputFile), jsonBuffer.Bytes(), 0664); jerr != nil {
+				log.Printf("Failed to write %s: %s", jsonOutputFile, jerr)
+			}
+		}
+	}
+	if isBenchmarking() {
+		if berr := writeBenchmarkResults(bytes.NewReader(jsonBuffer.Bytes())); berr != nil {
+			log.Printf("Failed to save benchmark results: %s", berr)
+		}
+	}
 	if out, ok := os.LookupEnv("XML_OUTPUT_FILE"); ok {
-		werr := writeReport(jsonBuffer, pkg, out)
+		werr := writeReport(jsonBuffer, pkg, out, xmlReportOptions{
+			detailed: detailedXML,
+			timedOut: timedOut,
+			retried:  retries > 0,
+		})
 		if werr != nil {
 			if err != nil {
 				return fmt.Errorf("error while generating testreport: %s, (error wrapping test execution: %s)", werr, err)
@@ -154,8 +267,35 @@ func Wrap(pkg string) error {
 	return err
 }
 
-func writeReport(jsonBuffer bytes.Buffer, pkg string, path string) error {
-	xml, cerr := json2xml(&jsonBuffer, pkg)
+// runTestBinary runs the test binary once with args and env added to the
+// environment and converts its output to test2json's format into jsonOutput.
+// It returns whether the binary was stopped because it didn't finish before
+// deadline.
+func runTestBinary(exePath string, args, env []string, pkg string, deadline testDeadline, jsonOutput, stdout, stderr io.Writer) (timedOut bool, err error) {
+	jsonConverter := NewConverter(jsonOutput, pkg, Timestamp)
+	streamMerger := NewStreamMerger(jsonConverter)
+
+	cmd := exec.Command(exePath, args...)
+	cmd.Env = append(append(os.Environ(), "GO_TEST_WRAP=0"), env...)
+	var timeout timeoutWatcher
+	cmd.Stderr = io.MultiWriter(stderr, streamMerger.ErrW, &timeout)
+	cmd.Stdout = io.MultiWriter(stdout, streamMerger.OutW)
+	streamMerger.Start()
+	err = cmd.Start()
+	if err == nil {
+		timeout.start(cmd.Process, deadline)
+		err = cmd.Wait()
+	}
+	timedOut = timeout.stop()
+	streamMerger.ErrW.Close()
+	streamMerger.OutW.Close()
+	streamMerger.Wait()
+	jsonConverter.Close()
+	return timedOut, err
+}
+
+func writeReport(jsonBuffer bytes.Buffer, pkg string, path string, opts xmlReportOptions) error {
+	xml, cerr := json2xml(&jsonBuffer, pkg, opts)
 	if cerr != nil {
 		return fmt.Errorf("error converting test output to xml: %s", cerr)
 	}
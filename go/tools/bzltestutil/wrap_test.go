@@ -43,6 +43,54 @@ func TestShouldWrap(t *testing.T) {
 				"XML_OUTPUT_FILE": "path",
 			},
 			shouldWrap: true,
+		}, {
+			envs: map[string]string{
+				"GO_TEST_WRAP":    "",
+				"XML_OUTPUT_FILE": "",
+				"GO_FUZZ_TARGET":  "FuzzFoo",
+			},
+			shouldWrap: true,
+		}, {
+			envs: map[string]string{
+				"GO_TEST_WRAP":    "0",
+				"XML_OUTPUT_FILE": "",
+				"GO_FUZZ_TARGET":  "FuzzFoo",
+			},
+			shouldWrap: false,
+		}, {
+			envs: map[string]string{
+				"GO_TEST_WRAP":    "",
+				"XML_OUTPUT_FILE": "",
+				"GO_FUZZ_TARGET":  "",
+				"GO_TEST_JSON":    "1",
+			},
+			shouldWrap: true,
+		}, {
+			envs: map[string]string{
+				"GO_TEST_WRAP":    "",
+				"XML_OUTPUT_FILE": "",
+				"GO_FUZZ_TARGET":  "",
+				"GO_TEST_JSON":    "0",
+			},
+			shouldWrap: false,
+		}, {
+			envs: map[string]string{
+				"GO_TEST_WRAP":         "",
+				"XML_OUTPUT_FILE":      "",
+				"GO_FUZZ_TARGET":       "",
+				"GO_TEST_JSON":         "",
+				"GO_TEST_RETRY_FAILED": "2",
+			},
+			shouldWrap: true,
+		}, {
+			envs: map[string]string{
+				"GO_TEST_WRAP":         "",
+				"XML_OUTPUT_FILE":      "",
+				"GO_FUZZ_TARGET":       "",
+				"GO_TEST_JSON":         "",
+				"GO_TEST_RETRY_FAILED": "0",
+			},
+			shouldWrap: false,
 		},
 	}
 	for _, tt := range tests {
@@ -61,3 +109,31 @@ func TestShouldWrap(t *testing.T) {
 		})
 	}
 }
+
+func TestShouldAddTestV(t *testing.T) {
+	for _, tt := range []struct {
+		testV, json, retry string
+		want               bool
+	}{
+		{want: false},
+		{testV: "1", want: true},
+		{json: "1", want: true},
+		{json: "0", want: false},
+		{testV: "0", json: "1", want: false},
+		{retry: "1", want: true},
+		{testV: "0", retry: "1", want: false},
+	} {
+		t.Run(fmt.Sprintf("GO_TEST_WRAP_TESTV=%s,GO_TEST_JSON=%s,GO_TEST_RETRY_FAILED=%s", tt.testV, tt.json, tt.retry), func(t *testing.T) {
+			for k, v := range map[string]string{"GO_TEST_WRAP_TESTV": tt.testV, "GO_TEST_JSON": tt.json, "GO_TEST_RETRY_FAILED": tt.retry} {
+				if v == "" {
+					os.Unsetenv(k)
+				} else {
+					os.Setenv(k, v)
+				}
+			}
+			if got := shouldAddTestV(); got != tt.want {
+				t.Errorf("shouldAddTestV returned %t, expected %t", got, tt.want)
+			}
+		})
+	}
+}
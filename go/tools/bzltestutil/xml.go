@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -42,13 +43,29 @@ type xmlTestSuite struct {
 }
 
 type xmlTestCase struct {
-	XMLName   xml.Name    `xml:"testcase"`
-	Classname string      `xml:"classname,attr"`
-	Name      string      `xml:"name,attr"`
-	Time      string      `xml:"time,attr"`
-	Failure   *xmlMessage `xml:"failure,omitempty"`
-	Error     *xmlMessage `xml:"error,omitempty"`
-	Skipped   *xmlMessage `xml:"skipped,omitempty"`
+	XMLName    xml.Name       `xml:"testcase"`
+	Classname  string         `xml:"classname,attr"`
+	Name       string         `xml:"name,attr"`
+	Time       string         `xml:"time,attr"`
+	Properties *xmlProperties `xml:"properties,omitempty"`
+	Failure    *xmlMessage    `xml:"failure,omitempty"`
+	Error      *xmlMessage    `xml:"error,omitempty"`
+	Skipped    *xmlMessage    `xml:"skipped,omitempty"`
+	// FlakyFailures and RerunFailures hold the failures of previous attempts
+	// of a test that was retried and eventually passed or failed,
+	// respectively, like in Maven Surefire's reports.
+	FlakyFailures []xmlMessage `xml:"flakyFailure,omitempty"`
+	RerunFailures []xmlMessage `xml:"rerunFailure,omitempty"`
+	SystemOut     string       `xml:"system-out,omitempty"`
+}
+
+type xmlProperties struct {
+	Properties []xmlProperty `xml:"property"`
+}
+
+type xmlProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
 }
 
 type xmlMessage struct {
@@ -71,12 +88,35 @@ type testCase struct {
 	state    string
 	output   strings.Builder
 	duration *float64
+	// metrics holds the results of a benchmark, one set per run.
+	metrics []xmlProperty
+	// failedAttempts holds the output of previous attempts that failed if
+	// the test was retried.
+	failedAttempts []string
+	// lastRun orders the tests by their last run or cont event, which is
+	// used to find the test that was running last.
+	lastRun int
+}
+
+// xmlReportOptions controls how json2xml builds the report.
+type xmlReportOptions struct {
+	// detailed selects toDetailedXML instead of toXML.
+	detailed bool
+	// timedOut is set if the wrapper stopped the test because it was about to
+	// exceed TEST_TIMEOUT. The tests that were still running are reported as timed
+	// out.
+	timedOut bool
+	// retried is set if the wrapper reran failed tests. Tests that failed
+	// and then passed are reported as flaky.
+	retried bool
 }
 
 // json2xml converts test2json's output into an xml output readable by Bazel.
 // http://windyroad.com.au/dl/Open%20Source/JUnit.xsd
-func json2xml(r io.Reader, pkgName string) ([]byte, error) {
+func json2xml(r io.Reader, pkgName string, opts xmlReportOptions) ([]byte, error) {
 	var pkgDuration *float64
+	var pkgOutput strings.Builder
+	runs := 0
 	testcases := make(map[string]*testCase)
 	testCaseByName := func(name string) *testCase {
 		if name == "" {
@@ -99,11 +139,33 @@ func json2xml(r io.Reader, pkgName string) ([]byte, error) {
 		switch s := e.Action; s {
 		case "run":
 			if c := testCaseByName(e.Test); c != nil {
+				if opts.retried && c.state == "fail" {
+					c.failedAttempts = append(c.failedAttempts, c.output.String())
+					c.output.Reset()
+				}
 				c.state = s
+				runs++
+				c.lastRun = runs
+			}
+		case "cont":
+			if c := testCaseByName(e.Test); c != nil {
+				runs++
+				c.lastRun = runs
 			}
 		case "output":
 			if c := testCaseByName(e.Test); c != nil {
 				c.output.WriteString(e.Output)
+			} else {
+				pkgOutput.WriteString(e.Output)
+			}
+			// Benchmarks that succeed have no events of their own, only a
+			// result line in the output of the package.
+			if name, metrics, ok := parseBenchmarkResult(strings.TrimSuffix(e.Output, "\n")); ok {
+				c := testCaseByName(name)
+				if c.state == "" {
+					c.state = "pass"
+				}
+				c.metrics = append(c.metrics, metrics...)
 			}
 		case "skip":
 			if c := testCaseByName(e.Test); c != nil {
@@ -128,6 +190,17 @@ func json2xml(r io.Reader, pkgName string) ([]byte, error) {
 		}
 	}
 
+	if opts.timedOut {
+		for _, c := range testcases {
+			if c.state != "pass" && c.state != "fail" && c.state != "skip" {
+				c.state = "timeout"
+			}
+		}
+	}
+
+	if opts.detailed {
+		return xml.MarshalIndent(toDetailedXML(pkgName, pkgDuration, testcases, pkgOutput.String()), "", "\t")
+	}
 	return xml.MarshalIndent(toXML(pkgName, pkgDuration, testcases), "", "\t")
 }
 
@@ -153,6 +226,9 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 		if c.duration != nil {
 			newCase.Time = fmt.Sprintf("%.3f", *c.duration)
 		}
+		if len(c.metrics) > 0 {
+			newCase.Properties = &xmlProperties{Properties: c.metrics}
+		}
 		switch c.state {
 		case "skip":
 			suite.Skipped++
@@ -168,6 +244,12 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 			}
 		case "pass":
 			break
+		case "timeout":
+			suite.Errors++
+			newCase.Error = &xmlMessage{
+				Message:  "timed out",
+				Contents: c.output.String(),
+			}
 		default:
 			suite.Errors++
 			newCase.Error = &xmlMessage{
@@ -175,7 +257,210 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 				Contents: c.output.String(),
 			}
 		}
+		addFailedAttempts(&newCase, c, func(output string) (string, string) {
+			return "Failed", output
+		})
+		suite.TestCases = append(suite.TestCases, newCase)
+	}
+	return &xmlTestSuites{Suites: []xmlTestSuite{suite}}
+}
+
+var (
+	// _failureLocationPattern matches the lines written by t.Error and
+	// friends, e.g. "    foo_test.go:12: message".
+	_failureLocationPattern = regexp.MustCompile(`^\s+(\S+\.go:\d+): (.*)$`)
+	// _frameLinePattern matches the lines written by the testing package
+	// itself when tests start and end.
+	_frameLinePattern = regexp.MustCompile(`^\s*(=== (RUN|PAUSE|CONT|NAME)|--- (PASS|FAIL|SKIP):)`)
+	// _runningTestPattern matches the tests listed after "running tests:"
+	// when a test binary times out, e.g. "\t\tTestFoo (1m0s)".
+	_runningTestPattern = regexp.MustCompile(`^\t\t(\S+) \(.*\)$`)
+)
+
+const (
+	_panicPrefix   = "panic: "
+	_timeoutPrefix = "panic: test timed out after "
+)
+
+// toDetailedXML is like toXML, but
+//   - reports subtests with the name of their parent test as the classname,
+//     e.g. "pkg/testing.TestFoo" for "TestFoo/case_3", so that they are
+//     grouped under their parent,
+//   - stores the output of each test in its system-out element,
+//   - uses the location and message of the first error reported by a failed
+//     test as the failure message, e.g. "foo_test.go:12: unexpected value",
+//   - reports the tests that were running when the test binary panicked or
+//     timed out as errors with the panic or timeout as the message and
+//     "panic" or "timeout" as the type.
+func toDetailedXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase, pkgOutput string) *xmlTestSuites {
+	cases := make([]string, 0, len(testcases))
+	for k := range testcases {
+		cases = append(cases, k)
+	}
+	sort.Strings(cases)
+	suite := xmlTestSuite{
+		Name: pkgName,
+	}
+	if pkgDuration != nil {
+		suite.Time = fmt.Sprintf("%.3f", *pkgDuration)
+	}
+
+	panicTest, panicMessage, timedOut := findPanic(testcases, pkgOutput)
+	for _, name := range cases {
+		c := testcases[name]
+		output := c.output.String()
+		suite.Tests++
+		newCase := xmlTestCase{
+			Name:      name,
+			Classname: pkgName,
+			SystemOut: output,
+		}
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			newCase.Name = name[i+1:]
+			newCase.Classname = pkgName + "." + name[:i]
+		}
+		if c.duration != nil {
+			newCase.Time = fmt.Sprintf("%.3f", *c.duration)
+		}
+		if len(c.metrics) > 0 {
+			newCase.Properties = &xmlProperties{Properties: c.metrics}
+		}
+		switch c.state {
+		case "skip":
+			suite.Skipped++
+			newCase.Skipped = &xmlMessage{
+				Message:  "Skipped",
+				Contents: testLogLines(output),
+			}
+		case "fail":
+			suite.Failures++
+			message, contents := failureDetails(output)
+			newCase.Failure = &xmlMessage{
+				Message:  message,
+				Contents: contents,
+			}
+		case "pass":
+			break
+		case "timeout":
+			suite.Errors++
+			newCase.Error = &xmlMessage{
+				Message:  "timed out",
+				Type:     "timeout",
+				Contents: testLogLines(output),
+			}
+		default:
+			suite.Errors++
+			newCase.Error = &xmlMessage{
+				Message:  "No pass/skip/fail event found for test",
+				Contents: testLogLines(output),
+			}
+			switch {
+			case timedOut[name]:
+				newCase.Error.Message = strings.TrimPrefix(panicMessage, "panic: ")
+				newCase.Error.Type = "timeout"
+			case name == panicTest:
+				newCase.Error.Message = panicMessage
+				newCase.Error.Type = "panic"
+			case panicTest != "":
+				newCase.Error.Message = fmt.Sprintf("Interrupted by panic in %s: %s", panicTest, panicMessage)
+				newCase.Error.Type = "panic"
+			}
+		}
+		addFailedAttempts(&newCase, c, failureDetails)
 		suite.TestCases = append(suite.TestCases, newCase)
 	}
 	return &xmlTestSuites{Suites: []xmlTestSuite{suite}}
 }
+
+// addFailedAttempts reports the failed attempts of a retried test as flaky
+// failures if the test eventually passed, and as rerun failures otherwise.
+func addFailedAttempts(newCase *xmlTestCase, c *testCase, details func(output string) (message, contents string)) {
+	for _, output := range c.failedAttempts {
+		message, contents := details(output)
+		attempt := xmlMessage{Message: message, Contents: contents}
+		if c.state == "pass" {
+			newCase.FlakyFailures = append(newCase.FlakyFailures, attempt)
+		} else {
+			newCase.RerunFailures = append(newCase.RerunFailures, attempt)
+		}
+	}
+}
+
+// findPanic returns the test whose output contains the panic that ended the
+// test binary, if any, and the first line of the panic. If the panic was
+// caused by a timeout, timedOut contains the tests that were running at the
+// time.
+func findPanic(testcases map[string]*testCase, pkgOutput string) (panicTest, panicMessage string, timedOut map[string]bool) {
+	// The panic is attributed to the test that was started or continued last
+	// among the unfinished tests whose output contains a panic, or to the
+	// package if there is none.
+	var running []string
+	for name, c := range testcases {
+		if c.state != "pass" && c.state != "fail" && c.state != "skip" {
+			running = append(running, name)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return testcases[running[i]].lastRun > testcases[running[j]].lastRun
+	})
+	output := pkgOutput
+	for _, name := range running {
+		if o := testcases[name].output.String(); strings.Contains(o, "\n"+_panicPrefix) || strings.HasPrefix(o, _panicPrefix) {
+			panicTest, output = name, o
+			break
+		}
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, _panicPrefix) {
+			continue
+		}
+		panicMessage = line
+		if !strings.HasPrefix(line, _timeoutPrefix) {
+			return panicTest, panicMessage, nil
+		}
+		timedOut = make(map[string]bool)
+		if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "running tests:" {
+			for _, l := range lines[i+2:] {
+				m := _runningTestPattern.FindStringSubmatch(l)
+				if m == nil {
+					break
+				}
+				timedOut[m[1]] = true
+			}
+		}
+		if len(timedOut) == 0 && panicTest != "" {
+			// Versions of Go before 1.20 don't list the running tests.
+			timedOut[panicTest] = true
+		}
+		return panicTest, panicMessage, timedOut
+	}
+	return "", "", nil
+}
+
+// failureDetails returns the location and message of the first error reported
+// by a failed test, or "Failed" if there is none, together with the lines
+// logged by the test.
+func failureDetails(output string) (message, contents string) {
+	message = "Failed"
+	contents = testLogLines(output)
+	for _, line := range strings.Split(contents, "\n") {
+		if m := _failureLocationPattern.FindStringSubmatch(line); m != nil {
+			message = m[1] + ": " + m[2]
+			break
+		}
+	}
+	return message, contents
+}
+
+// testLogLines returns the output of a test without the lines written by the
+// testing package when the test starts and ends.
+func testLogLines(output string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if line != "" && !_frameLinePattern.MatchString(line) {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
@@ -32,23 +32,37 @@ func TestJSON2XML(t *testing.T) {
 	for _, file := range files {
 		name := strings.TrimSuffix(filepath.Base(file), ".json")
 		t.Run(name, func(t *testing.T) {
-			orig, err := os.Open(file)
-			if err != nil {
-				t.Fatal(err)
-			}
-			got, err := json2xml(orig, "pkg/testing")
-			if err != nil {
-				t.Fatal(err)
-			}
+			for _, format := range []struct {
+				suffix string
+				opts   xmlReportOptions
+			}{
+				{".xml", xmlReportOptions{}},
+				{".detailed.xml", xmlReportOptions{detailed: true}},
+				{".timedout.xml", xmlReportOptions{timedOut: true}},
+				{".retried.xml", xmlReportOptions{retried: true}},
+				{".retried.detailed.xml", xmlReportOptions{retried: true, detailed: true}},
+			} {
+				target := strings.TrimSuffix(file, ".json") + format.suffix
+				want, err := ioutil.ReadFile(target)
+				if os.IsNotExist(err) && format.suffix != ".xml" {
+					continue
+				} else if err != nil {
+					t.Fatal(err)
+				}
 
-			target := strings.TrimSuffix(file, ".json") + ".xml"
-			want, err := ioutil.ReadFile(target)
-			if err != nil {
-				t.Fatal(err)
-			}
+				orig, err := os.Open(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := json2xml(orig, "pkg/testing", format.opts)
+				orig.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
 
-			if !bytes.Equal(got, want) {
-				t.Errorf("json2xml for %s does not match, got:\n%s\nwant:\n%s\n", name, string(got), string(want))
+				if !bytes.Equal(got, want) {
+					t.Errorf("json2xml for %s does not match %s, got:\n%s\nwant:\n%s\n", name, target, string(got), string(want))
+				}
 			}
 		})
 	}
@@ -0,0 +1,46 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package funcname names function declarations the way rules_go reports them
+// in coverage reports and nogo baselines.
+package funcname
+
+import "go/ast"
+
+// Of returns the name of the function declared by fn. Methods are named like
+// "(*T).M" or "T.M", without the type parameters of generic receivers.
+func Of(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := fn.Recv.List[0].Type
+	star := false
+	if s, ok := recv.(*ast.StarExpr); ok {
+		star = true
+		recv = s.X
+	}
+	// The first identifier is the type name, even for generic receivers
+	// such as T[K, V].
+	name := "?"
+	ast.Inspect(recv, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && name == "?" {
+			name = id.Name
+		}
+		return name == "?"
+	})
+	if star {
+		return "(*" + name + ")." + fn.Name.Name
+	}
+	return name + "." + fn.Name.Name
+}
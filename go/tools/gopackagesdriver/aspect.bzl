@@ -35,6 +35,11 @@ PROTO_COMPILER_ATTRS = [
     "library",
 ]
 
+# The binary built by go_cross_binary for its platform.
+CROSS_ATTRS = [
+    "target",
+]
+
 def bazel_supports_canonical_label_literals():
     return str(Label("//:bogus")).startswith("@@")
 
@@ -55,12 +60,18 @@ def _go_archive_to_pkg(archive):
         for src in archive.data.srcs
         if src.path.endswith(".go")
     ]
+    mode = archive.source.mode
+    compiled_go_files = list(go_files)
+    if archive.data._cgo_go_srcs:
+        # The directory of the files generated by cgo is expanded by the driver,
+        # since its contents are not known during analysis.
+        compiled_go_files.append(file_path(archive.data._cgo_go_srcs))
     return struct(
         ID = str(archive.data.label),
         PkgPath = archive.data.importpath,
         ExportFile = file_path(archive.data.export_file),
         GoFiles = go_files,
-        CompiledGoFiles = go_files,
+        CompiledGoFiles = compiled_go_files,
         OtherFiles = [
             file_path(src)
             for src in archive.data.srcs
@@ -70,8 +81,21 @@ def _go_archive_to_pkg(archive):
             pkg.data.importpath: str(pkg.data.label)
             for pkg in archive.direct
         },
+        # The configuration the package is built in, which determines the
+        # files that are compiled.
+        Platform = struct(
+            GOOS = mode.goos,
+            GOARCH = mode.goarch,
+            Tags = mode.tags,
+            CgoEnabled = not mode.pure,
+        ),
     )
 
+def _archive_compiled_go_files(archive):
+    if archive.data._cgo_go_srcs:
+        return archive.source.srcs + [archive.data._cgo_go_srcs]
+    return archive.source.srcs
+
 def make_pkg_json(ctx, name, pkg_info):
     pkg_json_file = ctx.actions.declare_file(name + ".pkg.json")
     ctx.actions.write(pkg_json_file, content = json.encode(pkg_info))
@@ -85,7 +109,10 @@ def _go_pkg_info_aspect_impl(target, ctx):
     transitive_export_files = []
     transitive_compiled_go_files = []
 
-    for attr in DEPS_ATTRS + PROTO_COMPILER_ATTRS:
+    attrs = DEPS_ATTRS + PROTO_COMPILER_ATTRS
+    if ctx.rule.kind == "go_cross_binary":
+        attrs = attrs + CROSS_ATTRS
+    for attr in attrs:
         deps = getattr(ctx.rule.attr, attr, []) or []
 
         # Some attrs are not iterable, ensure that deps is always iterable.
@@ -109,7 +136,7 @@ def _go_pkg_info_aspect_impl(target, ctx):
 
     if GoArchive in target:
         archive = target[GoArchive]
-        compiled_go_files.extend(archive.source.srcs)
+        compiled_go_files.extend(_archive_compiled_go_files(archive))
         export_files.append(archive.data.export_file)
         pkg = _go_archive_to_pkg(archive)
         pkg_json_files.append(make_pkg_json(ctx, archive.data.name, pkg))
@@ -120,7 +147,7 @@ def _go_pkg_info_aspect_impl(target, ctx):
                 if archive.data.label == dep_archive.data.label:
                     pkg = _go_archive_to_pkg(dep_archive)
                     pkg_json_files.append(make_pkg_json(ctx, dep_archive.data.name, pkg))
-                    compiled_go_files.extend(dep_archive.source.srcs)
+                    compiled_go_files.extend(_archive_compiled_go_files(dep_archive))
                     export_files.append(dep_archive.data.export_file)
                     break
 
@@ -157,7 +184,7 @@ def _go_pkg_info_aspect_impl(target, ctx):
 
 go_pkg_info_aspect = aspect(
     implementation = _go_pkg_info_aspect_impl,
-    attr_aspects = DEPS_ATTRS + PROTO_COMPILER_ATTRS,
+    attr_aspects = DEPS_ATTRS + PROTO_COMPILER_ATTRS + CROSS_ATTRS,
     attrs = {
         "_go_stdlib": attr.label(
             default = "//:stdlib",
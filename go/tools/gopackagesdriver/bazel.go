@@ -54,6 +54,32 @@ type BEPNamedSet struct {
 	} `json:"namedSetOfFiles"`
 }
 
+// BEPEvent is a build event with its outputs or errors.
+type BEPEvent struct {
+	BEPNamedSet
+	ID      BEPEventID  `json:"id"`
+	Action  *BEPAction  `json:"action"`
+	Aborted *BEPAborted `json:"aborted"`
+}
+
+type BEPEventID struct {
+	ActionCompleted   *BEPLabel `json:"actionCompleted"`
+	TargetConfigured  *BEPLabel `json:"targetConfigured"`
+	TargetCompleted   *BEPLabel `json:"targetCompleted"`
+	ConfiguredLabel   *BEPLabel `json:"configuredLabel"`
+	UnconfiguredLabel *BEPLabel `json:"unconfiguredLabel"`
+}
+
+// label returns the label of the target the event is about, if any.
+func (id *BEPEventID) label() string {
+	for _, l := range []*BEPLabel{id.ActionCompleted, id.TargetConfigured, id.TargetCompleted, id.ConfiguredLabel, id.UnconfiguredLabel} {
+		if l != nil {
+			return l.Label
+		}
+	}
+	return ""
+}
+
 func NewBazel(ctx context.Context, bazelBin, workspaceRoot string, buildWorkingDirectory string, bazelCommonFlags []string, bazelStartupFlags []string) (*Bazel, error) {
 	b := &Bazel{
 		bazelBin:              bazelBin,
@@ -102,10 +128,12 @@ func (b *Bazel) run(ctx context.Context, command string, args ...string) (string
 	return string(output), err
 }
 
-func (b *Bazel) Build(ctx context.Context, args ...string) ([]string, error) {
+// Build runs bazel build and returns the files it built and the errors of the
+// targets that failed to build.
+func (b *Bazel) Build(ctx context.Context, args ...string) ([]string, targetErrors, error) {
 	jsonFile, err := ioutil.TempFile("", "gopackagesdriver_bep_")
 	if err != nil {
-		return nil, fmt.Errorf("unable to create BEP JSON file: %w", err)
+		return nil, nil, fmt.Errorf("unable to create BEP JSON file: %w", err)
 	}
 	defer func() {
 		jsonFile.Close()
@@ -123,30 +151,32 @@ func (b *Bazel) Build(ctx context.Context, args ...string) ([]string, error) {
 		// exit codes.
 		var exerr *exec.ExitError
 		if !errors.As(err, &exerr) || exerr.ExitCode() != 1 {
-			return nil, fmt.Errorf("bazel build failed: %w", err)
+			return nil, nil, fmt.Errorf("bazel build failed: %w", err)
 		}
 	}
 
 	files := make([]string, 0)
+	errs := targetErrors{}
 	decoder := json.NewDecoder(jsonFile)
 	for decoder.More() {
-		var namedSet BEPNamedSet
-		if err := decoder.Decode(&namedSet); err != nil {
-			return nil, fmt.Errorf("unable to decode %s: %w", jsonFile.Name(), err)
+		var event BEPEvent
+		if err := decoder.Decode(&event); err != nil {
+			return nil, nil, fmt.Errorf("unable to decode %s: %w", jsonFile.Name(), err)
 		}
 
-		if namedSet.NamedSetOfFiles != nil {
-			for _, f := range namedSet.NamedSetOfFiles.Files {
+		if event.NamedSetOfFiles != nil {
+			for _, f := range event.NamedSetOfFiles.Files {
 				fileUrl, err := url.Parse(f.URI)
 				if err != nil {
-					return nil, fmt.Errorf("unable to parse file URI: %w", err)
+					return nil, nil, fmt.Errorf("unable to parse file URI: %w", err)
 				}
 				files = append(files, filepath.FromSlash(fileUrl.Path))
 			}
 		}
+		errs.addEvent(b, &event)
 	}
 
-	return files, nil
+	return files, errs, nil
 }
 
 func (b *Bazel) Query(ctx context.Context, args ...string) ([]string, error) {
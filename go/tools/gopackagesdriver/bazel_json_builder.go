@@ -30,6 +30,7 @@ import (
 type BazelJSONBuilder struct {
 	bazel        *Bazel
 	includeTests bool
+	flags        *requestFlags
 }
 
 var RulesGoStdlibLabel = rulesGoRepositoryName + "//:stdlib"
@@ -49,6 +50,7 @@ func (b *BazelJSONBuilder) fileQuery(label string) string {
 		label = fmt.Sprintf("@%s//%s", matches[1], strings.Join(matches[2:], ":"))
 	}
 
+	kinds := append(_defaultKinds, additionalKinds...)
 	relToBin, err := filepath.Rel(b.bazel.info["output_path"], filename)
 	if err == nil && !strings.HasPrefix(relToBin, filepath.FromSlash("../")) {
 		parts := strings.SplitN(relToBin, string(filepath.Separator), 3)
@@ -69,11 +71,10 @@ func (b *BazelJSONBuilder) fileQuery(label string) string {
 				relToBin = ""
 			}
 			label = fmt.Sprintf("//%s:all", relToBin)
-			additionalKinds = append(additionalKinds, "go_.*")
+			kinds = append(kinds, "go_.*")
 		}
 	}
 
-	kinds := append(_defaultKinds, additionalKinds...)
 	return fmt.Sprintf(`kind("^(%s) rule$", same_pkg_direct_rdeps("%s"))`, strings.Join(kinds, "|"), label)
 }
 
@@ -149,10 +150,11 @@ func (b *BazelJSONBuilder) queryFromRequests(requests ...string) string {
 	return strings.Join(ret, " union ")
 }
 
-func NewBazelJSONBuilder(bazel *Bazel, includeTests bool) (*BazelJSONBuilder, error) {
+func NewBazelJSONBuilder(bazel *Bazel, includeTests bool, flags *requestFlags) (*BazelJSONBuilder, error) {
 	return &BazelJSONBuilder{
 		bazel:        bazel,
 		includeTests: includeTests,
+		flags:        flags,
 	}, nil
 }
 
@@ -169,7 +171,7 @@ func (b *BazelJSONBuilder) query(ctx context.Context, query string) ([]string, e
 	if b.bazel.version.isAtLeast(bazelVersion{6, 4, 0}) {
 		bzlmodQueryFlags = []string{"--consistent_labels"}
 	}
-	queryArgs := concatStringsArrays(bazelQueryFlags, bzlmodQueryFlags, []string{
+	queryArgs := concatStringsArrays(bazelQueryFlags, b.flags.queryFlags(), bzlmodQueryFlags, []string{
 		"--ui_event_filters=-info,-stderr",
 		"--noshow_progress",
 		"--order_output=no",
@@ -200,7 +202,9 @@ func (b *BazelJSONBuilder) Labels(ctx context.Context, requests []string) ([]str
 	return labels, nil
 }
 
-func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode LoadMode) ([]string, error) {
+// Build builds the package JSON files of labels. It also returns the errors of
+// the targets that failed to build, since Bazel still builds the others.
+func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode LoadMode) ([]string, targetErrors, error) {
 	aspects := append(additionalAspects, goDefaultAspect)
 
 	buildArgs := concatStringsArrays([]string{
@@ -210,7 +214,7 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 		"--aspects=" + strings.Join(aspects, ","),
 		"--output_groups=" + b.outputGroupsForMode(mode),
 		"--keep_going", // Build all possible packages
-	}, bazelBuildFlags)
+	}, bazelBuildFlags, b.flags.buildFlags())
 
 	if len(labels) < 100 {
 		buildArgs = append(buildArgs, labels...)
@@ -218,7 +222,7 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 		// To avoid hitting MAX_ARGS length, write labels to a file and use `--target_pattern_file`
 		targetsFile, err := ioutil.TempFile("", "gopackagesdriver_targets_")
 		if err != nil {
-			return nil, fmt.Errorf("unable to create target pattern file: %w", err)
+			return nil, nil, fmt.Errorf("unable to create target pattern file: %w", err)
 		}
 		writer := bufio.NewWriter(targetsFile)
 		defer writer.Flush()
@@ -226,7 +230,7 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 			writer.WriteString(l + "\n")
 		}
 		if err := writer.Flush(); err != nil {
-			return nil, fmt.Errorf("unable to flush data to target pattern file: %w", err)
+			return nil, nil, fmt.Errorf("unable to flush data to target pattern file: %w", err)
 		}
 		defer func() {
 			targetsFile.Close()
@@ -235,9 +239,9 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 
 		buildArgs = append(buildArgs, "--target_pattern_file="+targetsFile.Name())
 	}
-	files, err := b.bazel.Build(ctx, buildArgs...)
+	files, errs, err := b.bazel.Build(ctx, buildArgs...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to bazel build %v: %w", buildArgs, err)
+		return nil, nil, fmt.Errorf("unable to bazel build %v: %w", buildArgs, err)
 	}
 
 	ret := []string{}
@@ -247,7 +251,7 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 		}
 	}
 
-	return ret, nil
+	return ret, errs, nil
 }
 
 func (b *BazelJSONBuilder) PathResolver() PathResolverFunc {
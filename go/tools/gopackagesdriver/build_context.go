@@ -15,14 +15,14 @@ func makeBuildContext() *build.Context {
 	return &bctx
 }
 
-func filterSourceFilesForTags(files []string) []string {
+func filterSourceFilesForTags(bctx *build.Context, files []string) []string {
 	ret := make([]string, 0, len(files))
 
 	for _, f := range files {
 		dir, filename := filepath.Split(f)
 		ext := filepath.Ext(f)
 
-		match, _ := buildContext.MatchFile(dir, filename)
+		match, _ := bctx.MatchFile(dir, filename)
 		// MatchFile filters out anything without a file extension. In the
 		// case of CompiledGoFiles (in particular gco processed files from
 		// the cache), we want them.
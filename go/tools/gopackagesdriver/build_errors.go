@@ -0,0 +1,181 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// targetErrors maps the labels of targets to the errors Bazel reported while
+// building them.
+type targetErrors map[string][]FlatPackagesError
+
+// BEP structs to access the errors of a build.
+type BEPLabel struct {
+	Label string `json:"label"`
+}
+
+type BEPAction struct {
+	Label         string   `json:"label"`
+	Type          string   `json:"type"`
+	Success       bool     `json:"success"`
+	Stderr        *BEPFile `json:"stderr"`
+	FailureDetail *struct {
+		Message string `json:"message"`
+	} `json:"failureDetail"`
+}
+
+type BEPFile struct {
+	Name string `json:"name"`
+	URI  string `json:"uri"`
+}
+
+type BEPAborted struct {
+	Reason      string `json:"reason"`
+	Description string `json:"description"`
+}
+
+var (
+	// compilerErrorRe matches the errors the compiler reports for a position.
+	compilerErrorRe = regexp.MustCompile(`^(\S.*\.go):(\d+)(?::(\d+))?: (.*)$`)
+	// strictDepRe matches the imports of the missing strict dependencies
+	// reported by the builder.
+	strictDepRe = regexp.MustCompile(`^\t(\S.*\.go): import of "(.*)"$`)
+)
+
+// addEvent adds the errors of a failed action or of a target that failed
+// to load or analyze.
+func (errs targetErrors) addEvent(b *Bazel, event *BEPEvent) {
+	switch {
+	case event.Action != nil && !event.Action.Success:
+		label := event.Action.Label
+		if label == "" {
+			label = event.ID.label()
+		}
+		errs.add(label, b.actionErrors(event.Action)...)
+	case event.Aborted != nil:
+		if event.Aborted.Reason != "LOADING_FAILURE" && event.Aborted.Reason != "ANALYSIS_FAILURE" {
+			return
+		}
+		if label := event.ID.label(); label != "" {
+			errs.add(label, FlatPackagesError{
+				Msg:  event.Aborted.Description,
+				Kind: ListError,
+			})
+		}
+	}
+}
+
+func (errs targetErrors) add(label string, pkgErrs ...FlatPackagesError) {
+	if label == "" || len(pkgErrs) == 0 {
+		return
+	}
+	errs[label] = append(errs[label], pkgErrs...)
+}
+
+// actionErrors returns the errors in the output of a failed action, with
+// positions if the compiler or builder reported any.
+func (b *Bazel) actionErrors(action *BEPAction) []FlatPackagesError {
+	var stderr string
+	if action.Stderr != nil {
+		if u, err := url.Parse(action.Stderr.URI); err == nil && u.Scheme == "file" {
+			if data, err := os.ReadFile(filepath.FromSlash(u.Path)); err == nil {
+				stderr = string(data)
+			}
+		}
+	}
+
+	var errs []FlatPackagesError
+	for _, line := range strings.Split(stderr, "\n") {
+		if m := strictDepRe.FindStringSubmatch(line); m != nil {
+			errs = append(errs, FlatPackagesError{
+				Pos:  importPosition(b.sourcePath(m[1]), m[2]),
+				Msg:  fmt.Sprintf("missing strict dependency: import of %q", m[2]),
+				Kind: ListError,
+			})
+		} else if m := compilerErrorRe.FindStringSubmatch(line); m != nil {
+			pos := b.sourcePath(m[1]) + ":" + m[2]
+			if m[3] != "" {
+				pos += ":" + m[3]
+			}
+			errs = append(errs, FlatPackagesError{
+				Pos:  pos,
+				Msg:  m[4],
+				Kind: ListError,
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	msg := strings.TrimSpace(stderr)
+	if msg == "" && action.FailureDetail != nil {
+		msg = action.FailureDetail.Message
+	}
+	if msg == "" {
+		msg = fmt.Sprintf("%s action failed", action.Type)
+	}
+	return []FlatPackagesError{{Msg: msg, Kind: ListError}}
+}
+
+// sourcePath returns the absolute path of a file the compiler reported
+// relative to the execution root. Source files are resolved in the workspace,
+// so that they match the files of the package.
+func (b *Bazel) sourcePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if p := filepath.Join(b.WorkspaceRoot(), path); fileExists(p) {
+		return p
+	}
+	return filepath.Join(b.ExecutionRoot(), path)
+}
+
+// importPosition returns the position of the import of imp in file, or the
+// file if it can't be found.
+func importPosition(file, imp string) string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+	if err != nil {
+		return file
+	}
+	for _, spec := range f.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil && path == imp {
+			pos := fset.Position(spec.Path.Pos())
+			return fmt.Sprintf("%s:%d:%d", file, pos.Line, pos.Column)
+		}
+	}
+	return file
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// normalizeLabel strips the leading @ of label, which differ between Bazel
+// versions and in canonical and apparent labels of the main repository.
+func normalizeLabel(label string) string {
+	return strings.TrimLeft(label, "@")
+}
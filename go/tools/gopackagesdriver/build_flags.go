@@ -0,0 +1,155 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"strings"
+)
+
+// goBuildFlags are the flags of go build, which may also be given with two
+// dashes, and whether they take a value. They have no Bazel equivalent.
+var goBuildFlags = map[string]bool{
+	"C": true, "a": false, "asan": false, "asmflags": true, "buildmode": true,
+	"buildvcs": false, "compiler": true, "cover": false, "covermode": true,
+	"coverpkg": true, "gccgoflags": true, "gcflags": true, "installsuffix": true,
+	"json": false, "ldflags": true, "linkshared": false, "mod": true,
+	"modcacherw": false, "modfile": true, "msan": false, "n": false, "o": true,
+	"overlay": true, "p": true, "pgo": true, "pkgdir": true, "race": false,
+	"toolexec": true, "trimpath": false, "v": false, "work": false, "x": false,
+}
+
+// bazelQueryOptions are the Bazel flags that bazel query accepts and that
+// affect which targets it finds. Other Bazel flags, like --platforms or
+// --copt, are only passed to bazel build, since bazel query rejects them.
+// Further query flags can be set with GOPACKAGESDRIVER_BAZEL_QUERY_FLAGS.
+var bazelQueryOptions = map[string]bool{
+	"config":              true,
+	"enable_bzlmod":       true,
+	"enable_workspace":    true,
+	"lockfile_mode":       true,
+	"override_module":     true,
+	"override_repository": true,
+	"registry":            true,
+	"repo_env":            true,
+	"repository_cache":    true,
+}
+
+// requestFlags holds the Bazel flags and the build context derived from the
+// BuildFlags and Env of a DriverRequest.
+type requestFlags struct {
+	// bazelFlags are Bazel flags given in BuildFlags, which are passed to
+	// bazel build.
+	bazelFlags []string
+	// bazelFlagsForQuery are the bazelFlags that are also passed to bazel query.
+	bazelFlagsForQuery []string
+	// tags are the build tags set with -tags.
+	tags []string
+	// goos and goarch are set from GOOS and GOARCH in Env.
+	goos, goarch string
+}
+
+// parseRequestFlags maps the Go flags in buildFlags and the GOOS and GOARCH
+// variables in env to their Bazel equivalents. Other flags starting with "--"
+// are passed to Bazel as is, unless they are go build flags.
+func parseRequestFlags(buildFlags, env []string) (*requestFlags, error) {
+	f := &requestFlags{}
+	for i := 0; i < len(buildFlags); i++ {
+		flag := buildFlags[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+		switch {
+		case name == "tags":
+			if !hasValue {
+				if i+1 == len(buildFlags) {
+					return nil, fmt.Errorf("missing value for build flag %s", flag)
+				}
+				i++
+				value = buildFlags[i]
+			}
+			// Like the go command, accept both comma and space separated tags.
+			f.tags = append(f.tags, strings.FieldsFunc(value, func(r rune) bool {
+				return r == ',' || r == ' '
+			})...)
+		case goBuildFlags[name] && !hasValue && i+1 < len(buildFlags) && !strings.HasPrefix(buildFlags[i+1], "-"):
+			fmt.Fprintf(os.Stderr, "Ignoring build flag %s %s, which has no Bazel equivalent\n", flag, buildFlags[i+1])
+			i++
+		case strings.HasPrefix(flag, "--") && !isGoBuildFlag(name):
+			f.bazelFlags = append(f.bazelFlags, flag)
+			if bazelQueryOptions[name] || bazelQueryOptions[strings.TrimPrefix(name, "no")] {
+				f.bazelFlagsForQuery = append(f.bazelFlagsForQuery, flag)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Ignoring build flag %s, which has no Bazel equivalent\n", flag)
+		}
+	}
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		switch key {
+		case "GOOS":
+			f.goos = value
+		case "GOARCH":
+			f.goarch = value
+		}
+	}
+	return f, nil
+}
+
+// isGoBuildFlag reports whether name is the name of a go build flag.
+func isGoBuildFlag(name string) bool {
+	_, ok := goBuildFlags[name]
+	return ok
+}
+
+// queryFlags returns the flags for bazel query.
+func (f *requestFlags) queryFlags() []string {
+	return f.bazelFlagsForQuery
+}
+
+// buildFlags returns the flags for bazel build. Build tags and the target
+// platform only affect the configuration, which bazel query doesn't support.
+func (f *requestFlags) buildFlags() []string {
+	flags := append([]string(nil), f.bazelFlags...)
+	if len(f.tags) > 0 {
+		flags = append(flags, fmt.Sprintf("--%s//go/config:tags=%s", rulesGoRepositoryName, strings.Join(f.tags, ",")))
+	}
+	if f.goos != "" || f.goarch != "" {
+		bctx := f.buildContext()
+		flags = append(flags, fmt.Sprintf("--platforms=%s//go/toolchain:%s_%s", rulesGoRepositoryName, bctx.GOOS, bctx.GOARCH))
+	}
+	return flags
+}
+
+// buildContext returns the build context used to filter source files, which
+// includes the tags from GOTAGS.
+func (f *requestFlags) buildContext() *build.Context {
+	bctx := *buildContext
+	if len(f.tags) > 0 {
+		bctx.BuildTags = append(append([]string(nil), bctx.BuildTags...), f.tags...)
+	}
+	if f.goos != "" {
+		bctx.GOOS = f.goos
+	}
+	if f.goarch != "" {
+		bctx.GOARCH = f.goarch
+	}
+	return &bctx
+}
+
+// key identifies the flags in cache keys.
+func (f *requestFlags) key() string {
+	return strings.Join(f.buildFlags(), " ")
+}
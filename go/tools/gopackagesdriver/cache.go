@@ -0,0 +1,357 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileStamp records the state of a file, or of a missing file, to detect
+// changes without watching the file system.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stampFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// fileStamps maps paths to their state at the time an entry was cached.
+type fileStamps map[string]fileStamp
+
+func (s fileStamps) add(path string) {
+	if _, ok := s[path]; !ok {
+		s[path] = stampFile(path)
+	}
+}
+
+func (s fileStamps) addBuildFiles(dir string) {
+	s.add(filepath.Join(dir, "BUILD.bazel"))
+	s.add(filepath.Join(dir, "BUILD"))
+}
+
+// changed returns the first file that changed since it was stamped, if any.
+func (s fileStamps) changed() (string, bool) {
+	for path, stamp := range s {
+		if stampFile(path) != stamp {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// cachedQuery is the result of querying Bazel for the labels of a request.
+type cachedQuery struct {
+	labels []string
+	// deps are the files whose changes may change the labels.
+	deps fileStamps
+}
+
+// cachedLabel is the result of building a label.
+type cachedLabel struct {
+	jsonFiles []string
+	// deps are the files whose changes require building the label again.
+	deps fileStamps
+}
+
+// cachedJSONFile holds the packages read from a .pkg.json file, before their
+// paths and imports are resolved.
+type cachedJSONFile struct {
+	stamp fileStamp
+	pkgs  []*FlatPackage
+}
+
+// packageGraphCache caches the package graph of a workspace across driver
+// requests. Bazel is only queried again for a request if one of the files the
+// labels of the previous result depend on changed, only the labels whose
+// files changed are built again, and .pkg.json files are only read again if
+// they changed.
+//
+// The results of queries for a single file are indexed by the file, so that
+// requests for several files are answered without querying Bazel if each file
+// was requested before, no matter from which directory. The labels of a file
+// can't be derived from the packages that contain it, since a go_test that
+// embeds a library contains the files of the library, but is not a result of
+// a query for them.
+type packageGraphCache struct {
+	queries   map[string]*cachedQuery
+	files     map[string]*cachedQuery
+	labels    map[string]*cachedLabel
+	jsonFiles map[string]*cachedJSONFile
+}
+
+func newPackageGraphCache() *packageGraphCache {
+	return &packageGraphCache{
+		queries:   map[string]*cachedQuery{},
+		files:     map[string]*cachedQuery{},
+		labels:    map[string]*cachedLabel{},
+		jsonFiles: map[string]*cachedJSONFile{},
+	}
+}
+
+// configKey identifies the options of a request that change the labels or
+// packages of the result.
+func configKey(request *DriverRequest, flags *requestFlags) string {
+	return strings.Join([]string{
+		fmt.Sprint(request.Tests),
+		fmt.Sprint(request.Mode & NeedExportFile),
+		flags.key(),
+	}, "\x00")
+}
+
+// queryKey identifies the result of querying Bazel for the given patterns.
+func queryKey(workingDirectory, config string, patterns []string) string {
+	return strings.Join(append([]string{workingDirectory, config}, patterns...), "\x00")
+}
+
+// filePattern returns the absolute path of the file a pattern refers to, if
+// it is a file query.
+func filePattern(workingDirectory, pattern string) (string, bool) {
+	if !strings.HasSuffix(pattern, ".go") {
+		return "", false
+	}
+	file := filepath.FromSlash(strings.TrimPrefix(pattern, "file="))
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(workingDirectory, file)
+	}
+	return filepath.Clean(file), true
+}
+
+// validQuery returns the cached result for key in queries, or nil if there is
+// none or it is out of date.
+func validQuery(queries map[string]*cachedQuery, key string) *cachedQuery {
+	q, ok := queries[key]
+	if !ok {
+		return nil
+	}
+	if path, changed := q.deps.changed(); changed {
+		fmt.Fprintf(os.Stderr, "Invalidating cached labels: %s changed\n", path)
+		delete(queries, key)
+		return nil
+	}
+	return q
+}
+
+// query returns the cached labels for the patterns of a request, or false if
+// they have to be queried.
+func (c *packageGraphCache) query(workingDirectory, config string, patterns []string) ([]string, bool) {
+	if q := validQuery(c.queries, queryKey(workingDirectory, config, patterns)); q != nil {
+		return q.labels, true
+	}
+	if len(patterns) == 0 {
+		return nil, false
+	}
+	var labels []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		file, ok := filePattern(workingDirectory, pattern)
+		if !ok {
+			return nil, false
+		}
+		q := validQuery(c.files, config+"\x00"+file)
+		if q == nil {
+			return nil, false
+		}
+		for _, label := range q.labels {
+			if !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels, true
+}
+
+// addQuery caches the labels of a request.
+func (c *packageGraphCache) addQuery(workingDirectory, config string, patterns, labels []string) {
+	q := &cachedQuery{labels: labels, deps: queryDeps(workingDirectory, patterns, labels)}
+	if len(patterns) == 1 {
+		if file, ok := filePattern(workingDirectory, patterns[0]); ok {
+			c.files[config+"\x00"+file] = q
+			return
+		}
+	}
+	c.queries[queryKey(workingDirectory, config, patterns)] = q
+}
+
+// staleLabels returns the labels that were not built yet, whose files changed
+// since they were built, or whose .pkg.json files were removed. The labels
+// are removed from the cache.
+func (c *packageGraphCache) staleLabels(config string, labels []string) []string {
+	var stale []string
+	for _, label := range labels {
+		key := config + "\x00" + label
+		l, ok := c.labels[key]
+		if ok {
+			if path, changed := l.deps.changed(); changed {
+				fmt.Fprintf(os.Stderr, "Rebuilding %s: %s changed\n", label, path)
+				ok = false
+			}
+			for _, f := range l.jsonFiles {
+				if ok && !stampFile(f).exists {
+					fmt.Fprintf(os.Stderr, "Rebuilding %s: %s was removed\n", label, f)
+					ok = false
+				}
+			}
+			if !ok {
+				delete(c.labels, key)
+			}
+		}
+		if !ok {
+			stale = append(stale, label)
+		}
+	}
+	return stale
+}
+
+// labelJSONFiles returns the .pkg.json files of the labels that are cached.
+func (c *packageGraphCache) labelJSONFiles(config string, labels []string) []string {
+	var jsonFiles []string
+	for _, label := range labels {
+		if l, ok := c.labels[config+"\x00"+label]; ok {
+			jsonFiles = append(jsonFiles, l.jsonFiles...)
+		}
+	}
+	return jsonFiles
+}
+
+// addLabels caches the result of building labels.
+func (c *packageGraphCache) addLabels(config string, labels, jsonFiles []string, resp *driverResponse) {
+	for _, label := range labels {
+		c.labels[config+"\x00"+label] = &cachedLabel{jsonFiles: jsonFiles, deps: labelDeps(label, resp)}
+	}
+}
+
+// packages returns copies of the packages in the given .pkg.json files.
+func (c *packageGraphCache) packages(jsonFiles []string) ([]*FlatPackage, error) {
+	var pkgs []*FlatPackage
+	for _, f := range jsonFiles {
+		stamp := stampFile(f)
+		cached, ok := c.jsonFiles[f]
+		if !ok || cached.stamp != stamp {
+			cached = &cachedJSONFile{stamp: stamp}
+			if err := WalkFlatPackagesFromJSON(f, func(pkg *FlatPackage) {
+				cached.pkgs = append(cached.pkgs, pkg)
+			}); err != nil {
+				return nil, fmt.Errorf("unable to walk json: %w", err)
+			}
+			c.jsonFiles[f] = cached
+		}
+		for _, pkg := range cached.pkgs {
+			pkgs = append(pkgs, pkg.Clone())
+		}
+	}
+	return pkgs, nil
+}
+
+// queryDeps returns the files whose changes may change the labels of a
+// request for the given patterns: the files defining the workspace, the BUILD
+// files of the packages that could contain queried files, and the BUILD files
+// of the labels.
+func queryDeps(workingDirectory string, patterns, labels []string) fileStamps {
+	deps := fileStamps{}
+	for _, name := range []string{"MODULE.bazel", "WORKSPACE", "WORKSPACE.bazel", ".bazelrc"} {
+		deps.add(filepath.Join(workspaceRoot, name))
+	}
+
+	for _, pattern := range patterns {
+		file, ok := filePattern(workingDirectory, pattern)
+		if !ok {
+			continue
+		}
+		// A new BUILD file in any directory between the file and the
+		// workspace root would change the package the file belongs to.
+		for dir := filepath.Dir(file); ; dir = filepath.Dir(dir) {
+			rel, err := filepath.Rel(workspaceRoot, dir)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				break
+			}
+			deps.addBuildFiles(dir)
+			if rel == "." {
+				break
+			}
+		}
+	}
+	for _, label := range labels {
+		if dir, ok := localPackageDir(label); ok {
+			deps.addBuildFiles(dir)
+		}
+	}
+	return deps
+}
+
+// labelDeps returns the files whose changes require building label again: the
+// BUILD files of the local packages it depends on, and the sources and
+// directories of its root packages, so that added files are noticed as well.
+func labelDeps(label string, resp *driverResponse) fileStamps {
+	deps := fileStamps{}
+	pkgs := map[string]*FlatPackage{}
+	for _, pkg := range resp.Packages {
+		pkgs[pkg.ID] = pkg
+	}
+	seen := map[string]bool{}
+	var walk func(id string)
+	walk = func(id string) {
+		pkg := pkgs[id]
+		if pkg == nil || seen[id] {
+			return
+		}
+		seen[id] = true
+		if dir, ok := localPackageDir(id); ok {
+			deps.addBuildFiles(dir)
+		}
+		for _, dep := range pkg.Imports {
+			walk(dep)
+		}
+	}
+	for _, id := range resp.Roots {
+		pkg := pkgs[id]
+		if root := normalizeLabel(id); pkg == nil || root != normalizeLabel(label) && root != normalizeLabel(label)+"_xtest" {
+			continue
+		}
+		for _, files := range [][]string{pkg.GoFiles, pkg.OtherFiles} {
+			for _, f := range files {
+				deps.add(f)
+				deps.add(filepath.Dir(f))
+			}
+		}
+		walk(id)
+	}
+	return deps
+}
+
+// localPackageDir returns the directory of the package of a target in the
+// main repository, given its label or package ID.
+func localPackageDir(label string) (string, bool) {
+	label = strings.TrimLeft(label, "@")
+	if !strings.HasPrefix(label, "//") {
+		return "", false
+	}
+	pkg := strings.TrimPrefix(label, "//")
+	if i := strings.IndexByte(pkg, ':'); i >= 0 {
+		pkg = pkg[:i]
+	}
+	return filepath.Join(workspaceRoot, filepath.FromSlash(pkg)), true
+}
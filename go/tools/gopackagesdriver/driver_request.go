@@ -68,13 +68,12 @@ const (
 const NeedExportsFile = NeedExportFile
 
 // From https://github.com/golang/tools/blob/v0.1.0/go/packages/external.go#L32
-// Most fields are disabled since there is no need for them
 type DriverRequest struct {
 	Mode LoadMode `json:"mode"`
 	// Env specifies the environment the underlying build system should be run in.
-	// Env []string `json:"env"`
+	Env []string `json:"env"`
 	// BuildFlags are flags that should be passed to the underlying build system.
-	// BuildFlags []string `json:"build_flags"`
+	BuildFlags []string `json:"build_flags"`
 	// Tests specifies whether the patterns should also return test packages.
 	Tests bool `json:"tests"`
 	// Overlay maps file paths (relative to the driver's working directory) to the byte contents
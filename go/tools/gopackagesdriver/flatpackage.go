@@ -18,10 +18,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"go/build"
 	"go/parser"
 	"go/token"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -56,15 +58,45 @@ func (err FlatPackagesError) Error() string {
 // It drops all the type and syntax fields, and transforms the Imports
 type FlatPackage struct {
 	ID              string
-	Name            string              `json:",omitempty"`
-	PkgPath         string              `json:",omitempty"`
-	Errors          []FlatPackagesError `json:",omitempty"`
-	GoFiles         []string            `json:",omitempty"`
-	CompiledGoFiles []string            `json:",omitempty"`
-	OtherFiles      []string            `json:",omitempty"`
-	ExportFile      string              `json:",omitempty"`
-	Imports         map[string]string   `json:",omitempty"`
-	Standard        bool                `json:",omitempty"`
+	Name            string               `json:",omitempty"`
+	PkgPath         string               `json:",omitempty"`
+	Errors          []FlatPackagesError  `json:",omitempty"`
+	GoFiles         []string             `json:",omitempty"`
+	CompiledGoFiles []string             `json:",omitempty"`
+	OtherFiles      []string             `json:",omitempty"`
+	ExportFile      string               `json:",omitempty"`
+	Imports         map[string]string    `json:",omitempty"`
+	Standard        bool                 `json:",omitempty"`
+	Platform        *FlatPackagePlatform `json:",omitempty"`
+}
+
+// FlatPackagePlatform is the configuration a package is built in, which the
+// aspect records from the Go mode of the target. It isn't set for stdlib
+// packages.
+type FlatPackagePlatform struct {
+	GOOS       string
+	GOARCH     string
+	Tags       []string `json:",omitempty"`
+	CgoEnabled bool     `json:",omitempty"`
+}
+
+// buildContext returns bctx for the configuration of the package.
+func (p *FlatPackagePlatform) buildContext(bctx *build.Context) *build.Context {
+	if p == nil {
+		return bctx
+	}
+	pctx := *bctx
+	pctx.GOOS = p.GOOS
+	pctx.GOARCH = p.GOARCH
+	pctx.BuildTags = append(append([]string(nil), bctx.BuildTags...), p.Tags...)
+	pctx.CgoEnabled = p.CgoEnabled
+	return &pctx
+}
+
+// matches reports whether the package is built for the GOOS and GOARCH of
+// bctx.
+func (p *FlatPackagePlatform) matches(bctx *build.Context) bool {
+	return p != nil && p.GOOS == bctx.GOOS && p.GOARCH == bctx.GOARCH
 }
 
 type (
@@ -105,11 +137,94 @@ func (fp *FlatPackage) ResolvePaths(prf PathResolverFunc) error {
 	return nil
 }
 
-// FilterFilesForBuildTags filters the source files given the current build
-// tags.
-func (fp *FlatPackage) FilterFilesForBuildTags() {
-	fp.GoFiles = filterSourceFilesForTags(fp.GoFiles)
-	fp.CompiledGoFiles = filterSourceFilesForTags(fp.CompiledGoFiles)
+// FilterFilesForBuildTags filters the source files given the build tags and
+// target platform of bctx, or of the configuration the package is built in.
+// The files of stdlib packages are already filtered by go list.
+func (fp *FlatPackage) FilterFilesForBuildTags(bctx *build.Context) {
+	if fp.IsStdlib() {
+		return
+	}
+	bctx = fp.Platform.buildContext(bctx)
+	fp.GoFiles = filterSourceFilesForTags(bctx, fp.GoFiles)
+	var cgoDirs []string
+	fp.CompiledGoFiles, cgoDirs = splitCgoGoSrcsDirs(fp.CompiledGoFiles)
+	fp.CompiledGoFiles = append(filterSourceFilesForTags(bctx, fp.CompiledGoFiles), cgoDirs...)
+}
+
+// cgoGoSrcsDirSuffix is the suffix of the directory the builder writes the Go
+// files generated by cgo to. The aspect adds it to CompiledGoFiles of the
+// packages that use cgo.
+const cgoGoSrcsDirSuffix = ".cgo"
+
+// cgoImplicitImports are the packages imported by the files cgo generates.
+var cgoImplicitImports = []string{"runtime/cgo", "syscall", "unsafe"}
+
+func splitCgoGoSrcsDirs(files []string) (srcs, cgoDirs []string) {
+	for _, f := range files {
+		if strings.HasSuffix(f, cgoGoSrcsDirSuffix) {
+			cgoDirs = append(cgoDirs, f)
+		} else {
+			srcs = append(srcs, f)
+		}
+	}
+	return srcs, cgoDirs
+}
+
+// ExpandCgoFiles replaces the directory of Go files generated by cgo in
+// CompiledGoFiles with the files the compiler sees, like 'go list -compiled':
+// each file that imports "C" is replaced by its cgo-processed version, and the
+// generated definitions of the C names are added. With typecheckCgo, the type
+// checker processes the files that import "C" itself, so only the generated
+// definitions are added to them.
+func (fp *FlatPackage) ExpandCgoFiles(typecheckCgo bool) error {
+	srcs, cgoDirs := splitCgoGoSrcsDirs(fp.CompiledGoFiles)
+	if len(cgoDirs) == 0 {
+		return nil
+	}
+	fp.CompiledGoFiles = srcs
+
+	var cgoTypes string
+	var generated []string
+	processed := map[string]string{}
+	for _, dir := range cgoDirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			// The package failed to build.
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to read cgo generated files: %w", err)
+		}
+		for _, e := range entries {
+			name := e.Name()
+			path := filepath.Join(dir, name)
+			switch {
+			case name == "_cgo_gotypes.go":
+				cgoTypes = path
+			case strings.HasSuffix(name, ".cgo1.go"):
+				processed[strings.TrimSuffix(name, ".cgo1.go")+".go"] = path
+			case strings.HasSuffix(name, ".go"):
+				generated = append(generated, path)
+			}
+		}
+	}
+	if cgoTypes == "" {
+		return nil
+	}
+
+	if typecheckCgo {
+		fp.CompiledGoFiles = append([]string{cgoTypes}, srcs...)
+		return nil
+	}
+	compiled := make([]string, 0, len(srcs)+len(generated)+1)
+	for _, src := range srcs {
+		if p, ok := processed[filepath.Base(src)]; ok {
+			src = p
+		}
+		compiled = append(compiled, src)
+	}
+	compiled = append(compiled, cgoTypes)
+	fp.CompiledGoFiles = append(compiled, generated...)
+	return nil
 }
 
 func (fp *FlatPackage) filterTestSuffix(files []string) (err error, testFiles []string, xTestFiles, nonTestFiles []string) {
@@ -170,7 +285,30 @@ func (fp *FlatPackage) MoveTestFiles() *FlatPackage {
 		OtherFiles:      fp.OtherFiles,
 		ExportFile:      fp.ExportFile,
 		Standard:        fp.Standard,
+		Platform:        fp.Platform,
+	}
+}
+
+// Clone returns a copy of the package that does not share any slices or maps
+// with it, so that either can be resolved independently.
+func (fp *FlatPackage) Clone() *FlatPackage {
+	clone := *fp
+	clone.Errors = append([]FlatPackagesError(nil), fp.Errors...)
+	clone.GoFiles = append([]string(nil), fp.GoFiles...)
+	clone.CompiledGoFiles = append([]string(nil), fp.CompiledGoFiles...)
+	clone.OtherFiles = append([]string(nil), fp.OtherFiles...)
+	if fp.Platform != nil {
+		platform := *fp.Platform
+		platform.Tags = append([]string(nil), fp.Platform.Tags...)
+		clone.Platform = &platform
+	}
+	if fp.Imports != nil {
+		clone.Imports = make(map[string]string, len(fp.Imports))
+		for k, v := range fp.Imports {
+			clone.Imports[k] = v
+		}
 	}
+	return &clone
 }
 
 func (fp *FlatPackage) IsStdlib() bool {
@@ -209,23 +347,30 @@ func (fp *FlatPackage) ResolveImports(resolve ResolvePkgFunc, overlays map[strin
 			if err != nil {
 				continue
 			}
-			// We don't handle CGo for now
 			if imp == "C" {
+				// Files that import "C" are processed by cgo, which adds
+				// imports of its own.
+				for _, imp := range cgoImplicitImports {
+					fp.resolveImport(resolve, imp)
+				}
 				continue
 			}
-			if _, ok := fp.Imports[imp]; ok {
-				continue
-			}
-
-			if pkgID := resolve(imp); pkgID != "" {
-				fp.Imports[imp] = pkgID
-			}
+			fp.resolveImport(resolve, imp)
 		}
 	}
 
 	return nil
 }
 
+func (fp *FlatPackage) resolveImport(resolve ResolvePkgFunc, imp string) {
+	if _, ok := fp.Imports[imp]; ok {
+		return
+	}
+	if pkgID := resolve(imp); pkgID != "" {
+		fp.Imports[imp] = pkgID
+	}
+}
+
 func (fp *FlatPackage) IsRoot() bool {
 	return strings.HasPrefix(fp.ID, "//")
 }
@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
 )
@@ -76,6 +81,105 @@ import "os"
 func main() {
 	fmt.Fprintln(os.Stderr, "Subdirectory Hello World!")
 }
+
+-- cgopkg/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "cgopkg",
+    srcs = [
+        "answer.go",
+        "pure.go",
+    ],
+    cgo = True,
+    importpath = "example.com/hello/cgopkg",
+)
+
+-- cgopkg/answer.go --
+package cgopkg
+
+// static int answer() { return 42; }
+import "C"
+
+func Answer() int {
+	return int(C.answer())
+}
+
+-- cgopkg/pure.go --
+package cgopkg
+
+func Pure() int {
+	return Answer()
+}
+
+-- tagged/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "tagged",
+    srcs = [
+        "integration.go",
+        "tagged.go",
+    ],
+    importpath = "example.com/hello/tagged",
+)
+
+-- tagged/integration.go --
+//go:build integration
+
+package tagged
+
+-- tagged/tagged.go --
+package tagged
+
+-- platform/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+
+go_library(
+    name = "platform",
+    srcs = [
+        "platform_other.go",
+        "platform_windows.go",
+    ],
+    importpath = "example.com/hello/platform",
+)
+
+go_binary(
+    name = "windows_bin",
+    srcs = ["main.go"],
+    goarch = "amd64",
+    goos = "windows",
+    deps = [":platform"],
+)
+
+-- platform/platform_other.go --
+//go:build !windows
+
+package platform
+
+-- platform/platform_windows.go --
+package platform
+
+-- platform/main.go --
+package main
+
+import _ "example.com/hello/platform"
+
+func main() {}
+
+-- broken/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "broken",
+    srcs = ["broken.go"],
+    importpath = "example.com/hello/broken",
+)
+
+-- broken/broken.go --
+package broken
+
+import _ "example.com/hello/subhello"
 		`,
 	})
 }
@@ -324,8 +428,339 @@ func TestOverlay(t *testing.T) {
 	expectSetEquality(t, expectedImportsPerFile[subhelloPath], subhelloPkgImportPaths, "subhello imports")
 }
 
+func TestCgoCompiledGoFiles(t *testing.T) {
+	baseNames := func(files []string) []string {
+		var names []string
+		for _, f := range files {
+			names = append(names, path.Base(f))
+		}
+		return names
+	}
+
+	t.Run("compiled", func(t *testing.T) {
+		resp := runForTest(t, DriverRequest{Mode: NeedCompiledGoFiles | NeedImports}, "cgopkg", "file=./answer.go")
+		pkg := findPackageByID(resp.Packages, resp.Roots[0])
+		if pkg == nil {
+			t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+		}
+		assertSuffixesInList(t, pkg.GoFiles, "/answer.go", "/pure.go")
+		expectSetEquality(t, []string{"answer.cgo1.go", "pure.go", "_cgo_gotypes.go", "_cgo_imports.go"}, baseNames(pkg.CompiledGoFiles), "CompiledGoFiles")
+		for _, imp := range []string{"runtime/cgo", "syscall", "unsafe"} {
+			if _, ok := pkg.Imports[imp]; !ok {
+				t.Errorf("Expected implicit import %q:\n%+v", imp, pkg)
+			}
+		}
+	})
+
+	t.Run("typecheckCgo", func(t *testing.T) {
+		resp := runForTest(t, DriverRequest{Mode: NeedCompiledGoFiles | NeedImports | typecheckCgo}, "cgopkg", "file=./answer.go")
+		pkg := findPackageByID(resp.Packages, resp.Roots[0])
+		if pkg == nil {
+			t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+		}
+		expectSetEquality(t, []string{"_cgo_gotypes.go", "answer.go", "pure.go"}, baseNames(pkg.CompiledGoFiles), "CompiledGoFiles")
+		for _, imp := range []string{"runtime/cgo", "syscall", "unsafe"} {
+			if _, ok := pkg.Imports[imp]; !ok {
+				t.Errorf("Expected implicit import %q:\n%+v", imp, pkg)
+			}
+		}
+	})
+}
+
+func TestParseRequestFlags(t *testing.T) {
+	flags, err := parseRequestFlags(
+		[]string{
+			"-tags=integration,e2e", "--tags", "slow", "-mod=mod", "--mod=readonly", "-gcflags", "all=-N",
+			"--config=ci", "--copt=-O2", "--noenable_bzlmod", "--@rules_go//go/config:race",
+		},
+		[]string{"HOME=/home/user", "GOOS=windows", "GOARCH=arm64"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(flags.queryFlags(), " "), "--config=ci --noenable_bzlmod"; got != want {
+		t.Errorf("got query flags %q, want %q", got, want)
+	}
+	want := []string{
+		"--config=ci",
+		"--copt=-O2",
+		"--noenable_bzlmod",
+		"--@rules_go//go/config:race",
+		"--" + rulesGoRepositoryName + "//go/config:tags=integration,e2e,slow",
+		"--platforms=" + rulesGoRepositoryName + "//go/toolchain:windows_arm64",
+	}
+	if got := flags.buildFlags(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got build flags %q, want %q", got, want)
+	}
+	bctx := flags.buildContext()
+	if bctx.GOOS != "windows" || bctx.GOARCH != "arm64" {
+		t.Errorf("got build context for %s/%s, want windows/arm64", bctx.GOOS, bctx.GOARCH)
+	}
+
+	if _, err := parseRequestFlags([]string{"-tags"}, nil); err == nil {
+		t.Error("expected an error for -tags without a value")
+	}
+}
+
+func TestBuildFlagsTags(t *testing.T) {
+	resp := runForTest(t, DriverRequest{}, "tagged", "file=./tagged.go")
+	pkg := findPackageByID(resp.Packages, resp.Roots[0])
+	if pkg == nil {
+		t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+	}
+	if len(pkg.GoFiles) != 1 || path.Base(pkg.GoFiles[0]) != "tagged.go" {
+		t.Errorf("Expected to find 1 file (tagged.go) in GoFiles:\n%+v", pkg)
+	}
+
+	resp = runForTest(t, DriverRequest{BuildFlags: []string{"-tags=integration"}}, "tagged", "file=./tagged.go")
+	pkg = findPackageByID(resp.Packages, resp.Roots[0])
+	if pkg == nil {
+		t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+	}
+	assertSuffixesInList(t, pkg.GoFiles, "/integration.go", "/tagged.go")
+}
+
+func TestPlatform(t *testing.T) {
+	for _, tc := range []struct {
+		goos, goarch, file string
+	}{
+		{goos: "linux", goarch: "arm64", file: "platform_other.go"},
+		{goos: "windows", goarch: "amd64", file: "platform_windows.go"},
+	} {
+		t.Run(tc.goos+"_"+tc.goarch, func(t *testing.T) {
+			req := DriverRequest{Env: []string{"GOOS=" + tc.goos, "GOARCH=" + tc.goarch}}
+			resp := runForTest(t, req, "platform", "file=./platform_windows.go")
+			pkg := findPackageByID(resp.Packages, resp.Roots[0])
+			if pkg == nil {
+				t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+			}
+			if pkg.Platform == nil || pkg.Platform.GOOS != tc.goos || pkg.Platform.GOARCH != tc.goarch {
+				t.Errorf("Expected package to be built for %s/%s:\n%+v", tc.goos, tc.goarch, pkg)
+			}
+			if len(pkg.GoFiles) != 1 || path.Base(pkg.GoFiles[0]) != tc.file {
+				t.Errorf("Expected to find 1 file (%s) in GoFiles:\n%+v", tc.file, pkg)
+			}
+			if resp.Arch != tc.goarch {
+				t.Errorf("Expected Arch %q, got %q", tc.goarch, resp.Arch)
+			}
+		})
+	}
+
+	t.Run("transition", func(t *testing.T) {
+		// The library is only built for the platform of the binary.
+		resp := runForTest(t, DriverRequest{}, "platform", "file=./main.go")
+		var pkg *FlatPackage
+		for _, p := range resp.Packages {
+			if strings.HasSuffix(p.ID, "//platform:platform") {
+				pkg = p
+			}
+		}
+		if pkg == nil {
+			t.Fatalf("Expected to find //platform:platform in resp.Packages")
+		}
+		if pkg.Platform == nil || pkg.Platform.GOOS != "windows" {
+			t.Errorf("Expected package to be built for windows:\n%+v", pkg)
+		}
+		if len(pkg.GoFiles) != 1 || path.Base(pkg.GoFiles[0]) != "platform_windows.go" {
+			t.Errorf("Expected to find 1 file (platform_windows.go) in GoFiles:\n%+v", pkg)
+		}
+	})
+}
+
+func TestBuildErrors(t *testing.T) {
+	resp := runForTest(t, DriverRequest{}, "broken", "file=./broken.go")
+	pkg := findPackageByID(resp.Packages, resp.Roots[0])
+	if pkg == nil {
+		t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+	}
+	for _, err := range pkg.Errors {
+		if err.Msg == `missing strict dependency: import of "example.com/hello/subhello"` {
+			if !strings.HasSuffix(err.Pos, "/broken/broken.go:3:10") {
+				t.Errorf("Unexpected position of %q: %q", err.Msg, err.Pos)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected a missing strict dependency error:\n%+v", pkg)
+}
+
+func TestActionErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "foo.go"), []byte("package foo\n\nimport (\n\t\"fmt\"\n\t\"example.com/bar\"\n)\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	stderr := filepath.Join(dir, "stderr")
+	if err := os.WriteFile(stderr, []byte(`compilepkg: missing strict dependencies:
+	foo.go: import of "example.com/bar"
+No dependencies were provided.
+foo.go:7:2: undefined: bar
+`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	b := &Bazel{workspaceRoot: dir, info: map[string]string{"execution_root": filepath.Join(dir, "execroot")}}
+
+	got := b.actionErrors(&BEPAction{Stderr: &BEPFile{URI: "file://" + filepath.ToSlash(stderr)}})
+	want := []FlatPackagesError{
+		{Pos: filepath.Join(dir, "foo.go") + ":5:2", Msg: `missing strict dependency: import of "example.com/bar"`, Kind: ListError},
+		{Pos: filepath.Join(dir, "foo.go") + ":7:2", Msg: "undefined: bar", Kind: ListError},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got = b.actionErrors(&BEPAction{Type: "GoLink", FailureDetail: &struct {
+		Message string `json:"message"`
+	}{Message: "linking failed"}})
+	want = []FlatPackagesError{{Msg: "linking failed", Kind: ListError}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	s := newDriverServer()
+	runServer := func(ctx context.Context, in io.Reader, out io.Writer, args []string) error {
+		request, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		data, err := s.handle(ctx, &serverRequest{Args: args, WorkingDirectory: buildWorkingDirectory, Request: request})
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+	cachedFiles := func() []*cachedQuery {
+		var queries []*cachedQuery
+		for _, q := range s.cache.files {
+			queries = append(queries, q)
+		}
+		return queries
+	}
+	cachedLabels := func() []*cachedLabel {
+		var labels []*cachedLabel
+		for _, l := range s.cache.labels {
+			labels = append(labels, l)
+		}
+		return labels
+	}
+	checkRoots := func(resp driverResponse) {
+		t.Helper()
+		if len(resp.Roots) != 1 || !strings.HasSuffix(resp.Roots[0], "//:hello") {
+			t.Fatalf("Unexpected roots: %+v", resp.Roots)
+		}
+	}
+
+	checkRoots(runForTestWith(t, runServer, DriverRequest{}, ".", "file=hello.go"))
+	files, labels := cachedFiles(), cachedLabels()
+	if len(files) != 1 || len(labels) != 1 {
+		t.Fatalf("Expected 1 cached file and label, got %d and %d", len(files), len(labels))
+	}
+
+	// The file is looked up in the index, also from another directory.
+	checkRoots(runForTestWith(t, runServer, DriverRequest{}, "subhello", "file=../hello.go"))
+	if got := cachedFiles(); len(got) != 1 || got[0] != files[0] {
+		t.Errorf("Expected the second request to be answered from the index")
+	}
+	if got := cachedLabels(); len(got) != 1 || got[0] != labels[0] {
+		t.Errorf("Expected the second request not to build the label again")
+	}
+
+	// Changing a source file only builds the label again.
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes("hello.go", future, future); err != nil {
+		t.Fatal(err)
+	}
+	checkRoots(runForTestWith(t, runServer, DriverRequest{}, ".", "file=hello.go"))
+	if got := cachedFiles(); len(got) != 1 || got[0] != files[0] {
+		t.Errorf("Expected the request not to query Bazel again after hello.go changed")
+	}
+	if got := cachedLabels(); len(got) != 1 || got[0] == labels[0] {
+		t.Errorf("Expected the request to build the label again after hello.go changed")
+	}
+
+	// Changing the BUILD file invalidates the cached query.
+	if err := os.Chtimes("BUILD.bazel", future.Add(time.Minute), future.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	checkRoots(runForTestWith(t, runServer, DriverRequest{}, ".", "file=hello.go"))
+	if got := cachedFiles(); len(got) != 1 || got[0] == files[0] {
+		t.Errorf("Expected the request to query Bazel again after BUILD.bazel changed")
+	}
+}
+
+func TestServerClient(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gopackagesdriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Unix socket paths are limited to about 100 characters, so the socket
+	// can't be in the test's temporary directory.
+	socket := filepath.Join(dir, "s.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error)
+	go func() {
+		serveErr <- serve(ctx, socket)
+	}()
+	defer func() {
+		cancel()
+		if err := <-serveErr; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	}()
+	for {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runClientForTest := func(ctx context.Context, in io.Reader, out io.Writer, args []string) error {
+		return runClient(ctx, socket, in, out, args)
+	}
+	resp := runForTestWith(t, runClientForTest, DriverRequest{}, "subhello", "file=./subhello.go")
+	if len(resp.Roots) != 1 || !strings.HasSuffix(resp.Roots[0], "//subhello:subhello") {
+		t.Errorf("Unexpected roots: %+v", resp.Roots)
+	}
+}
+
+func TestServerDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not checked on Windows")
+	}
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	if err := os.Mkdir(filepath.Join(runtimeDir, "gopackagesdriver"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := serverDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(runtimeDir, "gopackagesdriver"); dir != want {
+		t.Errorf("got %s, want %s", dir, want)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("got permissions %o, want 700", perm)
+	}
+}
+
 func runForTest(t *testing.T, driverRequest DriverRequest, relativeWorkingDir string, args ...string) driverResponse {
 	t.Helper()
+	return runForTestWith(t, run, driverRequest, relativeWorkingDir, args...)
+}
+
+func runForTestWith(t *testing.T, runDriver func(context.Context, io.Reader, io.Writer, []string) error, driverRequest DriverRequest, relativeWorkingDir string, args ...string) driverResponse {
+	t.Helper()
 
 	// Remove most environment variables, other than those on an allowlist.
 	//
@@ -389,7 +824,7 @@ func runForTest(t *testing.T, driverRequest DriverRequest, relativeWorkingDir st
 	}
 	in := bytes.NewReader(driverRequestJson)
 	out := &bytes.Buffer{}
-	if err := run(context.Background(), in, out, args); err != nil {
+	if err := runDriver(context.Background(), in, out, args); err != nil {
 		t.Fatalf("running gopackagesdriver: %v", err)
 	}
 	var resp driverResponse
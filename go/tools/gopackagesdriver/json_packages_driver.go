@@ -16,27 +16,33 @@ package main
 
 import (
 	"fmt"
-	"runtime"
+	"go/build"
 )
 
 type JSONPackagesDriver struct {
 	registry *PackageRegistry
 }
 
-func NewJSONPackagesDriver(jsonFiles []string, prf PathResolverFunc, bazelVersion bazelVersion, overlays map[string][]byte) (*JSONPackagesDriver, error) {
-	jpd := &JSONPackagesDriver{
-		registry: NewPackageRegistry(bazelVersion),
-	}
-
+func NewJSONPackagesDriver(jsonFiles []string, prf PathResolverFunc, bazelVersion bazelVersion, bctx *build.Context, mode LoadMode, overlays map[string][]byte) (*JSONPackagesDriver, error) {
+	var pkgs []*FlatPackage
 	for _, f := range jsonFiles {
 		if err := WalkFlatPackagesFromJSON(f, func(pkg *FlatPackage) {
-			jpd.registry.Add(pkg)
+			pkgs = append(pkgs, pkg)
 		}); err != nil {
 			return nil, fmt.Errorf("unable to walk json: %w", err)
 		}
 	}
+	return newJSONPackagesDriverFromPackages(pkgs, prf, bazelVersion, bctx, mode, overlays)
+}
 
-	if err := jpd.registry.ResolvePaths(prf); err != nil {
+// newJSONPackagesDriverFromPackages creates a driver from packages that were
+// already read from JSON files. The packages are modified in place.
+func newJSONPackagesDriverFromPackages(pkgs []*FlatPackage, prf PathResolverFunc, bazelVersion bazelVersion, bctx *build.Context, mode LoadMode, overlays map[string][]byte) (*JSONPackagesDriver, error) {
+	jpd := &JSONPackagesDriver{
+		registry: NewPackageRegistry(bazelVersion, bctx, pkgs...),
+	}
+
+	if err := jpd.registry.ResolvePaths(prf, mode); err != nil {
 		return nil, fmt.Errorf("unable to resolve paths: %w", err)
 	}
 
@@ -47,13 +53,19 @@ func NewJSONPackagesDriver(jsonFiles []string, prf PathResolverFunc, bazelVersio
 	return jpd, nil
 }
 
+// AddErrors adds the errors of the targets that failed to build to their
+// packages.
+func (b *JSONPackagesDriver) AddErrors(labels []string, errs targetErrors) {
+	b.registry.AddErrors(labels, errs)
+}
+
 func (b *JSONPackagesDriver) GetResponse(labels []string) *driverResponse {
 	rootPkgs, packages := b.registry.Match(labels)
 
 	return &driverResponse{
 		NotHandled: false,
 		Compiler:   "gc",
-		Arch:       runtime.GOARCH,
+		Arch:       b.registry.Arch(rootPkgs),
 		Roots:      rootPkgs,
 		Packages:   packages,
 	}
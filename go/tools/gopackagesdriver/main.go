@@ -22,6 +22,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 )
 
 type driverResponse struct {
@@ -66,6 +67,9 @@ var (
 	buildWorkingDirectory = os.Getenv("BUILD_WORKING_DIRECTORY")
 	additionalAspects     = strings.Fields(os.Getenv("GOPACKAGESDRIVER_BAZEL_ADDTL_ASPECTS"))
 	additionalKinds       = strings.Fields(os.Getenv("GOPACKAGESDRIVER_BAZEL_KINDS"))
+	serverEnabled         = os.Getenv("GOPACKAGESDRIVER_SERVER") == "1"
+	serverSocket          = os.Getenv("GOPACKAGESDRIVER_SERVER_SOCKET")
+	serverIdleTimeout     = getenvDuration("GOPACKAGESDRIVER_SERVER_IDLE_TIMEOUT", time.Hour)
 	emptyResponse         = &driverResponse{
 		NotHandled: true,
 		Compiler:   "gc",
@@ -83,12 +87,17 @@ func run(ctx context.Context, in io.Reader, out io.Writer, args []string) error
 		return fmt.Errorf("unable to read request: %w", err)
 	}
 
+	flags, err := parseRequestFlags(request.BuildFlags, request.Env)
+	if err != nil {
+		return fmt.Errorf("unable to parse request flags: %w", err)
+	}
+
 	bazel, err := NewBazel(ctx, bazelBin, workspaceRoot, buildWorkingDirectory, bazelCommonFlags, bazelStartupFlags)
 	if err != nil {
 		return fmt.Errorf("unable to create bazel instance: %w", err)
 	}
 
-	bazelJsonBuilder, err := NewBazelJSONBuilder(bazel, request.Tests)
+	bazelJsonBuilder, err := NewBazelJSONBuilder(bazel, request.Tests, flags)
 	if err != nil {
 		return fmt.Errorf("unable to build JSON files: %w", err)
 	}
@@ -98,16 +107,18 @@ func run(ctx context.Context, in io.Reader, out io.Writer, args []string) error
 		return fmt.Errorf("unable to lookup package: %w", err)
 	}
 
-	jsonFiles, err := bazelJsonBuilder.Build(ctx, labels, request.Mode)
+	jsonFiles, buildErrs, err := bazelJsonBuilder.Build(ctx, labels, request.Mode)
 	if err != nil {
 		return fmt.Errorf("unable to build JSON files: %w", err)
 	}
 
-	driver, err := NewJSONPackagesDriver(jsonFiles, bazelJsonBuilder.PathResolver(), bazel.version, request.Overlay)
+	driver, err := NewJSONPackagesDriver(jsonFiles, bazelJsonBuilder.PathResolver(), bazel.version, flags.buildContext(), request.Mode, request.Overlay)
 	if err != nil {
 		return fmt.Errorf("unable to load JSON files: %w", err)
 	}
 
+	driver.AddErrors(labels, buildErrs)
+
 	// Note: we are returning all files required to build a specific package.
 	// For file queries (`file=`), this means that the CompiledGoFiles will
 	// include more than the only file being specified.
@@ -124,7 +135,31 @@ func main() {
 	ctx, cancel := signalContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	if err := run(ctx, os.Stdin, os.Stdout, os.Args[1:]); err != nil {
+	if len(os.Args) == 2 && os.Args[1] == serveArg {
+		socket, err := serverSocketPath()
+		if err == nil {
+			err = serve(ctx, socket)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var err error
+	var socket string
+	if serverEnabled {
+		if socket, err = serverSocketPath(); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to use server, handling request in process: %v\n", err)
+		}
+	}
+	if socket != "" {
+		err = runClient(ctx, socket, os.Stdin, os.Stdout, os.Args[1:])
+	} else {
+		err = run(ctx, os.Stdin, os.Stdout, os.Args[1:])
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v", err)
 		// gopls will check the packages driver exit code, and if there is an
 		// error, it will fall back to go list. Obviously we don't want that,
@@ -16,6 +16,7 @@ package main
 
 import (
 	"fmt"
+	"go/build"
 	"os"
 	"strings"
 )
@@ -24,13 +25,17 @@ type PackageRegistry struct {
 	packagesByID map[string]*FlatPackage
 	stdlib       map[string]string
 	bazelVersion bazelVersion
+	buildContext *build.Context
 }
 
-func NewPackageRegistry(bazelVersion bazelVersion, pkgs ...*FlatPackage) *PackageRegistry {
+// NewPackageRegistry creates a registry of pkgs. If a package is built in
+// several configurations, the one for the GOOS and GOARCH of bctx is used.
+func NewPackageRegistry(bazelVersion bazelVersion, bctx *build.Context, pkgs ...*FlatPackage) *PackageRegistry {
 	pr := &PackageRegistry{
 		packagesByID: map[string]*FlatPackage{},
 		stdlib:       map[string]string{},
 		bazelVersion: bazelVersion,
+		buildContext: bctx,
 	}
 	pr.Add(pkgs...)
 	return pr
@@ -38,6 +43,9 @@ func NewPackageRegistry(bazelVersion bazelVersion, pkgs ...*FlatPackage) *Packag
 
 func (pr *PackageRegistry) Add(pkgs ...*FlatPackage) *PackageRegistry {
 	for _, pkg := range pkgs {
+		if prev, ok := pr.packagesByID[pkg.ID]; ok && prev.Platform.matches(pr.buildContext) {
+			continue
+		}
 		pr.packagesByID[pkg.ID] = pkg
 
 		if pkg.IsStdlib() {
@@ -47,10 +55,13 @@ func (pr *PackageRegistry) Add(pkgs ...*FlatPackage) *PackageRegistry {
 	return pr
 }
 
-func (pr *PackageRegistry) ResolvePaths(prf PathResolverFunc) error {
+func (pr *PackageRegistry) ResolvePaths(prf PathResolverFunc, mode LoadMode) error {
 	for _, pkg := range pr.packagesByID {
 		pkg.ResolvePaths(prf)
-		pkg.FilterFilesForBuildTags()
+		pkg.FilterFilesForBuildTags(pr.buildContext)
+		if err := pkg.ExpandCgoFiles(mode&typecheckCgo != 0); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -96,16 +107,52 @@ func (pr *PackageRegistry) walk(acc map[string]*FlatPackage, root string) {
 	}
 }
 
+// labelID returns the package ID of the target with label.
+func (pr *PackageRegistry) labelID(label string) string {
+	// When packagesdriver is ran from rules go, rulesGoRepositoryName will just be @
+	if pr.bazelVersion.isAtLeast(bazelVersion{6, 0, 0}) &&
+		!strings.HasPrefix(label, "@") {
+		// Canonical labels is only since Bazel 6.0.0
+		label = fmt.Sprintf("@%s", label)
+	}
+	return label
+}
+
+// AddErrors adds the errors of the targets that failed to build to their
+// packages. The targets of labels that failed before their package was
+// written, for example during analysis, are added as packages with only
+// errors, so that they are reported for the roots.
+func (pr *PackageRegistry) AddErrors(labels []string, errs targetErrors) {
+	if len(errs) == 0 {
+		return
+	}
+	ids := make(map[string]string, len(labels)+len(pr.packagesByID))
+	for _, label := range labels {
+		ids[normalizeLabel(label)] = pr.labelID(label)
+	}
+	for id := range pr.packagesByID {
+		ids[normalizeLabel(id)] = id
+	}
+	for label, pkgErrs := range errs {
+		id, ok := ids[normalizeLabel(label)]
+		if !ok {
+			// The target is not part of the response.
+			continue
+		}
+		pkg := pr.packagesByID[id]
+		if pkg == nil {
+			pkg = &FlatPackage{ID: id, Imports: map[string]string{}}
+			pr.packagesByID[id] = pkg
+		}
+		pkg.Errors = append(pkg.Errors, pkgErrs...)
+	}
+}
+
 func (pr *PackageRegistry) Match(labels []string) ([]string, []*FlatPackage) {
 	roots := map[string]struct{}{}
 
 	for _, label := range labels {
-		// When packagesdriver is ran from rules go, rulesGoRepositoryName will just be @
-		if pr.bazelVersion.isAtLeast(bazelVersion{6, 0, 0}) &&
-			!strings.HasPrefix(label, "@") {
-			// Canonical labels is only since Bazel 6.0.0
-			label = fmt.Sprintf("@%s", label)
-		}
+		label = pr.labelID(label)
 
 		if label == RulesGoStdlibLabel {
 			// For stdlib, we need to append all the subpackages as roots
@@ -138,3 +185,14 @@ func (pr *PackageRegistry) Match(labels []string) ([]string, []*FlatPackage) {
 
 	return retRoots, retPkgs
 }
+
+// Arch returns the GOARCH the root packages are built for, which determines
+// the sizes of types.
+func (pr *PackageRegistry) Arch(roots []string) string {
+	for _, root := range roots {
+		if pkg := pr.packagesByID[root]; pkg != nil && pkg.Platform != nil {
+			return pkg.Platform.GOARCH
+		}
+	}
+	return pr.buildContext.GOARCH
+}
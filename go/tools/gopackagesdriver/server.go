@@ -0,0 +1,359 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// In server mode, enabled with GOPACKAGESDRIVER_SERVER=1, the driver forwards
+// requests to a long-lived server process for the workspace, which it starts
+// if necessary. The server keeps the package graph in memory and only runs
+// Bazel again for a request when the files the previous response depends on
+// change, so that repeated requests for the same files are answered quickly.
+
+// serveArg is the argument that makes the driver run as a server.
+const serveArg = "--serve"
+
+// serverStartTimeout is how long a client waits for a server it started to
+// accept connections.
+const serverStartTimeout = 10 * time.Second
+
+type serverRequest struct {
+	Args             []string
+	WorkingDirectory string
+	Request          json.RawMessage
+}
+
+type serverResponse struct {
+	Response json.RawMessage `json:",omitempty"`
+	Error    string          `json:",omitempty"`
+}
+
+// serverSocketPath returns the path of the Unix socket of the server. Unless
+// it is set with GOPACKAGESDRIVER_SERVER_SOCKET, it is unique to the driver
+// binary, the workspace and the configuration of the driver, so that clients
+// never talk to a server that would answer differently than they would, and
+// it is in a directory that only the current user can access.
+func serverSocketPath() (string, error) {
+	if serverSocket != "" {
+		return serverSocket, nil
+	}
+	dir, err := serverDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to create server directory: %w", err)
+	}
+	h := sha256.New()
+	if exe, err := os.Executable(); err == nil {
+		fmt.Fprintln(h, exe, stampFile(exe))
+	}
+	fmt.Fprintln(h, workspaceRoot)
+	env := os.Environ()
+	sort.Strings(env)
+	for _, e := range env {
+		if strings.HasPrefix(e, "GOPACKAGESDRIVER_") {
+			fmt.Fprintln(h, e)
+		}
+	}
+	return filepath.Join(dir, fmt.Sprintf("%x.sock", h.Sum(nil)[:8])), nil
+}
+
+// serverDir returns the directory of the sockets and logs of the servers of
+// the current user, which is in XDG_RUNTIME_DIR if it is set, or in the user
+// cache directory otherwise.
+func serverDir() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+	}
+	dir = filepath.Join(dir, "gopackagesdriver")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	if err := checkServerDir(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// runClient sends the request to the server listening on socket, starting it
+// if needed, and writes its response to out. If the server can't be reached,
+// the request is handled in process.
+func runClient(ctx context.Context, socket string, in io.Reader, out io.Writer, args []string) error {
+	request, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("unable to read request: %w", err)
+	}
+
+	conn, err := dialServer(ctx, socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to connect to server, handling request in process: %v\n", err)
+		return run(ctx, bytes.NewReader(request), out, args)
+	}
+	defer conn.Close()
+	go func() {
+		// Unblock the client if it is interrupted while waiting.
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if err := json.NewEncoder(conn).Encode(serverRequest{
+		Args:             args,
+		WorkingDirectory: buildWorkingDirectory,
+		Request:          request,
+	}); err != nil {
+		return fmt.Errorf("unable to send request to server: %w", err)
+	}
+	var resp serverResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("unable to read response from server: %w", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	_, err = out.Write(resp.Response)
+	return err
+}
+
+func dialServer(ctx context.Context, socket string) (net.Conn, error) {
+	var d net.Dialer
+	if conn, err := d.DialContext(ctx, "unix", socket); err == nil {
+		return conn, nil
+	}
+	if err := startServer(socket); err != nil {
+		return nil, fmt.Errorf("unable to start server: %w", err)
+	}
+	deadline := time.Now().Add(serverStartTimeout)
+	for {
+		conn, err := d.DialContext(ctx, "unix", socket)
+		if err == nil || ctx.Err() != nil || time.Now().After(deadline) {
+			return conn, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// startServer starts a server in the background. Its output, including the
+// output of Bazel, is written to a log file next to the socket.
+func startServer(socket string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logPath := strings.TrimSuffix(socket, filepath.Ext(socket)) + ".log"
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, serveArg)
+	cmd.Env = append(os.Environ(), "GOPACKAGESDRIVER_SERVER_SOCKET="+socket)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Started server with PID %d, logging to %s\n", cmd.Process.Pid, logPath)
+	return cmd.Process.Release()
+}
+
+// serve handles requests on socket until ctx is done or no request was
+// received for GOPACKAGESDRIVER_SERVER_IDLE_TIMEOUT. It returns immediately if
+// another server is already listening on socket.
+func serve(ctx context.Context, socket string) error {
+	ln, err := listenServer(socket)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", socket, err)
+	}
+	if ln == nil {
+		fmt.Fprintf(os.Stderr, "Another server is listening on %s\n", socket)
+		return nil
+	}
+	defer ln.Close()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", socket)
+
+	s := newDriverServer()
+	for {
+		if serverIdleTimeout > 0 {
+			ln.SetDeadline(time.Now().Add(serverIdleTimeout))
+		}
+		conn, err := ln.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if atomic.LoadInt32(&s.active) > 0 {
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "Exiting after being idle for %s\n", serverIdleTimeout)
+				return nil
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		atomic.AddInt32(&s.active, 1)
+		go func() {
+			defer atomic.AddInt32(&s.active, -1)
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// listenServer listens on socket, unless another server already does, in
+// which case it returns nil.
+func listenServer(socket string) (*net.UnixListener, error) {
+	addr := &net.UnixAddr{Name: socket, Net: "unix"}
+	ln, err := net.ListenUnix("unix", addr)
+	if err == nil {
+		return ln, nil
+	}
+	if conn, dialErr := net.Dial("unix", socket); dialErr == nil {
+		conn.Close()
+		return nil, nil
+	}
+	// The socket was left behind by a server that did not exit cleanly.
+	if removeErr := os.Remove(socket); removeErr != nil && !os.IsNotExist(removeErr) {
+		return nil, err
+	}
+	return net.ListenUnix("unix", addr)
+}
+
+// driverServer answers driver requests from a packageGraphCache. Requests are
+// handled one at a time, since they would wait for each other in Bazel anyway.
+type driverServer struct {
+	mu     sync.Mutex
+	active int32
+	bazel  *Bazel
+	cache  *packageGraphCache
+}
+
+func newDriverServer() *driverServer {
+	return &driverServer{cache: newPackageGraphCache()}
+}
+
+func (s *driverServer) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	var req serverRequest
+	var resp serverResponse
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("unable to read request: %v", err)
+	} else if data, err := s.handle(ctx, &req); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Response = data
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to send response: %v\n", err)
+	}
+}
+
+func (s *driverServer) handle(ctx context.Context, req *serverRequest) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := ReadDriverRequest(bytes.NewReader(req.Request))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read request: %w", err)
+	}
+	flags, err := parseRequestFlags(request.BuildFlags, request.Env)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse request flags: %w", err)
+	}
+
+	// The output of bazel info doesn't change, but the working directory of
+	// the client may.
+	if s.bazel == nil {
+		s.bazel, err = NewBazel(ctx, bazelBin, workspaceRoot, req.WorkingDirectory, bazelCommonFlags, bazelStartupFlags)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create bazel instance: %w", err)
+		}
+	}
+	bazel := *s.bazel
+	bazel.buildWorkingDirectory = req.WorkingDirectory
+
+	bazelJsonBuilder, err := NewBazelJSONBuilder(&bazel, request.Tests, flags)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build JSON files: %w", err)
+	}
+
+	config := configKey(request, flags)
+	labels, cached := s.cache.query(req.WorkingDirectory, config, req.Args)
+	if !cached {
+		labels, err = bazelJsonBuilder.Labels(ctx, req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("unable to lookup package: %w", err)
+		}
+	}
+	// Only the labels whose files changed are built again.
+	stale := s.cache.staleLabels(config, labels)
+	jsonFiles := s.cache.labelJSONFiles(config, labels)
+	var builtJSONFiles []string
+	var buildErrs targetErrors
+	if len(stale) > 0 {
+		builtJSONFiles, buildErrs, err = bazelJsonBuilder.Build(ctx, stale, request.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("unable to build JSON files: %w", err)
+		}
+		jsonFiles = append(jsonFiles, builtJSONFiles...)
+	}
+
+	pkgs, err := s.cache.packages(uniqueStrings(jsonFiles))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load JSON files: %w", err)
+	}
+	driver, err := newJSONPackagesDriverFromPackages(pkgs, bazelJsonBuilder.PathResolver(), bazel.version, flags.buildContext(), request.Mode, request.Overlay)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load JSON files: %w", err)
+	}
+	driver.AddErrors(labels, buildErrs)
+	resp := driver.GetResponse(labels)
+	// Failed builds are not cached, since the cache only watches the files of
+	// the labels, which may not be the ones to fix.
+	if len(buildErrs) == 0 {
+		if !cached {
+			s.cache.addQuery(req.WorkingDirectory, config, req.Args, labels)
+		}
+		s.cache.addLabels(config, stale, builtJSONFiles, resp)
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal response: %v", err)
+	}
+	return data, nil
+}
@@ -22,6 +22,7 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"time"
 )
 
 func getenvDefault(key, defaultValue string) string {
@@ -31,6 +32,19 @@ func getenvDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getenvDuration(key string, defaultValue time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid value for %s: %q\n", key, v)
+		return defaultValue
+	}
+	return d
+}
+
 func concatStringsArrays(values ...[]string) []string {
 	ret := []string{}
 	for _, v := range values {
@@ -39,6 +53,20 @@ func concatStringsArrays(values ...[]string) []string {
 	return ret
 }
 
+// uniqueStrings returns values without duplicates, in the order of their first
+// occurrence.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	ret := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
 func ensureAbsolutePathFromWorkspace(path string) string {
 	if filepath.IsAbs(path) {
 		return path
@@ -0,0 +1,202 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// nogo_baseline generates a nogo baseline file from the JSON reports that nogo
+// writes to the nogo_json output group.
+//
+// Usage:
+//
+//	bazel build --output_groups=nogo_json --norun_validations //...
+//	bazel run @io_bazel_rules_go//go/tools/nogo_baseline -- -o nogo_baseline.json bazel-bin
+//
+// Each argument is either a .nogo.json file or a directory that is searched
+// recursively for such files. Relative paths are resolved against the
+// workspace directory when run with "bazel run".
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// report is the subset of the nogo JSON report read by this tool.
+type report struct {
+	Package     string `json:"package"`
+	Diagnostics []struct {
+		Analyzer string `json:"analyzer"`
+		Message  string `json:"message"`
+		Start    struct {
+			Filename string `json:"filename"`
+		} `json:"start"`
+		Function    string `json:"function"`
+		Fingerprint string `json:"fingerprint"`
+	} `json:"diagnostics"`
+}
+
+// baseline is the format of the baseline file read by the nogo rule.
+type baseline struct {
+	Findings []finding `json:"findings"`
+}
+
+type finding struct {
+	Fingerprint string `json:"fingerprint"`
+	Analyzer    string `json:"analyzer"`
+	File        string `json:"file"`
+	Function    string `json:"function,omitempty"`
+	Message     string `json:"message"`
+	Count       int    `json:"count"`
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nogo_baseline: ")
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("nogo_baseline", flag.ContinueOnError)
+	out := flags.String("o", "", "The baseline file to write (defaults to stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"bazel-bin"}
+	}
+
+	var reports []report
+	for _, path := range paths {
+		files, err := findReports(workspacePath(path))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			var r report
+			if err := json.Unmarshal(data, &r); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			reports = append(reports, r)
+		}
+	}
+	if len(reports) == 0 {
+		return errors.New("no nogo JSON reports found, build with --output_groups=nogo_json first")
+	}
+
+	data, err := json.MarshalIndent(mergeReports(reports), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(workspacePath(*out), data, 0o666)
+}
+
+// workspacePath resolves path against the workspace directory when run with
+// "bazel run", which changes the working directory to the runfiles tree.
+func workspacePath(path string) string {
+	if ws := os.Getenv("BUILD_WORKSPACE_DIRECTORY"); ws != "" && !filepath.IsAbs(path) {
+		return filepath.Join(ws, path)
+	}
+	return path
+}
+
+// findReports returns path if it is a file and all nogo JSON reports below
+// path if it is a directory.
+func findReports(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(p, ".nogo.json") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// mergeReports returns a baseline with an entry for each fingerprint found in
+// the reports. The same package may be analyzed by several targets, e.g. a
+// go_library and a go_test embedding it, so the count of each fingerprint is
+// the maximum across reports rather than the sum.
+func mergeReports(reports []report) baseline {
+	findings := make(map[string]*finding)
+	for _, r := range reports {
+		counts := make(map[string]int)
+		for _, d := range r.Diagnostics {
+			if d.Fingerprint == "" {
+				continue
+			}
+			counts[d.Fingerprint]++
+			if _, ok := findings[d.Fingerprint]; !ok {
+				findings[d.Fingerprint] = &finding{
+					Fingerprint: d.Fingerprint,
+					Analyzer:    d.Analyzer,
+					File:        d.Start.Filename,
+					Function:    d.Function,
+					Message:     d.Message,
+				}
+			}
+		}
+		for fp, count := range counts {
+			if f := findings[fp]; count > f.Count {
+				f.Count = count
+			}
+		}
+	}
+
+	b := baseline{Findings: []finding{}}
+	for _, f := range findings {
+		b.Findings = append(b.Findings, *f)
+	}
+	sort.Slice(b.Findings, func(i, j int) bool {
+		fi, fj := b.Findings[i], b.Findings[j]
+		if fi.File != fj.File {
+			return fi.File < fj.File
+		}
+		if fi.Function != fj.Function {
+			return fi.Function < fj.Function
+		}
+		if fi.Analyzer != fj.Analyzer {
+			return fi.Analyzer < fj.Analyzer
+		}
+		return fi.Fingerprint < fj.Fingerprint
+	})
+	return b
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const libReport = `{
+  "package": "example.com/lib",
+  "diagnostics": [
+    {"analyzer": "printf", "message": "bad format", "start": {"filename": "lib/b.go"}, "function": "F", "fingerprint": "fp1"},
+    {"analyzer": "printf", "message": "bad format", "start": {"filename": "lib/b.go"}, "function": "F", "fingerprint": "fp1", "baselined": true},
+    {"analyzer": "bools", "message": "redundant or", "start": {"filename": "lib/a.go"}, "fingerprint": "fp2"}
+  ]
+}`
+
+// testReport is the report of a go_test that embeds the library above. Its
+// findings in the library sources must not be counted twice.
+const testReport = `{
+  "package": "example.com/lib",
+  "diagnostics": [
+    {"analyzer": "printf", "message": "bad format", "start": {"filename": "lib/b.go"}, "function": "F", "fingerprint": "fp1"},
+    {"analyzer": "copylocks", "message": "passes lock by value", "start": {"filename": "lib/a_test.go"}, "function": "TestA", "fingerprint": "fp3"}
+  ]
+}`
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"lib/lib.nogo.json":               libReport,
+		"lib/lib_test.internal.nogo.json": testReport,
+		"lib/lib.nogo.log":                "not a report",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(dir, "baseline.json")
+	if err := run([]string{"-o", out, dir}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got baseline
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := baseline{Findings: []finding{
+		{Fingerprint: "fp2", Analyzer: "bools", File: "lib/a.go", Message: "redundant or", Count: 1},
+		{Fingerprint: "fp3", Analyzer: "copylocks", File: "lib/a_test.go", Function: "TestA", Message: "passes lock by value", Count: 1},
+		{Fingerprint: "fp1", Analyzer: "printf", File: "lib/b.go", Function: "F", Message: "bad format", Count: 2},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got baseline\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestRunNoReports(t *testing.T) {
+	if err := run([]string{t.TempDir()}); err == nil {
+		t.Fatal("expected an error for a directory without reports")
+	}
+}
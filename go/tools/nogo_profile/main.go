@@ -0,0 +1,274 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// nogo_profile merges the per-package profiles that nogo writes to the
+// nogo_profile output group into a report of the most expensive analyzers.
+//
+// Usage:
+//
+//	bazel build --@io_bazel_rules_go//go/config:nogo_profile --output_groups=nogo_profile //...
+//	bazel run @io_bazel_rules_go//go/tools/nogo_profile -- -n 20 bazel-bin
+//
+// Each argument is either a .nogo.profile.json file or a directory that is
+// searched recursively for such files. Relative paths are resolved against
+// the workspace directory when run with "bazel run".
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// profile is the format of the profiles written by nogo.
+type profile struct {
+	Package   string  `json:"package"`
+	Phases    []entry `json:"phases"`
+	Analyzers []entry `json:"analyzers"`
+}
+
+type entry struct {
+	Name       string `json:"name"`
+	WallNanos  int64  `json:"wall_ns"`
+	AllocBytes uint64 `json:"alloc_bytes"`
+}
+
+// stat is the cost of an analyzer or phase summed over all packages.
+type stat struct {
+	name     string
+	wall     time.Duration
+	alloc    uint64
+	packages int
+	// maxWall is the highest wall time for a single package, maxPackage.
+	maxWall    time.Duration
+	maxPackage string
+}
+
+// run is the cost of a single analyzer on a single package.
+type run struct {
+	pkg, analyzer string
+	wall          time.Duration
+	alloc         uint64
+}
+
+type report struct {
+	packages  int
+	phases    []*stat
+	analyzers []*stat
+	runs      []run
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nogo_profile: ")
+	if err := runMain(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runMain(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("nogo_profile", flag.ContinueOnError)
+	top := flags.Int("n", 20, "The number of analyzers and analyzer runs to list")
+	sortBy := flags.String("sort", "wall", "The cost to sort by: wall or alloc")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *sortBy != "wall" && *sortBy != "alloc" {
+		return fmt.Errorf("-sort must be wall or alloc, got %q", *sortBy)
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"bazel-bin"}
+	}
+
+	var profiles []profile
+	for _, path := range paths {
+		files, err := findProfiles(workspacePath(path))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			var p profile
+			if err := json.Unmarshal(data, &p); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			profiles = append(profiles, p)
+		}
+	}
+	if len(profiles) == 0 {
+		return errors.New("no nogo profiles found, build with --@io_bazel_rules_go//go/config:nogo_profile --output_groups=nogo_profile first")
+	}
+
+	r := mergeProfiles(profiles, *sortBy == "alloc")
+	return r.write(stdout, *top)
+}
+
+// workspacePath resolves path against the workspace directory when run with
+// "bazel run", which changes the working directory to the runfiles tree.
+func workspacePath(path string) string {
+	if ws := os.Getenv("BUILD_WORKSPACE_DIRECTORY"); ws != "" && !filepath.IsAbs(path) {
+		return filepath.Join(ws, path)
+	}
+	return path
+}
+
+// findProfiles returns path if it is a file and all nogo profiles below path
+// if it is a directory.
+func findProfiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(p, ".nogo.profile.json") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// mergeProfiles sums the cost of each phase and analyzer over all profiles
+// and sorts phases, analyzers and individual runs by decreasing cost.
+func mergeProfiles(profiles []profile, byAlloc bool) *report {
+	phases := make(map[string]*stat)
+	analyzers := make(map[string]*stat)
+	r := &report{packages: len(profiles)}
+	for _, p := range profiles {
+		for _, e := range p.Phases {
+			addEntry(phases, p.Package, e)
+		}
+		for _, e := range p.Analyzers {
+			addEntry(analyzers, p.Package, e)
+			r.runs = append(r.runs, run{
+				pkg:      p.Package,
+				analyzer: e.Name,
+				wall:     time.Duration(e.WallNanos),
+				alloc:    e.AllocBytes,
+			})
+		}
+	}
+
+	less := func(wi, wj time.Duration, ai, aj uint64, ni, nj string) bool {
+		if byAlloc && ai != aj {
+			return ai > aj
+		}
+		if wi != wj {
+			return wi > wj
+		}
+		return ni < nj
+	}
+	r.phases = sortedStats(phases, less)
+	r.analyzers = sortedStats(analyzers, less)
+	sort.Slice(r.runs, func(i, j int) bool {
+		ri, rj := r.runs[i], r.runs[j]
+		return less(ri.wall, rj.wall, ri.alloc, rj.alloc, ri.pkg+" "+ri.analyzer, rj.pkg+" "+rj.analyzer)
+	})
+	return r
+}
+
+func addEntry(stats map[string]*stat, pkg string, e entry) {
+	s, ok := stats[e.Name]
+	if !ok {
+		s = &stat{name: e.Name}
+		stats[e.Name] = s
+	}
+	wall := time.Duration(e.WallNanos)
+	s.wall += wall
+	s.alloc += e.AllocBytes
+	s.packages++
+	if wall > s.maxWall || s.maxPackage == "" {
+		s.maxWall = wall
+		s.maxPackage = pkg
+	}
+}
+
+func sortedStats(stats map[string]*stat, less func(wi, wj time.Duration, ai, aj uint64, ni, nj string) bool) []*stat {
+	sorted := make([]*stat, 0, len(stats))
+	for _, s := range stats {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		si, sj := sorted[i], sorted[j]
+		return less(si.wall, sj.wall, si.alloc, sj.alloc, si.name, sj.name)
+	})
+	return sorted
+}
+
+func (r *report) write(w io.Writer, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "nogo profile of %d packages\n\n", r.packages)
+
+	fmt.Fprintln(tw, "PHASE\tWALL\tALLOC")
+	for _, s := range r.phases {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.name, formatDuration(s.wall), formatBytes(s.alloc))
+	}
+
+	fmt.Fprintf(tw, "\nTop %d analyzers\n", top)
+	fmt.Fprintln(tw, "ANALYZER\tWALL\tALLOC\tPACKAGES\tMAX WALL\tMAX PACKAGE")
+	for i, s := range r.analyzers {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", s.name, formatDuration(s.wall), formatBytes(s.alloc), s.packages, formatDuration(s.maxWall), s.maxPackage)
+	}
+
+	fmt.Fprintf(tw, "\nTop %d analyzer runs\n", top)
+	fmt.Fprintln(tw, "PACKAGE\tANALYZER\tWALL\tALLOC")
+	for i, run := range r.runs {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", run.pkg, run.analyzer, formatDuration(run.wall), formatBytes(run.alloc))
+	}
+	return tw.Flush()
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit && exp < 3; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGT"[exp])
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	fooProfile = `{
+  "package": "example.com/foo",
+  "phases": [{"name": "type_check", "wall_ns": 4000000, "alloc_bytes": 2048}],
+  "analyzers": [
+    {"name": "buildssa", "wall_ns": 3000000, "alloc_bytes": 4096},
+    {"name": "printf", "wall_ns": 1000000, "alloc_bytes": 100}
+  ]
+}`
+	barProfile = `{
+  "package": "example.com/bar",
+  "phases": [{"name": "type_check", "wall_ns": 1000000, "alloc_bytes": 1024}],
+  "analyzers": [
+    {"name": "buildssa", "wall_ns": 500000, "alloc_bytes": 1048576},
+    {"name": "printf", "wall_ns": 2000000, "alloc_bytes": 100}
+  ]
+}`
+)
+
+func writeProfiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"foo/foo.nogo.profile.json": fooProfile,
+		"bar/bar.nogo.profile.json": barProfile,
+		"bar/bar.nogo.json":         `{"package": "example.com/bar", "diagnostics": []}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMergeProfiles(t *testing.T) {
+	dir := writeProfiles(t)
+	var out bytes.Buffer
+	if err := runMain([]string{"-n", "1", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"nogo profile of 2 packages",
+		"type_check  5.0ms  3.0KiB",
+		"buildssa  3.5ms  1.0MiB  2         3.0ms     example.com/foo",
+		"example.com/foo  buildssa  3.0ms  4.0KiB",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report does not contain %q:\n%s", want, got)
+		}
+	}
+	// Only the top analyzer is listed.
+	if strings.Contains(got, "printf  3.0ms") {
+		t.Errorf("report lists more than one analyzer:\n%s", got)
+	}
+}
+
+func TestMergeProfilesByAlloc(t *testing.T) {
+	r := mergeProfiles([]profile{
+		{Package: "a", Analyzers: []entry{{Name: "fast", WallNanos: 1, AllocBytes: 100}, {Name: "slow", WallNanos: 100, AllocBytes: 1}}},
+	}, true)
+	if r.analyzers[0].name != "fast" || r.runs[0].analyzer != "fast" {
+		t.Errorf("expected the analyzer allocating the most first, got %s and %s", r.analyzers[0].name, r.runs[0].analyzer)
+	}
+}
+
+func TestNoProfiles(t *testing.T) {
+	if err := runMain([]string{t.TempDir()}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error for a directory without profiles")
+	}
+}
@@ -242,8 +242,13 @@ func TestLcovCoverageWithTool(t *testing.T) {
 
 var expectedGoCoverage = []string{
 	`SF:src/other_lib.go
-FNF:0
-FNH:0
+FN:3,HelloOtherLib
+FNDA:1,HelloOtherLib
+FNF:1
+FNH:1
+BRDA:4,0,0,0
+BRF:1
+BRH:0
 DA:3,1
 DA:4,1
 DA:5,0
@@ -254,8 +259,14 @@ LF:5
 end_of_record
 `,
 	`SF:src/lib.go
-FNF:0
-FNH:0
+FN:9,HelloFromLib
+FNDA:1,HelloFromLib
+FNF:1
+FNH:1
+BRDA:11,0,0,0
+BRDA:11,0,1,1
+BRF:2
+BRH:1
 DA:9,1
 DA:10,1
 DA:11,1
@@ -0,0 +1,170 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native_coverage_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- src/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_binary(
+    name = "app",
+    srcs = ["app.go"],
+    deps = [":lib"],
+)
+
+go_test(
+    name = "lib_test",
+    srcs = ["lib_test.go"],
+    data = [":app"],
+    deps = [":lib"],
+)
+-- src/lib.go --
+package lib
+
+func Sign(x int) int {
+	if x > 0 {
+		return 1
+	}
+	if x < 0 {
+		return -1
+	}
+	return 0
+}
+-- src/app.go --
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"example.com/lib"
+)
+
+func main() {
+	if lib.Sign(-5) != -1 {
+		fmt.Println("unexpected sign")
+		os.Exit(1)
+	}
+}
+-- src/lib_test.go --
+package lib_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"example.com/lib"
+)
+
+func TestSign(t *testing.T) {
+	if lib.Sign(5) != 1 {
+		t.Error("unexpected sign")
+	}
+}
+
+func TestApp(t *testing.T) {
+	out, err := exec.Command(filepath.Join("app_", "app")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+}
+`,
+	})
+}
+
+func TestNativeCoverage(t *testing.T) {
+	t.Run("without-race", func(t *testing.T) {
+		testNativeCoverage(t)
+	})
+
+	t.Run("with-race", func(t *testing.T) {
+		testNativeCoverage(t, "--@io_bazel_rules_go//go/config:race")
+	})
+}
+
+func testNativeCoverage(t *testing.T, extraArgs ...string) {
+	args := append([]string{
+		"coverage",
+		"--@io_bazel_rules_go//go/config:native_coverage",
+		"--instrumentation_filter=//src",
+		"--combined_report=lcov",
+		"//src:lib_test",
+	}, extraArgs...)
+	if err := bazel_testing.RunBazel(args...); err != nil {
+		t.Fatal(err)
+	}
+
+	coveragePath := filepath.FromSlash("bazel-testlogs/src/lib_test/coverage.dat")
+	coverageData, err := os.ReadFile(coveragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		// Covered by the test itself.
+		"SF:src/lib.go\n",
+		"DA:4,1\n",
+		// Covered by the binary run by the test.
+		"DA:7,1\n",
+		"SF:src/app.go\n",
+	} {
+		if !strings.Contains(string(coverageData), want) {
+			t.Errorf("%s: does not contain %q\nactual content:\n\n%s", coveragePath, want, coverageData)
+		}
+	}
+}
+
+func TestNativeCoverageGoCover(t *testing.T) {
+	if err := bazel_testing.RunBazel(
+		"coverage",
+		"--@io_bazel_rules_go//go/config:native_coverage",
+		"--@io_bazel_rules_go//go/config:cover_format=go_cover",
+		"--instrumentation_filter=//src",
+		"//src:lib_test",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	coveragePath := filepath.FromSlash("bazel-testlogs/src/lib_test/coverage.dat")
+	coverageData, err := os.ReadFile(coveragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"mode: set\n",
+		"example.com/lib/lib.go:4.",
+	} {
+		if !strings.Contains(string(coverageData), want) {
+			t.Errorf("%s: does not contain %q\nactual content:\n\n%s", coveragePath, want, coverageData)
+		}
+	}
+}
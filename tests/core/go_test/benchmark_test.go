@@ -0,0 +1,103 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchmark_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "bench_test",
+    srcs = ["bench_test.go"],
+)
+-- bench_test.go --
+package bench
+
+import "testing"
+
+func TestFail(t *testing.T) {
+	t.Fatal("tests should not run in benchmark mode")
+}
+
+func BenchmarkAlloc(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = make([]byte, 16)
+	}
+	b.ReportMetric(1, "widgets/op")
+}
+`,
+	})
+}
+
+func TestBenchmark(t *testing.T) {
+	if err := bazel_testing.RunBazel(
+		"test",
+		"//:bench_test",
+		"--test_env=GO_BENCH=.",
+		"--test_env=GO_BENCH_COUNT=2",
+		"--test_env=GO_BENCH_TIME=10x",
+		"--nozip_undeclared_test_outputs",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlogs root: %s", err)
+	}
+	testlogs := filepath.Join(strings.TrimSpace(string(p)), "bench_test")
+
+	b, err := os.ReadFile(filepath.Join(testlogs, "test.outputs", "benchmarks.txt"))
+	if err != nil {
+		t.Fatalf("could not read benchmark results: %s", err)
+	}
+	results := regexp.MustCompile(`(?m)^BenchmarkAlloc(-\d+)?\s+10\s+\S+ ns/op\s+1\.000 widgets/op\s+\d+ B/op\s+\d+ allocs/op$`).FindAllString(string(b), -1)
+	if len(results) != 2 {
+		t.Errorf("expected 2 results of BenchmarkAlloc in benchmarks.txt, got:\n%s", b)
+	}
+	if !strings.Contains(string(b), "goos: ") {
+		t.Errorf("expected the configuration of the benchmarks in benchmarks.txt, got:\n%s", b)
+	}
+
+	b, err = os.ReadFile(filepath.Join(testlogs, "test.xml"))
+	if err != nil {
+		t.Fatalf("could not read test.xml: %s", err)
+	}
+	report := string(b)
+	if strings.Contains(report, "TestFail") {
+		t.Errorf("test was run in benchmark mode:\n%s", report)
+	}
+	for _, property := range []string{
+		`<property name="iterations" value="10">`,
+		`<property name="widgets/op" value="1.000">`,
+		`<property name="allocs/op" value=`,
+	} {
+		if strings.Count(report, property) != 2 {
+			t.Errorf("expected %s twice in test.xml, got:\n%s", property, report)
+		}
+	}
+}
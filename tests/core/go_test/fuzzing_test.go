@@ -0,0 +1,95 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuzzing_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "fuzz_test",
+    srcs = ["fuzz_test.go"],
+    data = glob(["testdata/fuzz/**"]),
+)
+-- fuzz_test.go --
+package fuzz
+
+import "testing"
+
+func FuzzSeed(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) {
+		if s != "seed" {
+			t.Fatalf("unexpected input %q", s)
+		}
+	})
+}
+-- testdata/fuzz/FuzzSeed/seed --
+go test fuzz v1
+string("seed")
+`,
+	})
+}
+
+func TestFuzzing(t *testing.T) {
+	err := bazel_testing.RunBazel(
+		"test",
+		"//:fuzz_test",
+		"--test_env=GO_FUZZ_TARGET=FuzzSeed",
+		"--test_env=GO_FUZZ_TIME=30s",
+		"--nozip_undeclared_test_outputs",
+	)
+	if err == nil {
+		t.Fatal("expected bazel test to fail")
+	} else if exitErr, ok := err.(*bazel_testing.StderrExitError); !ok || exitErr.Err.ExitCode() != 3 {
+		t.Fatalf("expected bazel test to fail with exit code 3: %v", err)
+	}
+
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlogs root: %s", err)
+	}
+	testlogs := filepath.Join(strings.TrimSpace(string(p)), "fuzz_test")
+	b, err := os.ReadFile(filepath.Join(testlogs, "test.log"))
+	if err != nil {
+		t.Fatalf("could not read test log: %s", err)
+	}
+	if testLog := string(b); !strings.Contains(testLog, "Failing input written to testdata/fuzz/FuzzSeed/") {
+		t.Fatalf("test log does not report a failing input:\n%s", testLog)
+	}
+
+	crashers, err := filepath.Glob(filepath.Join(testlogs, "test.outputs", "testdata", "fuzz", "FuzzSeed", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crashers) == 0 {
+		t.Fatal("failing input was not written to the undeclared test outputs")
+	}
+	for _, crasher := range crashers {
+		if filepath.Base(crasher) == "seed" {
+			t.Errorf("seed corpus entry was copied to the undeclared test outputs")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "flaky_test",
+    srcs = ["flaky_test.go"],
+)
+
+go_test(
+    name = "broken_test",
+    srcs = ["broken_test.go"],
+)
+-- flaky_test.go --
+package flaky
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlaky(t *testing.T) {
+	marker := filepath.Join(os.Getenv("TEST_TMPDIR"), "attempted")
+	if _, err := os.Stat(marker); os.IsNotExist(err) {
+		if err := os.WriteFile(marker, nil, 0o666); err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("first attempt fails")
+	}
+}
+
+func TestOK(t *testing.T) {}
+-- broken_test.go --
+package broken
+
+import "testing"
+
+func TestBroken(t *testing.T) {
+	t.Fatal("always fails")
+}
+`,
+	})
+}
+
+func readTestXML(t *testing.T, target string) string {
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlogs root: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(strings.TrimSpace(string(p)), target, "test.xml"))
+	if err != nil {
+		t.Fatalf("could not read test.xml: %s", err)
+	}
+	return string(b)
+}
+
+func TestFlakyTestPasses(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:flaky_test", "--test_env=GO_TEST_RETRY_FAILED=1"); err != nil {
+		t.Fatal(err)
+	}
+	report := readTestXML(t, "flaky_test")
+	if !strings.Contains(report, `<flakyFailure message="Failed"`) || !strings.Contains(report, "first attempt fails") {
+		t.Errorf("expected a flaky failure of TestFlaky in test.xml, got:\n%s", report)
+	}
+	if strings.Contains(report, "<failure") {
+		t.Errorf("expected no failures in test.xml, got:\n%s", report)
+	}
+}
+
+func TestFlakyTestFailsWithoutRetry(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:flaky_test"); err == nil {
+		t.Fatal("expected the flaky test to fail without retries")
+	}
+}
+
+func TestBrokenTestFails(t *testing.T) {
+	err := bazel_testing.RunBazel("test", "//:broken_test", "--test_env=GO_TEST_RETRY_FAILED=2")
+	if err == nil {
+		t.Fatal("expected the broken test to fail")
+	}
+	report := readTestXML(t, "broken_test")
+	if got := strings.Count(report, "<rerunFailure"); got != 2 {
+		t.Errorf("expected 2 rerun failures of TestBroken in test.xml, got %d:\n%s", got, report)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard_strategy_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "hash_test",
+    srcs = ["shard_test.go"],
+    shard_count = 2,
+    shard_strategy = "hash",
+)
+
+go_test(
+    name = "duration_test",
+    srcs = ["shard_test.go"],
+    shard_count = 2,
+    shard_strategy = "duration",
+    shard_timings = ["timings.txt"],
+)
+-- timings.txt --
+# Durations of the tests in shard_test.go.
+TestSlow 10s
+TestFast1 1s
+TestFast2 1s
+ExampleFast 1s
+-- shard_test.go --
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSlow(t *testing.T) {}
+
+func TestFast1(t *testing.T) {}
+
+func TestFast2(t *testing.T) {}
+
+func ExampleFast() {
+	fmt.Println("fast")
+	// Output: fast
+}
+`,
+	})
+}
+
+var shardLogPattern = regexp.MustCompile(`Shard (\d) of 2 runs \d+ of 4 tests \((\w+) strategy\): (.*)`)
+
+// shardedTests returns the tests each shard of target logged that it ran.
+func shardedTests(t *testing.T, target string) [2][]string {
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlogs root: %s", err)
+	}
+	var tests [2][]string
+	for shard := 1; shard <= 2; shard++ {
+		path := filepath.Join(strings.TrimSpace(string(p)), target, fmt.Sprintf("shard_%d_of_2", shard), "test.log")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := shardLogPattern.FindStringSubmatch(string(b))
+		if m == nil || m[1] != fmt.Sprint(shard) {
+			t.Fatalf("%s does not log the tests of shard %d:\n%s", path, shard, b)
+		}
+		if m[3] != "" {
+			tests[shard-1] = strings.Split(m[3], ", ")
+		}
+	}
+	return tests
+}
+
+func TestHashStrategy(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:hash_test"); err != nil {
+		t.Fatal(err)
+	}
+	tests := shardedTests(t, "hash_test")
+	all := append(append([]string{}, tests[0]...), tests[1]...)
+	sort.Strings(all)
+	if got, want := strings.Join(all, ","), "ExampleFast,TestFast1,TestFast2,TestSlow"; got != want {
+		t.Errorf("shards ran %s, want each of %s exactly once", got, want)
+	}
+}
+
+func TestDurationStrategy(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:duration_test"); err != nil {
+		t.Fatal(err)
+	}
+	tests := shardedTests(t, "duration_test")
+	if got, want := strings.Join(tests[0], ","), "TestSlow"; got != want {
+		t.Errorf("shard 1 ran %s, want %s", got, want)
+	}
+	if got, want := strings.Join(tests[1], ","), "TestFast1,TestFast2,ExampleFast"; got != want {
+		t.Errorf("shard 2 ran %s, want %s", got, want)
+	}
+}
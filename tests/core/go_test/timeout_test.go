@@ -20,6 +20,11 @@ go_test(
 	name = "timeout_test",
 	srcs = ["timeout_test.go"],
 )
+
+go_test(
+	name = "testmain_timeout_test",
+	srcs = ["testmain_timeout_test.go"],
+)
 -- timeout_test.go --
 package timeout
 
@@ -32,6 +37,20 @@ func TestFoo(t *testing.T) {
 func neverTerminates() {
 	for {}
 }
+-- testmain_timeout_test.go --
+package timeout
+
+import "testing"
+
+func TestMain(m *testing.M) {
+	hangsInTestMain()
+}
+
+func hangsInTestMain() {
+	select {}
+}
+
+func TestFoo(t *testing.T) {}
 `,
 	})
 }
@@ -83,3 +102,36 @@ func TestTimeout(t *testing.T) {
 		t.Errorf("test XML does not contain expected element:\n%s", testXML)
 	}
 }
+
+func TestTimeoutInTestMain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("goroutine dumps on timeouts are not supported on Windows")
+	}
+
+	if err := bazel_testing.RunBazel("test", "//:testmain_timeout_test", "--test_timeout=3", "--nozip_undeclared_test_outputs"); err == nil {
+		t.Fatal("expected bazel test to fail")
+	} else if exitErr, ok := err.(*bazel_testing.StderrExitError); !ok || exitErr.Err.ExitCode() != 3 {
+		t.Fatalf("expected bazel test to fail with exit code 3: %v", err)
+	}
+
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlogs root: %s", err)
+	}
+	testlogs := filepath.Join(strings.TrimSpace(string(p)), "testmain_timeout_test")
+	b, err := os.ReadFile(filepath.Join(testlogs, "test.log"))
+	if err != nil {
+		t.Fatalf("could not read test log: %s", err)
+	}
+	if testLog := string(b); !strings.Contains(testLog, "SIGQUIT: quit") {
+		t.Errorf("test log does not contain a goroutine dump:\n%s", testLog)
+	}
+
+	b, err = os.ReadFile(filepath.Join(testlogs, "test.outputs", "test_timeout_goroutines.txt"))
+	if err != nil {
+		t.Fatalf("could not read goroutine dump: %s", err)
+	}
+	if dump := string(b); !strings.Contains(dump, "timeout_test.hangsInTestMain(") {
+		t.Errorf("goroutine dump does not contain expected stack trace:\n%s", dump)
+	}
+}
@@ -15,6 +15,7 @@
 package test_filter_test
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"io/ioutil"
 	"path/filepath"
@@ -128,6 +129,21 @@ func Test(t *testing.T) {
 				}},
 			},
 		},
+		{
+			name: "detailed",
+			args: []string{"test", "--test_env=GO_TEST_WRAP_TESTV=1", "--test_env=GO_TEST_XML_REPORT=detailed", "//:xml_test"},
+			expected: xmlTestSuites{
+				XMLName: xml.Name{Local: "testsuites"},
+				Suites: []xmlTestSuite{{
+					XMLName:  xml.Name{Local: "testsuite"},
+					Name:     "github.com/bazelbuild/rules_go/tests/core/go_test/xml_test",
+					Errors:   0,
+					Failures: 3,
+					Skipped:  1,
+					Tests:    7,
+				}},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -161,3 +177,51 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONOutput(t *testing.T) {
+	err := bazel_testing.RunBazel("test", "--test_env=GO_TEST_JSON=1", "--nozip_undeclared_test_outputs", "//:xml_test")
+	if xerr, ok := err.(*bazel_testing.StderrExitError); !ok || xerr.Err.ExitCode() != 3 {
+		t.Fatalf("expected bazel tests to fail with exit code 3 (TESTS_FAILED), got: %v", err)
+	}
+
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlog root: %s", err)
+	}
+	path := filepath.Join(strings.TrimSpace(string(p)), "xml_test/test.outputs/test.json")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read test2json output: %s", err)
+	}
+
+	// GO_TEST_JSON=1 implies -test.v, so passing tests have events too.
+	results := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e struct {
+			Time    *string
+			Action  string
+			Package string
+			Test    string
+		}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event %q: %s", line, err)
+		}
+		if e.Time == nil || e.Package != "github.com/bazelbuild/rules_go/tests/core/go_test/xml_test" {
+			t.Errorf("event without time or package: %s", line)
+		}
+		if e.Action == "pass" || e.Action == "fail" || e.Action == "skip" {
+			results[e.Test] = e.Action
+		}
+	}
+	for test, want := range map[string]string{
+		"TestPass":                     "pass",
+		"TestFail":                     "fail",
+		"TestSubtests/subtest_a":       "skip",
+		"TestSubtests/another_subtest": "fail",
+		"":                             "fail",
+	} {
+		if got := results[test]; got != want {
+			t.Errorf("got result %q for test %q, want %q", got, test, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baseline_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = ["@org_golang_x_tools//go/analysis/passes/composite"],
+    baseline = "nogo_baseline.json",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "findings",
+    srcs = ["findings.go"],
+    importpath = "example.com/findings",
+)
+
+-- nogo_baseline.json --
+{"findings": []}
+
+-- findings.go --
+package findings
+
+import "go/token"
+
+func F() token.Position {
+	return token.Position{"a.go", 0, 1, 1}
+}
+`,
+	})
+}
+
+func TestBaseline(t *testing.T) {
+	if err := buildFindings(); err == nil || !strings.Contains(err.Error(), "composites") {
+		t.Fatalf("expected the composites finding to fail the build, got: %v", err)
+	}
+
+	if err := bazel_testing.RunBazel("build", "--output_groups=nogo_json", "--norun_validations", "//:findings"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("run", "@io_bazel_rules_go//go/tools/nogo_baseline", "--", "-o", "nogo_baseline.json", "bazel-bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := buildFindings(); err != nil {
+		t.Fatalf("expected the baselined finding to be suppressed, got: %v", err)
+	}
+
+	// Moving the finding to another line must not invalidate the baseline.
+	src, err := os.ReadFile("findings.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src = bytes.Replace(src, []byte("func F()"), []byte("// F returns a position.\n\nfunc F()"), 1)
+	if err := os.WriteFile("findings.go", src, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := buildFindings(); err != nil {
+		t.Fatalf("expected the moved finding to be suppressed, got: %v", err)
+	}
+
+	// A new finding is reported, even in the same function.
+	src = bytes.Replace(src, []byte("\treturn token.Position"), []byte("\t_ = token.Position{\"b.go\", 0, 1, 1}\n\treturn token.Position"), 1)
+	if err := os.WriteFile("findings.go", src, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := buildFindings(); err == nil || !strings.Contains(err.Error(), "composites") {
+		t.Fatalf("expected the new finding to fail the build, got: %v", err)
+	}
+}
+
+func buildFindings() error {
+	return bazel_testing.RunBazel("build", "//:findings")
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fix_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = ["@org_golang_x_tools//go/analysis/passes/composite"],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "has_fix",
+    srcs = ["has_fix.go"],
+    importpath = "example.com/has_fix",
+)
+
+go_library(
+    name = "no_fix",
+    srcs = ["no_fix.go"],
+    importpath = "example.com/no_fix",
+)
+
+-- has_fix.go --
+package has_fix
+
+import "go/token"
+
+var P = token.Position{"a.go", 0, 1, 1}
+
+-- no_fix.go --
+package no_fix
+
+import "go/token"
+
+var P = token.Position{Filename: "a.go"}
+`,
+	})
+}
+
+func TestFix(t *testing.T) {
+	// The validation action fails on the finding, but the patch is still
+	// produced by the action that runs nogo.
+	if err := bazel_testing.RunBazel("build", "--output_groups=nogo_fix", "--norun_validations", "//:has_fix", "//:no_fix"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bazelBin := strings.TrimSpace(string(out))
+
+	patch, err := os.ReadFile(filepath.Join(bazelBin, "has_fix.nogo.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"--- a/has_fix.go",
+		"+++ b/has_fix.go",
+		`-var P = token.Position{"a.go", 0, 1, 1}`,
+		`+var P = token.Position{Filename: "a.go", Offset: 0, Line: 1, Column: 1}`,
+	} {
+		if !strings.Contains(string(patch), want) {
+			t.Errorf("patch does not contain %q:\n%s", want, patch)
+		}
+	}
+
+	empty, err := os.ReadFile(filepath.Join(bazelBin, "no_fix.nogo.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty) != 0 {
+		t.Errorf("expected an empty patch, got:\n%s", empty)
+	}
+}
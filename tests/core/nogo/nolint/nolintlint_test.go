@@ -0,0 +1,164 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nolintlint_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    vet = True,
+    config = "config.json",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "used",
+    srcs = ["used.go"],
+    importpath = "test",
+)
+
+go_library(
+    name = "unused",
+    srcs = ["unused.go"],
+    importpath = "test",
+)
+
+go_library(
+    name = "unknown",
+    srcs = ["unknown.go"],
+    importpath = "test",
+)
+
+go_library(
+    name = "unexplained",
+    srcs = ["unexplained.go"],
+    importpath = "test",
+)
+
+go_library(
+    name = "exempt",
+    srcs = ["exempt.go"],
+    importpath = "test",
+)
+
+-- config.json --
+{
+  "nolintlint": {
+    "analyzer_flags": {
+      "unused": "true",
+      "unknown": "true",
+      "require-explanation": "true"
+    }
+  }
+}
+
+-- used.go --
+package test
+
+func F() bool {
+	return true || true //nolint:bools // kept on purpose
+}
+
+-- unused.go --
+package test
+
+func F() bool {
+	return true //nolint:bools // nothing to suppress
+}
+
+-- unknown.go --
+package test
+
+func F() bool {
+	return true || true //nolint:bools,gocritic // kept on purpose
+}
+
+-- unexplained.go --
+package test
+
+func F() bool {
+	return true || true //nolint:bools
+}
+
+-- exempt.go --
+package test
+
+func F() bool {
+	return true //nolint:bools,gocritic,nolintlint
+}
+`,
+	})
+}
+
+func Test(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Target   string
+		Expected string
+	}{
+		{
+			Name:   "Used directive",
+			Target: "//:used",
+		},
+		{
+			Name:     "Unused directive",
+			Target:   "//:unused",
+			Expected: "unused.go:4:14: directive `//nolint:bools` is unused for analyzer \"bools\" (nolintlint)",
+		},
+		{
+			Name:     "Unknown analyzer",
+			Target:   "//:unknown",
+			Expected: "unknown.go:4:22: directive `//nolint:bools,gocritic` names unknown analyzer \"gocritic\" (nolintlint)",
+		},
+		{
+			Name:     "Missing explanation",
+			Target:   "//:unexplained",
+			Expected: "unexplained.go:4:22: directive `//nolint:bools` should provide an explanation",
+		},
+		{
+			Name:   "Directive naming nolintlint",
+			Target: "//:exempt",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			cmd := bazel_testing.BazelCmd("build", tc.Target)
+			b, err := cmd.CombinedOutput()
+			output := string(b)
+			if tc.Expected != "" && err == nil {
+				t.Fatal("unexpected success", output)
+			}
+			if tc.Expected == "" && err != nil {
+				t.Fatal("unexpected failure", output)
+			}
+			if !strings.Contains(output, tc.Expected) {
+				t.Errorf("output did not contain expected: %s\n%s", tc.Expected, output)
+			}
+		})
+	}
+}
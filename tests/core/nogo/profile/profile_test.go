@@ -0,0 +1,120 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = ["@org_golang_x_tools//go/analysis/passes/printf"],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+-- lib.go --
+package lib
+
+import "fmt"
+
+func F() string {
+	return fmt.Sprintf("%d", 1)
+}
+`,
+	})
+}
+
+type profile struct {
+	Package string `json:"package"`
+	Phases  []struct {
+		Name string `json:"name"`
+	} `json:"phases"`
+	Analyzers []struct {
+		Name      string `json:"name"`
+		WallNanos int64  `json:"wall_ns"`
+	} `json:"analyzers"`
+}
+
+func TestProfile(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profilePath := filepath.Join(strings.TrimSpace(string(out)), "lib.nogo.profile.json")
+
+	if err := bazel_testing.RunBazel("build", "--output_groups=nogo_profile", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(profilePath); !os.IsNotExist(err) {
+		t.Fatalf("expected no profile without --//go/config:nogo_profile, got: %v", err)
+	}
+
+	if err := bazel_testing.RunBazel("build", "--@io_bazel_rules_go//go/config:nogo_profile", "--output_groups=nogo_profile", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Package != "example.com/lib" {
+		t.Errorf("got package %q, want example.com/lib", p.Package)
+	}
+	var phases []string
+	for _, phase := range p.Phases {
+		phases = append(phases, phase.Name)
+	}
+	if got, want := strings.Join(phases, ","), "parse,type_check,facts_decode,facts_encode"; got != want {
+		t.Errorf("got phases %s, want %s", got, want)
+	}
+	// printf requires the inspect analyzer, which must run first.
+	var analyzers []string
+	for _, a := range p.Analyzers {
+		analyzers = append(analyzers, a.Name)
+	}
+	if got, want := strings.Join(analyzers, ","), "inspect,printf"; got != want {
+		t.Errorf("got analyzers %s, want %s", got, want)
+	}
+
+	out, err = bazel_testing.BazelOutput("run", "@io_bazel_rules_go//go/tools/nogo_profile", "--", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "nogo profile of 1 packages") {
+		t.Errorf("unexpected report:\n%s", out)
+	}
+}
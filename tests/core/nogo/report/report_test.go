@@ -0,0 +1,164 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = ["@org_golang_x_tools//go/analysis/passes/composite"],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "findings",
+    srcs = ["findings.go"],
+    importpath = "example.com/findings",
+)
+
+go_library(
+    name = "clean",
+    srcs = ["clean.go"],
+    importpath = "example.com/clean",
+)
+
+-- findings.go --
+package findings
+
+import "go/token"
+
+var P = token.Position{"a.go", 0, 1, 1}
+
+-- clean.go --
+package clean
+`,
+	})
+}
+
+type jsonReport struct {
+	Package     string `json:"package"`
+	Diagnostics []struct {
+		Analyzer string `json:"analyzer"`
+		Message  string `json:"message"`
+		Start    struct {
+			Filename string `json:"filename"`
+			Line     int    `json:"line"`
+			Column   int    `json:"column"`
+		} `json:"start"`
+		SuggestedFixes []struct {
+			Edits []struct {
+				NewText string `json:"new_text"`
+			} `json:"edits"`
+		} `json:"suggested_fixes"`
+	} `json:"diagnostics"`
+}
+
+type sarifReport struct {
+	Version string `json:"version"`
+	Runs    []struct {
+		Results []struct {
+			RuleID    string `json:"ruleId"`
+			Level     string `json:"level"`
+			Locations []struct {
+				PhysicalLocation struct {
+					ArtifactLocation struct {
+						URI string `json:"uri"`
+					} `json:"artifactLocation"`
+					Region struct {
+						StartLine int `json:"startLine"`
+					} `json:"region"`
+				} `json:"physicalLocation"`
+			} `json:"locations"`
+			Fixes []json.RawMessage `json:"fixes"`
+		} `json:"results"`
+	} `json:"runs"`
+}
+
+func TestReports(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--output_groups=nogo_json,nogo_sarif", "--norun_validations", "//:findings", "//:clean"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bazelBin := strings.TrimSpace(string(out))
+
+	var findings jsonReport
+	readJSON(t, filepath.Join(bazelBin, "findings.nogo.json"), &findings)
+	if findings.Package != "example.com/findings" {
+		t.Errorf("got package %q, want example.com/findings", findings.Package)
+	}
+	if len(findings.Diagnostics) != 1 {
+		t.Fatalf("got %d diagnostics, want 1: %+v", len(findings.Diagnostics), findings.Diagnostics)
+	}
+	d := findings.Diagnostics[0]
+	if d.Analyzer != "composites" || d.Start.Filename != "findings.go" || d.Start.Line != 5 || d.Start.Column != 9 {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+	if len(d.SuggestedFixes) != 1 || len(d.SuggestedFixes[0].Edits) != 4 {
+		t.Errorf("unexpected suggested fixes: %+v", d.SuggestedFixes)
+	}
+
+	var sarif sarifReport
+	readJSON(t, filepath.Join(bazelBin, "findings.nogo.sarif"), &sarif)
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 1 {
+		t.Fatalf("unexpected SARIF log: %+v", sarif)
+	}
+	r := sarif.Runs[0].Results[0]
+	if r.RuleID != "composites" || r.Level != "error" || len(r.Fixes) != 1 {
+		t.Errorf("unexpected SARIF result: %+v", r)
+	}
+	if loc := r.Locations[0].PhysicalLocation; loc.ArtifactLocation.URI != "findings.go" || loc.Region.StartLine != 5 {
+		t.Errorf("unexpected SARIF location: %+v", loc)
+	}
+
+	var clean jsonReport
+	readJSON(t, filepath.Join(bazelBin, "clean.nogo.json"), &clean)
+	if len(clean.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %+v", clean.Diagnostics)
+	}
+	var cleanSarif sarifReport
+	readJSON(t, filepath.Join(bazelBin, "clean.nogo.sarif"), &cleanSarif)
+	if len(cleanSarif.Runs) != 1 || len(cleanSarif.Runs[0].Results) != 0 {
+		t.Errorf("expected no SARIF results, got %+v", cleanSarif)
+	}
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
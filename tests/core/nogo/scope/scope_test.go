@@ -0,0 +1,153 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scope_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:my_nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo", "TOOLS_NOGO")
+
+nogo(
+    name = "my_nogo",
+    config = "config.json",
+    visibility = ["//visibility:public"],
+    deps = TOOLS_NOGO,
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/root/lib",
+)
+
+-- lib.go --
+package lib
+
+func shadowed() string {
+	foo := "original"
+	if foo == "original" {
+		foo := "shadow"
+		return foo
+	}
+	return foo
+}
+
+-- config.json --
+{
+  "shadow": {
+    "only_labels": {
+      "//services/...": "shadow is enforced for services"
+    },
+    "exclude_labels": {
+      "//services/api:generated": "generated code"
+    },
+    "exclude_tags": {
+      "legacy": "legacy code is not maintained"
+    }
+  }
+}
+
+-- services/api/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "api",
+    srcs = ["api.go"],
+    importpath = "example.com/services/api/api",
+)
+
+go_library(
+    name = "generated",
+    srcs = ["generated.go"],
+    importpath = "example.com/services/api/generated",
+)
+
+go_library(
+    name = "old",
+    srcs = ["old.go"],
+    importpath = "example.com/services/api/old",
+    tags = ["legacy"],
+)
+
+-- services/api/api.go --
+package api
+
+func shadowed() string {
+	foo := "original"
+	if foo == "original" {
+		foo := "shadow"
+		return foo
+	}
+	return foo
+}
+
+-- services/api/generated.go --
+package generated
+
+func shadowed() string {
+	foo := "original"
+	if foo == "original" {
+		foo := "shadow"
+		return foo
+	}
+	return foo
+}
+
+-- services/api/old.go --
+package old
+
+func shadowed() string {
+	foo := "original"
+	if foo == "original" {
+		foo := "shadow"
+		return foo
+	}
+	return foo
+}
+`,
+	})
+}
+
+func TestOnlyLabels(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("build", "//services/api"); err == nil {
+		t.Fatal("Expected build to fail")
+	} else if !strings.Contains(err.Error(), "api.go:6:3: declaration of \"foo\" shadows declaration at line 4 (shadow)") {
+		t.Fatalf("Expected a shadow diagnostic for api.go, got %s", err)
+	}
+}
+
+func TestExcludeLabels(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//services/api:generated"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExcludeTags(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//services/api:old"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package severity_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    config = "config.json",
+    deps = [
+        "@org_golang_x_tools//go/analysis/passes/bools",
+        "@org_golang_x_tools//go/analysis/passes/composite",
+        "@org_golang_x_tools//go/analysis/passes/unusedresult",
+    ],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "advisory",
+    srcs = ["advisory.go"],
+    importpath = "example.com/advisory",
+)
+
+go_library(
+    name = "blocking",
+    srcs = ["blocking.go"],
+    importpath = "example.com/blocking",
+)
+
+-- config.json --
+{
+  "composites": {
+    "severity": "warning"
+  },
+  "bools": {
+    "severity": "info"
+  }
+}
+
+-- advisory.go --
+package advisory
+
+import "go/token"
+
+var P = token.Position{"a.go", 0, 1, 1}
+
+func F(b bool) bool {
+	return b || b
+}
+
+-- blocking.go --
+package blocking
+
+import "fmt"
+
+func F() {
+	fmt.Sprintf("unused")
+}
+`,
+	})
+}
+
+func TestWarningsDontFailBuild(t *testing.T) {
+	_, stderr, err := bazel_testing.BazelOutputWithInput(nil, "build", "--output_groups=+nogo_json", "//:advisory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(stderr), "advisory.go:5:9: go/token.Position struct literal uses unkeyed fields (composites)") {
+		t.Errorf("expected the composites warning to be printed, got:\n%s", stderr)
+	}
+	if strings.Contains(string(stderr), "(bools)") {
+		t.Errorf("expected the bools diagnostic not to be printed, got:\n%s", stderr)
+	}
+
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(strings.TrimSpace(string(out)), "advisory.nogo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Diagnostics []struct {
+			Analyzer string `json:"analyzer"`
+			Severity string `json:"severity"`
+		} `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, d := range report.Diagnostics {
+		got[d.Analyzer] = d.Severity
+	}
+	if got["composites"] != "warning" || got["bools"] != "info" || len(got) != 2 {
+		t.Errorf("got severities %v, want composites: warning and bools: info", got)
+	}
+}
+
+func TestErrorsFailBuild(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:blocking"); err == nil {
+		t.Fatal("Expected build to fail")
+	} else if !strings.Contains(err.Error(), "blocking.go:6:2: result of fmt.Sprintf call not used (unusedresult)") {
+		t.Fatalf("Expected an unusedresult error, got %s", err)
+	}
+}
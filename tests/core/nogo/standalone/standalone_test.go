@@ -0,0 +1,132 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package standalone_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    config = "config.json",
+    deps = [
+        "@org_golang_x_tools//go/analysis/passes/composite",
+        "@org_golang_x_tools//go/analysis/passes/printf",
+    ],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "log",
+    srcs = ["log/log.go"],
+    importpath = "example.com/standalone/log",
+)
+
+go_library(
+    name = "app",
+    srcs = ["app/app.go"],
+    importpath = "example.com/standalone/app",
+    deps = [":log"],
+)
+
+-- config.json --
+{
+  "composites": {
+    "exclude_files": {
+      "app/": "generated"
+    }
+  }
+}
+
+-- go.mod --
+module example.com/standalone
+
+go 1.18
+
+-- log/log.go --
+package log
+
+import "fmt"
+
+func Logf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+-- app/app.go --
+package app
+
+import (
+	"go/token"
+
+	"example.com/standalone/log"
+)
+
+var P = token.Position{"a.go", 0, 1, 1}
+
+func F() {
+	log.Logf("%d", "one")
+	log.Logf("%d", "two") //nolint:printf
+}
+`,
+	})
+}
+
+func TestStandalone(t *testing.T) {
+	want := `app/app.go:12:17: example.com/standalone/log.Logf format %d has arg "one" of wrong type string (printf)`
+
+	if err := bazel_testing.RunBazel("build", "//:app"); err == nil {
+		t.Fatal("Expected build to fail")
+	} else if !strings.Contains(err.Error(), want) {
+		t.Fatalf("Expected the build to report %q, got %s", want, err)
+	}
+
+	// Load packages with the go command of the SDK used by the build.
+	out, err := bazel_testing.BazelOutput("info", "output_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goBin := filepath.Join(strings.TrimSpace(string(out)), "external", "go_sdk", "bin")
+	t.Setenv("PATH", goBin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GOCACHE", t.TempDir())
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	_, stderr, err := bazel_testing.BazelOutputWithInput(nil, "run", "//:nogo_standalone", "--", "./...")
+	if err == nil {
+		t.Fatal("Expected the standalone driver to fail")
+	}
+	if !strings.Contains(string(stderr), want) {
+		t.Errorf("Expected the standalone driver to report %q, got:\n%s", want, stderr)
+	}
+	if strings.Contains(string(stderr), `"two"`) {
+		t.Errorf("Expected the diagnostic suppressed by //nolint not to be reported, got:\n%s", stderr)
+	}
+	if strings.Contains(string(stderr), "(composites)") {
+		t.Errorf("Expected the composites diagnostic to be excluded by the configuration, got:\n%s", stderr)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stdlib_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = ["@org_golang_x_tools//go/analysis/passes/printf"],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "wrapper",
+    srcs = ["wrapper.go"],
+    importpath = "example.com/wrapper",
+)
+
+-- wrapper.go --
+package wrapper
+
+import "net/textproto"
+
+func Greet(w *textproto.Writer) error {
+	return w.PrintfLine("HELO %d", "example.com")
+}
+`,
+	})
+}
+
+func TestStdlibFacts(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--@io_bazel_rules_go//go/config:nogo_stdlib", "//:wrapper"); err == nil {
+		t.Fatal("Expected build to fail")
+	} else if want := "wrapper.go:6:28: (*net/textproto.Writer).PrintfLine format %d has arg \"example.com\" of wrong type string (printf)"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("Expected error to contain %q, got %s", want, err)
+	}
+}
+
+func TestStdlibFactsDisabled(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:wrapper"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -79,6 +79,14 @@ func TestFS_native(t *testing.T) {
 }
 
 func TestFS_directory(t *testing.T) {
+	testFSDirectory(t, false)
+}
+
+func TestFS_directoryCompactRepoMapping(t *testing.T) {
+	testFSDirectory(t, true)
+}
+
+func testFSDirectory(t *testing.T, compactRepoMapping bool) {
 	// Turn our own runfiles (whatever the form) into a valid runfiles directory.
 	tempdir := t.TempDir()
 	directory := filepath.Join(tempdir, "directory")
@@ -95,6 +103,17 @@ func TestFS_directory(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		if source == "_repo_mapping" && compactRepoMapping {
+			content, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(filepath.Join(directory, source), []byte(compactRepoMappingManifest(string(content))), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
 		err = os.Symlink(target, filepath.Join(directory, source))
 		if err != nil {
 			t.Fatal(err)
@@ -0,0 +1,215 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runfiles_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/runfiles"
+)
+
+// compactRepoMappingManifest rewrites a repository mapping manifest into the
+// compact format, in which the entries of the repos generated by a module
+// extension are replaced by a single set of entries whose source repo is the
+// common prefix of their canonical names followed by "*".
+func compactRepoMappingManifest(content string) string {
+	bySource := make(map[string][]string)
+	var sources []string
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		source, rest, _ := strings.Cut(line, ",")
+		if _, ok := bySource[source]; !ok {
+			sources = append(sources, source)
+		}
+		bySource[source] = append(bySource[source], rest)
+	}
+	// The canonical name of a module extension repo has the form
+	// "<module>+<extension>+<name>".
+	extensionPrefix := func(source string) string {
+		i := strings.LastIndexAny(source, "+~")
+		if i < 0 || strings.IndexAny(source[:i], "+~") < 0 {
+			return ""
+		}
+		return source[:i+1]
+	}
+	byPrefix := make(map[string][]string)
+	for _, source := range sources {
+		if prefix := extensionPrefix(source); prefix != "" {
+			byPrefix[prefix] = append(byPrefix[prefix], source)
+		}
+	}
+	sameEntries := func(sources []string) bool {
+		want := append([]string(nil), bySource[sources[0]]...)
+		sort.Strings(want)
+		for _, source := range sources[1:] {
+			got := append([]string(nil), bySource[source]...)
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				return false
+			}
+		}
+		return true
+	}
+
+	var b strings.Builder
+	written := make(map[string]bool)
+	for _, source := range sources {
+		entries := bySource[source]
+		if prefix := extensionPrefix(source); prefix != "" && sameEntries(byPrefix[prefix]) {
+			if written[prefix] {
+				continue
+			}
+			written[prefix] = true
+			source = prefix + "*"
+		}
+		for _, rest := range entries {
+			b.WriteString(source + "," + rest + "\n")
+		}
+	}
+	return b.String()
+}
+
+const testRepoMapping = `,my_module,_main
+,my_protobuf,protobuf+
+,my_deps,+deps+
+_main,my_module,_main
+_main,my_protobuf,protobuf+
+protobuf+,protobuf,protobuf+
++deps+lib_a,deps,+deps+
++deps+lib_a,protobuf,protobuf+
++deps+lib_b,deps,+deps+
++deps+lib_b,protobuf,protobuf+
+`
+
+// newTestRunfiles creates a runfiles directory with the given repository
+// mapping manifest and a file.txt in each of the repos it maps to.
+func newTestRunfiles(t *testing.T, repoMapping string) string {
+	dir := t.TempDir()
+	for _, repo := range []string{"_main", "protobuf+", "+deps+", "special+"} {
+		if err := os.Mkdir(filepath.Join(dir, repo), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, repo, "file.txt"), []byte(repo), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "_repo_mapping"), []byte(repoMapping), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRepoMapping(t *testing.T) {
+	compact := compactRepoMappingManifest(testRepoMapping)
+	if !strings.Contains(compact, "\n+deps+*,deps,+deps+\n") {
+		t.Fatalf("expected a wildcard entry in the compact repo mapping, got:\n%s", compact)
+	}
+	for _, format := range []struct {
+		name, repoMapping string
+	}{
+		{"full", testRepoMapping},
+		{"compact", compact},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			dir := newTestRunfiles(t, format.repoMapping)
+			for _, tt := range []struct {
+				sourceRepo, path, want string
+			}{
+				{"", "my_deps/file.txt", "+deps+/file.txt"},
+				{"", "my_protobuf/file.txt", "protobuf+/file.txt"},
+				{"", "deps/file.txt", "deps/file.txt"},
+				{"protobuf+", "protobuf/file.txt", "protobuf+/file.txt"},
+				{"+deps+lib_a", "deps/file.txt", "+deps+/file.txt"},
+				{"+deps+lib_b", "protobuf/file.txt", "protobuf+/file.txt"},
+				{"+deps+lib_b", "my_deps/file.txt", "my_deps/file.txt"},
+				{"+other+lib_a", "deps/file.txt", "deps/file.txt"},
+			} {
+				r, err := runfiles.New(runfiles.Directory(dir), runfiles.SourceRepo(tt.sourceRepo))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := r.Rlocation(tt.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := filepath.Join(dir, filepath.FromSlash(tt.want)); got != want {
+					t.Errorf("Rlocation(%q) from %q: got %q, want %q", tt.path, tt.sourceRepo, got, want)
+				}
+			}
+
+			r, err := runfiles.New(runfiles.Directory(dir), runfiles.SourceRepo("+deps+lib_a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := fs.ReadFile(r, "deps/file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "+deps+" {
+				t.Errorf("ReadFile(deps/file.txt): got %q, want %q", content, "+deps+")
+			}
+			entries, err := fs.ReadDir(r, ".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if got, want := strings.Join(names, ","), "+deps+,_main,_repo_mapping,deps,protobuf,protobuf+,special+"; got != want {
+				t.Errorf("ReadDir(.): got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRepoMapping_precedence(t *testing.T) {
+	dir := newTestRunfiles(t, `+deps+*,deps,+deps+
++deps+*,protobuf,protobuf+
++deps+lib_*,deps,special+
++deps+lib_c,protobuf,special+
+*,protobuf,_main
+`)
+	for _, tt := range []struct {
+		sourceRepo, path, want string
+	}{
+		{"+deps+other", "deps/file.txt", "+deps+/file.txt"},
+		{"+deps+lib_a", "deps/file.txt", "special+/file.txt"},
+		{"+deps+lib_a", "protobuf/file.txt", "protobuf+/file.txt"},
+		{"+deps+lib_c", "protobuf/file.txt", "special+/file.txt"},
+		{"+deps+lib_c", "deps/file.txt", "special+/file.txt"},
+		{"+other+lib_a", "protobuf/file.txt", "_main/file.txt"},
+		{"+other+lib_a", "deps/file.txt", "deps/file.txt"},
+	} {
+		r, err := runfiles.New(runfiles.Directory(dir), runfiles.SourceRepo(tt.sourceRepo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := r.Rlocation(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("Rlocation(%q) from %q: got %q, want %q", tt.path, tt.sourceRepo, got, want)
+		}
+	}
+}
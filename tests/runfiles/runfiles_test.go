@@ -16,11 +16,15 @@ package runfiles_test
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
 
@@ -139,10 +143,10 @@ func TestRunfiles_manifestWithDir(t *testing.T) {
 		"foo/dir/file":               filepath.FromSlash("path/to/foo/dir/file"),
 		"foo/dir/deeply/nested/file": filepath.FromSlash("path/to/foo/dir/deeply/nested/file"),
 		`dir with spac\e
-s`:            filepath.FromSlash(`F:\j k\dir with spa
+s`: filepath.FromSlash(`F:\j k\dir with spa
 ces`),
 		`dir with spac\e
-s/file`:            filepath.FromSlash(`F:\j k\dir with spa
+s/file`: filepath.FromSlash(`F:\j k\dir with spa
 ces/file`),
 	} {
 		t.Run(rlocation, func(t *testing.T) {
@@ -195,3 +199,96 @@ func TestRunfiles_manifestEnv(t *testing.T) {
 		t.Errorf("Env: got %v, want %v", r.Env(), want)
 	}
 }
+
+func TestRunfiles_manifestLookup(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	if err := os.WriteFile(target, []byte("target"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	targetDir := filepath.Join(dir, "target_dir")
+	if err := os.MkdirAll(filepath.Join(targetDir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDir, "sub", "file.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repoMapping := filepath.Join(dir, "repo_mapping")
+	if err := os.WriteFile(repoMapping, []byte(",my_module,_main\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("_main/pkg%03d/file%d.txt %s", i/10, i%10, filepath.ToSlash(target)))
+	}
+	lines = append(lines,
+		"_main/empty/__init__.py ",
+		"_main/tree "+filepath.ToSlash(targetDir),
+		"_repo_mapping "+filepath.ToSlash(repoMapping),
+		` _main/with\sspace `+filepath.ToSlash(target),
+	)
+	sort.Strings(lines)
+
+	for _, order := range []string{"sorted", "unsorted"} {
+		t.Run(order, func(t *testing.T) {
+			manifestLines := append([]string(nil), lines...)
+			if order == "unsorted" {
+				for i, j := 0, len(manifestLines)-1; i < j; i, j = i+1, j-1 {
+					manifestLines[i], manifestLines[j] = manifestLines[j], manifestLines[i]
+				}
+			}
+			manifest := filepath.Join(t.TempDir(), "manifest")
+			if err := os.WriteFile(manifest, []byte(strings.Join(manifestLines, "\n")+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			r, err := runfiles.New(runfiles.ManifestFile(manifest), runfiles.SourceRepo(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for rlocation, want := range map[string]string{
+				"_main/pkg000/file0.txt":     target,
+				"_main/pkg099/file9.txt":     target,
+				"_main/pkg042/file3.txt":     target,
+				"_main/tree/sub/file.txt":    filepath.Join(targetDir, "sub", "file.txt"),
+				"_main/with space":           target,
+				"my_module/pkg001/file5.txt": target,
+			} {
+				if got, err := r.Rlocation(rlocation); err != nil {
+					t.Errorf("Rlocation(%q): unexpected error %q", rlocation, err)
+				} else if got != want {
+					t.Errorf("Rlocation(%q): got %q, want %q", rlocation, got, want)
+				}
+			}
+			if _, err := r.Rlocation("_main/pkg100/file0.txt"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Rlocation for missing file: got error %v, want something that wraps %v", err, os.ErrNotExist)
+			}
+			if _, err := r.Rlocation("_main/empty/__init__.py"); !errors.Is(err, runfiles.ErrEmpty) {
+				t.Errorf("Rlocation for empty file: got error %v, want something that wraps %v", err, runfiles.ErrEmpty)
+			}
+
+			var files []string
+			err = fs.WalkDir(r, "_main", func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1003 {
+				t.Errorf("WalkDir: got %d files, want %d", len(files), 1003)
+			}
+			for _, want := range []string{"_main/pkg000/file0.txt", "_main/tree/sub/file.txt", "_main/with space"} {
+				if !slices.Contains(files, want) {
+					t.Errorf("WalkDir: %s not found in %v", want, files)
+				}
+			}
+		})
+	}
+}